@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// responses to blocked domains, any other value is a sinkhole ip (or an ipv4 and ipv6 pair separated by a comma)
+const (
+	BlockResponseNXDomain = "NXDOMAIN"
+	BlockResponseRefused  = "REFUSED"
+	BlockResponseNoData   = "NODATA"
+	BlockResponseNull     = "NULL"
+)
+
+// the default ttl of (sinkhole/null) block responses
+const DefaultBlockTTL = 60
+
+var blockResponseKeywords = []string{BlockResponseNXDomain, BlockResponseRefused, BlockResponseNoData, BlockResponseNull}
+
+// parses the sinkhole ips from a block response, returns nil for either if not present
+func BlockResponseAddresses(blockResponse string) (net.IP, net.IP) {
+	var ipv4, ipv6 net.IP
+	for _, value := range strings.Split(blockResponse, ",") {
+		ip := net.ParseIP(strings.TrimSpace(value))
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			ipv4 = ip.To4()
+		} else {
+			ipv6 = ip
+		}
+	}
+	return ipv4, ipv6
+}
+
+// normalizes a configured block response and returns an error if it can't be used
+func verifyBlockResponse(owner string, blockResponse string, blockTTL int) (string, error) {
+	if blockTTL < 0 {
+		return "", fmt.Errorf("Invalid block ttl %d for %s", blockTTL, owner)
+	}
+
+	blockResponse = strings.TrimSpace(blockResponse)
+	if "" == blockResponse {
+		return "", nil
+	}
+
+	for _, keyword := range blockResponseKeywords {
+		if strings.EqualFold(keyword, blockResponse) {
+			return keyword, nil
+		}
+	}
+
+	// every part of a sinkhole response needs to be an ip
+	for _, value := range strings.Split(blockResponse, ",") {
+		if net.ParseIP(strings.TrimSpace(value)) == nil {
+			return "", fmt.Errorf("Invalid block response '%s' for %s, expected one of %s or sinkhole ip address(es)", blockResponse, owner, strings.Join(blockResponseKeywords, ", "))
+		}
+	}
+	return blockResponse, nil
+}
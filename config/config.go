@@ -6,6 +6,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 
@@ -15,13 +16,46 @@ import (
 const (
 	defaultString = "default"
 	systemString  = "system"
+
+	// the shortest interval that remote lists are refreshed at
+	minListRefresh = time.Minute
+)
+
+// youtube restrictions used with safe search
+const (
+	SafeSearchYouTubeStrict   = "strict"
+	SafeSearchYouTubeModerate = "moderate"
 )
 
 var remoteProtocols = []string{"http:", "https:"}
 var alphaRegex, _ = regexp.Compile("[^a-zA-Z0-9]+")
 
 type GudgeonTLS struct {
+	// enables dns-over-tls for the interface(s)
 	Enabled bool `yaml:"enabled"`
+	// the port to listen for dns-over-tls connections on, defaults to 853
+	Port int `yaml:"port"`
+	// path to the PEM encoded certificate (or certificate chain) file
+	Cert string `yaml:"cert"`
+	// path to the PEM encoded private key for the certificate
+	Key string `yaml:"key"`
+	// path to a PEM bundle of certificate authorities used to verify client certificates
+	ClientCA string `yaml:"client_ca"`
+	// how client certificates are handled: none, request, require, verify, or require-verify (defaults to require-verify when a client ca is given)
+	ClientAuth string `yaml:"client_auth"`
+	// minimum and maximum tls versions ("1.0", "1.1", "1.2", "1.3"), defaults to a minimum of 1.2
+	MinVersion string `yaml:"min_version"`
+	MaxVersion string `yaml:"max_version"`
+	// cipher suite names (like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256), go defaults are used when empty
+	Ciphers []string `yaml:"ciphers"`
+}
+
+// settings for verifying upstream (source) tls certificates
+type GudgeonSourceTLS struct {
+	// path to a PEM bundle of certificate authorities to trust instead of the system pool
+	CA string `yaml:"ca"`
+	// base64 encoded sha256 hashes of trusted subject public key info (like "sha256/Y9mvm0exBk1JoQ57f9Vm28jKo5lFm/woKcVxrYxu80o="), one must match the certificate chain
+	Pins []string `yaml:"pins"`
 }
 
 type GudgeonDatabase struct {
@@ -47,6 +81,20 @@ type GudgeonQueryLog struct {
 	NetbiosLookup *bool `yaml:"netbios"`
 }
 
+// how remote lists are downloaded and checked before they replace the cached copy
+type GudgeonDownload struct {
+	// timeout: the longest a single download attempt can take, defaults to 60s
+	Timeout string `yaml:"timeout"`
+	// retries: how many more times a download is tried after a connection error or server error, defaults to 3
+	Retries *int `yaml:"retries"`
+	// max_size: the largest list (in megabytes, after decompression) that is used, defaults to 256
+	MaxSize int `yaml:"max_size"`
+	// min_rules: downloads with fewer rules are rejected unless the list sets its own minimum, defaults to 1
+	MinRules *int `yaml:"min_rules"`
+	// max_drop: downloads with this percent fewer rules than the cached copy are rejected unless the list sets its own, 0 (the default) allows any drop
+	MaxDrop int `yaml:"max_drop"`
+}
+
 type GudgeonMetrics struct {
 	// controls if the entire feature is enabled/disabled
 	Enabled *bool `yaml:"enabled"`
@@ -67,6 +115,9 @@ type GudgeonStorage struct {
 	RuleStorage string `yaml:"rules"`
 	// you can enable/disable the cache here, default is to enable
 	CacheEnabled *bool `yaml:"cache"`
+	// snapshots of the loaded rules for each list are saved in the data directory and used on the next start
+	// instead of reading lists that have not changed, default is to enable
+	Snapshots *bool `yaml:"snapshots"`
 }
 
 // network interface information
@@ -111,18 +162,48 @@ type GudgeonResolver struct {
 	Hosts []string `yaml:"hosts"`
 	// sources (described via string)
 	Sources []string `yaml:"sources"`
+	// bootstrap: name of the resolver used to look up the host names of sources (like dns-over-https urls), defaults to system
+	Bootstrap string `yaml:"bootstrap"`
+	// tls: settings for verifying the certificates of tls sources (tcp-tls and https) in this resolver
+	TLS *GudgeonSourceTLS `yaml:"tls"`
+}
+
+// rebind protection rejects answers for public names that resolve to private, loopback, link-local, cgnat, or ula addresses
+type GudgeonRebindProtection struct {
+	// enabled: use rebind protection for every group that does not turn it on or off itself
+	Enabled bool `yaml:"enabled"`
+	// exempt_domains: domains (and their subdomains) or wildcards that are allowed to resolve to private addresses
+	ExemptDomains []string `yaml:"exempt_domains"`
+	// exempt_resolvers: resolvers that are allowed to answer with private addresses
+	ExemptResolvers []string `yaml:"exempt_resolvers"`
 }
 
 // blocklists, blacklists, whitelists: different types of lists for domains that gudgeon will evaluate
 type GudgeonList struct {
 	// the name of the list
 	Name string `yaml:"name"`
-	// the type of the list, requires "allow" or "block", defaults to "block"
+	// the type of the list, requires "allow", "block", "rewrite", "block-ip", or "rpz", defaults to "block"
 	Type string `yaml:"type"`
 	// the tags that relate to the list for tag filtering/processing
 	Tags *[]string `yaml:"tags"`
 	// the path to the list, remote paths will be downloaded if possible
 	Source string `yaml:"src"`
+	// the response to a domain blocked by this list (NXDOMAIN, REFUSED, NODATA, NULL, or sinkhole ip(s)), defaults to NXDOMAIN
+	BlockResponse string `yaml:"block_response"`
+	// the ttl of (sinkhole/null) block responses
+	BlockTTL int `yaml:"block_ttl"`
+	// refresh: how often a remote list is downloaded again (like "12h" or "1d"), "0" never refreshes, defaults to list_refresh
+	Refresh string `yaml:"refresh"`
+	// min_rules: a download of this list with fewer rules is rejected, defaults to the download min_rules
+	MinRules *int `yaml:"min_rules"`
+	// max_drop: a download of this list with this percent fewer rules than the cached copy is rejected, defaults to the download max_drop
+	MaxDrop *int `yaml:"max_drop"`
+	// priority: a match in a list with a higher priority wins over a match in a list with a lower priority (allow lists win over block
+	// lists with the same priority), defaults to the highest priority of the groups the list is used by
+	Priority *int `yaml:"priority"`
+
+	// parsed values
+	refresh time.Duration
 }
 
 // simple function to get source as name if name is missing
@@ -138,6 +219,32 @@ func (list *GudgeonList) ShortName() string {
 	return alphaRegex.ReplaceAllString(name, "_")
 }
 
+// the fewest rules a download of the list can have and the largest drop (in percent) from the cached copy, zero allows any drop
+func (config *GudgeonConfig) DownloadLimits(list *GudgeonList) (int, int) {
+	minRules, maxDrop := 0, 0
+	if config.Download != nil {
+		if config.Download.MinRules != nil {
+			minRules = *config.Download.MinRules
+		}
+		maxDrop = config.Download.MaxDrop
+	}
+	if list != nil && list.MinRules != nil {
+		minRules = *list.MinRules
+	}
+	if list != nil && list.MaxDrop != nil {
+		maxDrop = *list.MaxDrop
+	}
+	return minRules, maxDrop
+}
+
+// how often the list is downloaded again, zero if the list is never refreshed
+func (list *GudgeonList) RefreshInterval() time.Duration {
+	if !list.IsRemote() {
+		return 0
+	}
+	return list.refresh
+}
+
 func (list *GudgeonList) IsRemote() bool {
 	return list != nil && "" != list.Source && util.StartsWithAny(list.Source, remoteProtocols)
 }
@@ -171,6 +278,22 @@ type GudgeonGroup struct {
 	Lists []string `yaml:"lists"`
 	// tags: tags to use for tag-based matching
 	Tags *[]string `yaml:"tags"`
+	// block_response: the response to a domain blocked for this group, overrides the response configured on the list
+	BlockResponse string `yaml:"block_response"`
+	// block_ttl: the ttl of (sinkhole/null) block responses
+	BlockTTL int `yaml:"block_ttl"`
+	// safesearch: rewrite search engines (and youtube) to their safe search versions
+	SafeSearch bool `yaml:"safesearch"`
+	// safesearch_youtube: the youtube restriction used with safe search, "strict" or "moderate" (default: strict)
+	SafeSearchYouTube string `yaml:"safesearch_youtube"`
+	// list_schedules: limits lists (by list name or tag) of this group to the times of the named schedule
+	ListSchedules map[string]string `yaml:"list_schedules"`
+	// cname_protection: block an answer when any cname target in it matches a block list of this group
+	CnameProtection bool `yaml:"cname_protection"`
+	// rebind_protection: turn rebind protection on or off for this group, defaults to the global rebind protection setting
+	RebindProtection *bool `yaml:"rebind_protection"`
+	// priority: the priority of the lists (and custom rules) of this group that don't have their own priority (default: 0)
+	Priority int `yaml:"priority"`
 }
 
 func (list *GudgeonGroup) SafeTags() []string {
@@ -199,12 +322,38 @@ type GudgeonConsumer struct {
 	Block   bool            `yaml:"block"`
 	Groups  []string        `yaml:"groups"`
 	Matches []*GudgeonMatch `yaml:"matches"`
+	// the response to a domain blocked for this consumer, overrides the response configured on groups and lists
+	BlockResponse string `yaml:"block_response"`
+	BlockTTL      int    `yaml:"block_ttl"`
+	// limits membership in groups (by group name) to the times of the named schedule
+	GroupSchedules map[string]string `yaml:"group_schedules"`
+}
+
+// schedules: named days of the week and time ranges that limit when group lists and consumer groups apply
+type GudgeonSchedule struct {
+	// name: name of the schedule
+	Name string `yaml:"name"`
+	// timezone: the name of the timezone (like "America/New_York") that the days and times are in, defaults to local time
+	Timezone string `yaml:"timezone"`
+	// days: the days of the week (sun, mon, tue, wed, thu, fri, sat) the schedule starts on, every day if empty
+	Days []string `yaml:"days"`
+	// times: time ranges like "21:00-07:00", a range that ends before it starts ends on the next day, all day if empty
+	Times []string `yaml:"times"`
+
+	// parsed values
+	location *time.Location
+	weekdays map[time.Weekday]bool
+	ranges   []scheduleRange
 }
 
 type GudgeonWeb struct {
 	Enabled bool   `yaml:"enabled"`
 	Address string `yaml:"address"`
 	Port    int    `yaml:"port"`
+	// serve dns-over-https (rfc8484) requests at /dns-query, defaults to true
+	DoH *bool `yaml:"doh"`
+	// serve the web ui (and dns-over-https) with tls, the tls port is not used
+	TLS *GudgeonTLS `yaml:"tls"`
 }
 
 type GudgeonConfig struct {
@@ -212,6 +361,7 @@ type GudgeonConfig struct {
 	Storage   *GudgeonStorage    `yaml:"storage"`
 	Database  *GudgeonDatabase   `yaml:"database"`
 	Metrics   *GudgeonMetrics    `yaml:"metrics"`
+	Download  *GudgeonDownload   `yaml:"download"`
 	QueryLog  *GudgeonQueryLog   `yaml:"query_log"`
 	Network   *GudgeonNetwork    `yaml:"network"`
 	Web       *GudgeonWeb        `yaml:"web"`
@@ -219,12 +369,19 @@ type GudgeonConfig struct {
 	Lists     []*GudgeonList     `yaml:"lists"`
 	Groups    []*GudgeonGroup    `yaml:"groups"`
 	Consumers []*GudgeonConsumer `yaml:"consumers"`
+	Schedules []*GudgeonSchedule `yaml:"schedules"`
+
+	RebindProtection *GudgeonRebindProtection `yaml:"rebind_protection"`
+
+	// list_refresh: how often remote lists are downloaded again unless the list sets its own refresh, never if empty
+	ListRefresh string `yaml:"list_refresh"`
 
 	// private values
 	resolverMap map[string]*GudgeonResolver
 	listMap     map[string]*GudgeonList
 	groupMap    map[string]*GudgeonGroup
 	consumerMap map[string]*GudgeonConsumer
+	scheduleMap map[string]*GudgeonSchedule
 }
 
 func (config *GudgeonConfig) GetResolver(name string) *GudgeonResolver {
@@ -255,6 +412,13 @@ func (config *GudgeonConfig) GetConsumer(name string) *GudgeonConsumer {
 	return nil
 }
 
+func (config *GudgeonConfig) GetSchedule(name string) *GudgeonSchedule {
+	if value, found := config.scheduleMap[name]; found {
+		return value
+	}
+	return nil
+}
+
 type GudgeonRoot struct {
 	Config *GudgeonConfig `yaml:"gudgeon"`
 }
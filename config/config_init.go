@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"os"
 	"os/user"
 	"path"
 	"strings"
@@ -14,6 +15,10 @@ func boolPointer(b bool) *bool {
 	return &b
 }
 
+func intPointer(i int) *int {
+	return &i
+}
+
 // encapsulate logic to make it easier to read in this file
 func (config *GudgeonConfig) verifyAndInit() ([]string, []error) {
 	// collect errors for reporting/combining into one error
@@ -25,6 +30,7 @@ func (config *GudgeonConfig) verifyAndInit() ([]string, []error) {
 	config.listMap = make(map[string]*GudgeonList, 0)
 	config.consumerMap = make(map[string]*GudgeonConsumer, 0)
 	config.groupMap = make(map[string]*GudgeonGroup, 0)
+	config.scheduleMap = make(map[string]*GudgeonSchedule, 0)
 
 	// set home dir
 	if "" == config.Home {
@@ -42,6 +48,7 @@ func (config *GudgeonConfig) verifyAndInit() ([]string, []error) {
 		config.Storage = &GudgeonStorage{
 			RuleStorage:  "memory",
 			CacheEnabled: boolPointer(true),
+			Snapshots:    boolPointer(true),
 		}
 	}
 	config.Storage.verifyAndInit()
@@ -86,12 +93,25 @@ func (config *GudgeonConfig) verifyAndInit() ([]string, []error) {
 	errors = append(errors, err...)
 	warnings = append(warnings, warn...)
 
+	// remote list downloads
+	if config.Download == nil {
+		config.Download = &GudgeonDownload{}
+	}
+	warn, err = config.Download.verifyAndInit()
+	errors = append(errors, err...)
+	warnings = append(warnings, warn...)
+
 	// query log configuration
 	if config.QueryLog == nil {
 		config.QueryLog = &GudgeonQueryLog{}
 	}
 	warn, err = config.QueryLog.verifyAndInit()
 
+	// schedules (before the groups and consumers that use them)
+	warn, err = config.verifyAndInitSchedules()
+	errors = append(errors, err...)
+	warnings = append(warnings, warn...)
+
 	// groups
 	warn, err = config.verifyAndInitGroups()
 	errors = append(errors, err...)
@@ -112,6 +132,14 @@ func (config *GudgeonConfig) verifyAndInit() ([]string, []error) {
 	errors = append(errors, err...)
 	warnings = append(warnings, warn...)
 
+	// rebind protection (after the resolvers that can be exempt)
+	if config.RebindProtection == nil {
+		config.RebindProtection = &GudgeonRebindProtection{}
+	}
+	warn, err = config.verifyAndInitRebindProtection()
+	errors = append(errors, err...)
+	warnings = append(warnings, warn...)
+
 	return warnings, errors
 }
 
@@ -119,6 +147,9 @@ func (storage *GudgeonStorage) verifyAndInit() ([]string, []error) {
 	if storage.CacheEnabled == nil {
 		storage.CacheEnabled = boolPointer(true)
 	}
+	if storage.Snapshots == nil {
+		storage.Snapshots = boolPointer(true)
+	}
 
 	return []string{}, []error{}
 }
@@ -131,6 +162,12 @@ func (web *GudgeonWeb) verifyAndInit() ([]string, []error) {
 		if web.Port < 1 {
 			web.Port = 9009
 		}
+		if web.DoH == nil {
+			web.DoH = boolPointer(true)
+		}
+		if web.TLS != nil {
+			return web.TLS.verifyAndInit()
+		}
 	}
 
 	return []string{}, []error{}
@@ -148,6 +185,16 @@ func (network *GudgeonNetwork) verifyAndInit() ([]string, []error) {
 		network.Systemd = boolPointer(true)
 	}
 
+	// collect warnings and errors from tls blocks
+	warnings := make([]string, 0)
+	errors := make([]error, 0)
+
+	if network.TLS != nil {
+		warn, err := network.TLS.verifyAndInit()
+		warnings = append(warnings, warn...)
+		errors = append(errors, err...)
+	}
+
 	// do the same for all configured interfaces
 	for _, iface := range network.Interfaces {
 		if iface.TCP == nil {
@@ -156,9 +203,101 @@ func (network *GudgeonNetwork) verifyAndInit() ([]string, []error) {
 		if iface.UDP == nil {
 			iface.UDP = network.UDP
 		}
+		// interfaces without their own tls block use the global one
+		if iface.TLS == nil {
+			iface.TLS = network.TLS
+		} else {
+			warn, err := iface.TLS.verifyAndInit()
+			warnings = append(warnings, warn...)
+			errors = append(errors, err...)
+		}
 	}
 
-	return []string{}, []error{}
+	return warnings, errors
+}
+
+func (gtls *GudgeonTLS) verifyAndInit() ([]string, []error) {
+	// collect warnings and errors
+	warnings := make([]string, 0)
+	errors := make([]error, 0)
+
+	// nothing to verify if tls is not in use
+	if !gtls.Enabled {
+		return warnings, errors
+	}
+
+	if gtls.Port < 1 {
+		gtls.Port = 853
+	}
+
+	if "" == gtls.Cert || "" == gtls.Key {
+		errors = append(errors, fmt.Errorf("TLS is enabled but a certificate ('cert') and key ('key') were not both provided"))
+	}
+	for _, file := range []string{gtls.Cert, gtls.Key, gtls.ClientCA} {
+		if "" == file {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errors = append(errors, fmt.Errorf("TLS file '%s' could not be read: %s", file, err))
+		}
+	}
+
+	if "" == gtls.ClientAuth {
+		if "" != gtls.ClientCA {
+			gtls.ClientAuth = "require-verify"
+		} else {
+			gtls.ClientAuth = "none"
+		}
+	}
+	gtls.ClientAuth = strings.ToLower(gtls.ClientAuth)
+	if _, found := tlsClientAuthTypes[gtls.ClientAuth]; !found {
+		errors = append(errors, fmt.Errorf("Unknown TLS client authentication type '%s'", gtls.ClientAuth))
+	} else if "" == gtls.ClientCA && (gtls.ClientAuth == "verify" || gtls.ClientAuth == "require-verify") {
+		warnings = append(warnings, fmt.Sprintf("TLS client authentication '%s' has no client CA ('client_ca') and will use the system certificate pool", gtls.ClientAuth))
+	}
+
+	if "" == gtls.MinVersion {
+		gtls.MinVersion = "1.2"
+	}
+	for _, version := range []string{gtls.MinVersion, gtls.MaxVersion} {
+		if _, found := tlsVersions[version]; "" != version && !found {
+			errors = append(errors, fmt.Errorf("Unknown TLS version '%s', expected one of 1.0, 1.1, 1.2, or 1.3", version))
+		}
+	}
+
+	// drop unknown ciphers instead of failing
+	ciphers := make([]string, 0, len(gtls.Ciphers))
+	for _, cipher := range gtls.Ciphers {
+		cipher = strings.ToUpper(strings.TrimSpace(cipher))
+		if _, found := tlsCipherSuites[cipher]; !found {
+			warnings = append(warnings, fmt.Sprintf("Unknown TLS cipher suite '%s' will not be used", cipher))
+			continue
+		}
+		ciphers = append(ciphers, cipher)
+	}
+	gtls.Ciphers = ciphers
+
+	return warnings, errors
+}
+
+func (stls *GudgeonSourceTLS) verifyAndInit() []error {
+	errors := make([]error, 0)
+
+	if "" != stls.CA {
+		if _, err := os.Stat(stls.CA); err != nil {
+			errors = append(errors, fmt.Errorf("TLS CA file '%s' could not be read: %s", stls.CA, err))
+		}
+	}
+
+	for idx, pin := range stls.Pins {
+		pin = strings.TrimPrefix(strings.TrimSpace(pin), pinPrefix)
+		if _, err := decodePin(pin); err != nil {
+			errors = append(errors, fmt.Errorf("Invalid TLS public key pin '%s': %s", stls.Pins[idx], err))
+		}
+		stls.Pins[idx] = pin
+	}
+
+	return errors
 }
 
 func (database *GudgeonDatabase) verifyAndInit() ([]string, []error) {
@@ -181,6 +320,41 @@ func (database *GudgeonDatabase) verifyAndInit() ([]string, []error) {
 	return warnings, []error{}
 }
 
+func (download *GudgeonDownload) verifyAndInit() ([]string, []error) {
+	// collect warnings
+	warnings := make([]string, 0)
+
+	if "" == download.Timeout {
+		download.Timeout = "60s"
+	}
+	if parsed, err := util.ParseDuration(download.Timeout); err != nil {
+		warnings = append(warnings, fmt.Sprintf("Could not parse download timeout: %s, using default (60s)", err))
+		download.Timeout = "60s"
+	} else if parsed < time.Second {
+		warnings = append(warnings, fmt.Sprintf("A download timeout less than 1s is too short, using default value (60s)"))
+		download.Timeout = "60s"
+	}
+
+	if download.Retries == nil || *download.Retries < 0 {
+		download.Retries = intPointer(3)
+	}
+
+	if download.MaxSize <= 0 {
+		download.MaxSize = 256
+	}
+
+	if download.MinRules == nil || *download.MinRules < 0 {
+		download.MinRules = intPointer(1)
+	}
+
+	if download.MaxDrop < 0 || download.MaxDrop > 100 {
+		warnings = append(warnings, fmt.Sprintf("The download max_drop must be a percent from 0 to 100, allowing any drop"))
+		download.MaxDrop = 0
+	}
+
+	return warnings, []error{}
+}
+
 func (metrics *GudgeonMetrics) verifyAndInit() ([]string, []error) {
 	// collect warnings
 	warnings := make([]string, 0)
@@ -265,8 +439,9 @@ func (ql *GudgeonQueryLog) verifyAndInit() ([]string, []error) {
 
 // verify all the groups at once and set the groupMap
 func (config *GudgeonConfig) verifyAndInitGroups() ([]string, []error) {
-	// collect warnings
+	// collect warnings and errors
 	warnings := make([]string, 0)
+	errors := make([]error, 0)
 
 	// add groups to group map
 	for _, group := range config.Groups {
@@ -279,6 +454,22 @@ func (config *GudgeonConfig) verifyAndInitGroups() ([]string, []error) {
 		}
 		group.Name = strings.ToLower(group.Name)
 
+		var err error
+		if group.BlockResponse, err = verifyBlockResponse(fmt.Sprintf("group '%s'", group.Name), group.BlockResponse, group.BlockTTL); err != nil {
+			errors = append(errors, err)
+		}
+
+		group.SafeSearchYouTube = strings.ToLower(strings.TrimSpace(group.SafeSearchYouTube))
+		if "" == group.SafeSearchYouTube {
+			group.SafeSearchYouTube = SafeSearchYouTubeStrict
+		} else if SafeSearchYouTubeStrict != group.SafeSearchYouTube && SafeSearchYouTubeModerate != group.SafeSearchYouTube {
+			errors = append(errors, fmt.Errorf("The group '%s' has an invalid safesearch_youtube value '%s', it must be '%s' or '%s'", group.Name, group.SafeSearchYouTube, SafeSearchYouTubeStrict, SafeSearchYouTubeModerate))
+		}
+
+		var scheduleErrors []error
+		group.ListSchedules, scheduleErrors = config.verifyScheduleNames(fmt.Sprintf("group '%s'", group.Name), group.ListSchedules)
+		errors = append(errors, scheduleErrors...)
+
 		if _, found := config.groupMap[group.Name]; found {
 			warnings = append(warnings, "More than one group was found with the name '%s', group names are case insensitive and must be unique.", group.Name)
 			continue
@@ -297,13 +488,84 @@ func (config *GudgeonConfig) verifyAndInitGroups() ([]string, []error) {
 		config.groupMap[defaultString] = defaultGroup
 	}
 
-	return warnings, []error{}
+	return warnings, errors
+}
+
+// verify all schedules at once and set the schedule map
+func (config *GudgeonConfig) verifyAndInitSchedules() ([]string, []error) {
+	// collect warnings and errors
+	warnings := make([]string, 0)
+	errors := make([]error, 0)
+
+	for _, schedule := range config.Schedules {
+		if schedule == nil {
+			continue
+		}
+		if "" == schedule.Name {
+			warnings = append(warnings, "A schedule with no name was found in the configuration, a schedule with no name will not be used.")
+			continue
+		}
+		schedule.Name = strings.ToLower(schedule.Name)
+
+		warn, err := schedule.verifyAndInit()
+		errors = append(errors, err...)
+		warnings = append(warnings, warn...)
+
+		if _, found := config.scheduleMap[schedule.Name]; found {
+			warnings = append(warnings, fmt.Sprintf("More than one schedule was found with the name '%s', schedule names are case insensitive and must be unique.", schedule.Name))
+			continue
+		}
+		config.scheduleMap[schedule.Name] = schedule
+	}
+
+	return warnings, errors
+}
+
+// normalize the exempt domains and resolvers of the rebind protection and check that the resolvers exist
+func (config *GudgeonConfig) verifyAndInitRebindProtection() ([]string, []error) {
+	warnings := make([]string, 0)
+	errors := make([]error, 0)
+
+	rebind := config.RebindProtection
+	for idx, domain := range rebind.ExemptDomains {
+		rebind.ExemptDomains[idx] = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	}
+	for idx, resolverName := range rebind.ExemptResolvers {
+		resolverName = strings.ToLower(strings.TrimSpace(resolverName))
+		rebind.ExemptResolvers[idx] = resolverName
+		if config.GetResolver(resolverName) == nil {
+			warnings = append(warnings, fmt.Sprintf("Rebind protection exempts the resolver '%s' but no resolver with that name exists", resolverName))
+		}
+	}
+
+	return warnings, errors
+}
+
+// lower case the names in a map of names to schedule names and check that each schedule exists
+func (config *GudgeonConfig) verifyScheduleNames(owner string, schedules map[string]string) (map[string]string, []error) {
+	errors := make([]error, 0)
+	if len(schedules) == 0 {
+		return schedules, errors
+	}
+
+	verified := make(map[string]string, len(schedules))
+	for name, scheduleName := range schedules {
+		scheduleName = strings.ToLower(scheduleName)
+		if _, found := config.scheduleMap[scheduleName]; !found {
+			errors = append(errors, fmt.Errorf("The %s uses the schedule '%s' for '%s' but no schedule with that name exists", owner, scheduleName, name))
+			continue
+		}
+		verified[strings.ToLower(name)] = scheduleName
+	}
+
+	return verified, errors
 }
 
 // verify all consumers at once, add a default consumer if needed, and set the group map
 func (config *GudgeonConfig) verifyAndInitConsumers() ([]string, []error) {
-	// collect warnings
+	// collect warnings and errors
 	warnings := make([]string, 0)
+	errors := make([]error, 0)
 
 	for _, consumer := range config.Consumers {
 		if consumer == nil {
@@ -315,6 +577,15 @@ func (config *GudgeonConfig) verifyAndInitConsumers() ([]string, []error) {
 		}
 		consumer.Name = strings.ToLower(consumer.Name)
 
+		var err error
+		if consumer.BlockResponse, err = verifyBlockResponse(fmt.Sprintf("consumer '%s'", consumer.Name), consumer.BlockResponse, consumer.BlockTTL); err != nil {
+			errors = append(errors, err)
+		}
+
+		var scheduleErrors []error
+		consumer.GroupSchedules, scheduleErrors = config.verifyScheduleNames(fmt.Sprintf("consumer '%s'", consumer.Name), consumer.GroupSchedules)
+		errors = append(errors, scheduleErrors...)
+
 		if _, found := config.consumerMap[consumer.Name]; found {
 			warnings = append(warnings, "More than one consumer was found with the name '%s', consumer names are case insensitive and must be unique.", consumer.Name)
 			continue
@@ -331,12 +602,13 @@ func (config *GudgeonConfig) verifyAndInitConsumers() ([]string, []error) {
 		config.consumerMap[defaultString] = defaultConsumer
 	}
 
-	return warnings, []error{}
+	return warnings, errors
 }
 
 func (config *GudgeonConfig) verifyAndInitResolvers() ([]string, []error) {
-	// collect warnings
+	// collect warnings and errors
 	warnings := make([]string, 0)
+	errors := make([]error, 0)
 
 	for _, resolver := range config.Resolvers {
 		if resolver == nil {
@@ -347,6 +619,12 @@ func (config *GudgeonConfig) verifyAndInitResolvers() ([]string, []error) {
 			continue
 		}
 		resolver.Name = strings.ToLower(resolver.Name)
+		resolver.Bootstrap = strings.ToLower(resolver.Bootstrap)
+
+		if resolver.TLS != nil {
+			err := resolver.TLS.verifyAndInit()
+			errors = append(errors, err...)
+		}
 
 		if _, found := config.resolverMap[resolver.Name]; found {
 			warnings = append(warnings, "More than one resolver was found with the name '%s', resolver names are case insensitive and must be unique.", resolver.Name)
@@ -384,12 +662,32 @@ func (config *GudgeonConfig) verifyAndInitResolvers() ([]string, []error) {
 		config.resolverMap[defaultString] = defaultResolver
 	}
 
-	return warnings, []error{}
+	return warnings, errors
+}
+
+// parse a list refresh interval, an interval that is too short is raised to the minimum
+func parseListRefresh(name string, refresh string) (time.Duration, []string) {
+	if "" == refresh {
+		return 0, []string{}
+	}
+	parsed, err := util.ParseDuration(refresh)
+	if err != nil {
+		return 0, []string{fmt.Sprintf("Could not parse refresh interval for %s: %s, it will not be refreshed", name, err)}
+	}
+	if parsed > 0 && parsed < minListRefresh {
+		return minListRefresh, []string{fmt.Sprintf("A refresh interval less than %s for %s is too short, using %s", minListRefresh, name, minListRefresh)}
+	}
+	return parsed, []string{}
 }
 
 func (config *GudgeonConfig) verifyAndInitLists() ([]string, []error) {
-	// collect warnings
+	// collect warnings and errors
 	warnings := make([]string, 0)
+	errors := make([]error, 0)
+
+	// the default refresh interval for lists that don't set one
+	defaultRefresh, refreshWarnings := parseListRefresh("lists", config.ListRefresh)
+	warnings = append(warnings, refreshWarnings...)
 
 	for _, list := range config.Lists {
 		if list == nil {
@@ -404,8 +702,24 @@ func (config *GudgeonConfig) verifyAndInitLists() ([]string, []error) {
 			continue
 		}
 		list.Name = strings.ToLower(list.Name)
+		list.Type = strings.ToLower(strings.TrimSpace(list.Type))
+		if "" != list.Type && "allow" != list.Type && "block" != list.Type && "rewrite" != list.Type && "block-ip" != list.Type && "rpz" != list.Type {
+			warnings = append(warnings, fmt.Sprintf("The list '%s' has an unknown type '%s' and will be treated as a block list", list.CanonicalName(), list.Type))
+		}
+
+		var err error
+		if list.BlockResponse, err = verifyBlockResponse(fmt.Sprintf("list '%s'", list.CanonicalName()), list.BlockResponse, list.BlockTTL); err != nil {
+			errors = append(errors, err)
+		}
+
+		list.refresh = defaultRefresh
+		if "" != list.Refresh {
+			list.refresh, refreshWarnings = parseListRefresh(fmt.Sprintf("list '%s'", list.CanonicalName()), list.Refresh)
+			warnings = append(warnings, refreshWarnings...)
+		}
+
 		config.listMap[list.CanonicalName()] = list
 	}
 
-	return warnings, []error{}
+	return warnings, errors
 }
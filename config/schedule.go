@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const minutesInDay = 24 * 60
+
+var scheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// a time range within a day in minutes since midnight
+type scheduleRange struct {
+	start int
+	end   int
+}
+
+// parse a time of day like "21:00" into minutes since midnight, "24:00" is allowed as the end of the day
+func parseMinutes(value string) (int, error) {
+	split := strings.Split(strings.TrimSpace(value), ":")
+	if len(split) != 2 {
+		return 0, fmt.Errorf("'%s' is not a time in the form hh:mm", value)
+	}
+	hours, err := strconv.Atoi(split[0])
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a time in the form hh:mm", value)
+	}
+	minutes, err := strconv.Atoi(split[1])
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a time in the form hh:mm", value)
+	}
+	total := hours*60 + minutes
+	if hours < 0 || minutes < 0 || minutes > 59 || total > minutesInDay {
+		return 0, fmt.Errorf("'%s' is not a valid time of day", value)
+	}
+	return total, nil
+}
+
+func (schedule *GudgeonSchedule) verifyAndInit() ([]string, []error) {
+	warnings := make([]string, 0)
+	errors := make([]error, 0)
+
+	schedule.location = time.Local
+	if "" != schedule.Timezone {
+		location, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Schedule '%s' has an unknown timezone '%s': %s", schedule.Name, schedule.Timezone, err))
+		} else {
+			schedule.location = location
+		}
+	}
+
+	schedule.weekdays = make(map[time.Weekday]bool)
+	for _, day := range schedule.Days {
+		day = strings.ToLower(strings.TrimSpace(day))
+		if len(day) > 3 {
+			day = day[:3]
+		}
+		weekday, found := scheduleDays[day]
+		if !found {
+			errors = append(errors, fmt.Errorf("Schedule '%s' has an unknown day '%s'", schedule.Name, day))
+			continue
+		}
+		schedule.weekdays[weekday] = true
+	}
+
+	schedule.ranges = make([]scheduleRange, 0, len(schedule.Times))
+	for _, times := range schedule.Times {
+		split := strings.Split(times, "-")
+		if len(split) != 2 {
+			errors = append(errors, fmt.Errorf("Schedule '%s' has a time range '%s' that is not in the form hh:mm-hh:mm", schedule.Name, times))
+			continue
+		}
+		start, err := parseMinutes(split[0])
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Schedule '%s' has an invalid start time: %s", schedule.Name, err))
+			continue
+		}
+		end, err := parseMinutes(split[1])
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Schedule '%s' has an invalid end time: %s", schedule.Name, err))
+			continue
+		}
+		if start == end {
+			warnings = append(warnings, fmt.Sprintf("Schedule '%s' has an empty time range '%s'", schedule.Name, times))
+		}
+		schedule.ranges = append(schedule.ranges, scheduleRange{start: start, end: end})
+	}
+
+	return warnings, errors
+}
+
+// true if the schedule starts on the given day
+func (schedule *GudgeonSchedule) onDay(day time.Weekday) bool {
+	return len(schedule.weekdays) == 0 || schedule.weekdays[day]
+}
+
+// true if the schedule is active at the given time, a range that ends before it starts belongs to the day it starts on
+func (schedule *GudgeonSchedule) IsActive(at time.Time) bool {
+	if schedule == nil {
+		return true
+	}
+
+	if schedule.location != nil {
+		at = at.In(schedule.location)
+	}
+	day := at.Weekday()
+	minutes := at.Hour()*60 + at.Minute()
+
+	if len(schedule.ranges) == 0 {
+		return schedule.onDay(day)
+	}
+
+	for _, r := range schedule.ranges {
+		if r.start <= r.end {
+			if schedule.onDay(day) && minutes >= r.start && minutes < r.end {
+				return true
+			}
+		} else if (schedule.onDay(day) && minutes >= r.start) || (schedule.onDay((day+6)%7) && minutes < r.end) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleIsActive(t *testing.T) {
+	schedule := &GudgeonSchedule{
+		Name:     "school nights",
+		Timezone: "America/New_York",
+		Days:     []string{"sun", "mon", "tue", "wed", "thursday"},
+		Times:    []string{"21:00-07:00"},
+	}
+	if _, errors := schedule.verifyAndInit(); len(errors) > 0 {
+		t.Errorf("Could not initialize schedule: %v", errors)
+		return
+	}
+
+	location, _ := time.LoadLocation("America/New_York")
+	data := []struct {
+		at     time.Time
+		active bool
+	}{
+		// sunday night into monday morning
+		{time.Date(2019, time.March, 10, 20, 59, 0, 0, location), false},
+		{time.Date(2019, time.March, 10, 21, 0, 0, 0, location), true},
+		{time.Date(2019, time.March, 11, 6, 59, 0, 0, location), true},
+		{time.Date(2019, time.March, 11, 7, 0, 0, 0, location), false},
+		// friday night is not a school night but thursday night continues into friday morning
+		{time.Date(2019, time.March, 15, 6, 0, 0, 0, location), true},
+		{time.Date(2019, time.March, 15, 22, 0, 0, 0, location), false},
+		{time.Date(2019, time.March, 16, 6, 0, 0, 0, location), false},
+		// the time zone is used to compare times
+		{time.Date(2019, time.March, 12, 1, 30, 0, 0, time.UTC), true},
+		{time.Date(2019, time.March, 12, 12, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, d := range data {
+		if active := schedule.IsActive(d.at); active != d.active {
+			t.Errorf("Expected schedule to be active=%t at %s but got %t", d.active, d.at, active)
+		}
+	}
+}
+
+func TestScheduleVerification(t *testing.T) {
+	data := []struct {
+		schedule *GudgeonSchedule
+		valid    bool
+	}{
+		{&GudgeonSchedule{Name: "all day"}, true},
+		{&GudgeonSchedule{Name: "weekend", Days: []string{"Sat", "Sunday"}}, true},
+		{&GudgeonSchedule{Name: "evening", Times: []string{"18:00-24:00"}}, true},
+		{&GudgeonSchedule{Name: "bad day", Days: []string{"someday"}}, false},
+		{&GudgeonSchedule{Name: "bad time", Times: []string{"25:00-07:00"}}, false},
+		{&GudgeonSchedule{Name: "bad range", Times: []string{"21:00"}}, false},
+		{&GudgeonSchedule{Name: "bad zone", Timezone: "Nowhere/Special"}, false},
+	}
+
+	for _, d := range data {
+		if _, errors := d.schedule.verifyAndInit(); (len(errors) == 0) != d.valid {
+			t.Errorf("Expected schedule '%s' to be valid=%t but got errors: %v", d.schedule.Name, d.valid, errors)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+)
+
+// optional prefix for public key pins (as used by hpkp and most dns-over-tls clients)
+const pinPrefix = "sha256/"
+
+// tls versions by configuration name
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// client authentication types by configuration name
+var tlsClientAuthTypes = map[string]tls.ClientAuthType{
+	"none":           tls.NoClientCert,
+	"request":        tls.RequestClientCert,
+	"require":        tls.RequireAnyClientCert,
+	"verify":         tls.VerifyClientCertIfGiven,
+	"require-verify": tls.RequireAndVerifyClientCert,
+}
+
+// cipher suites by their IANA/go constant name
+var tlsCipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// creates a server-side tls configuration from the (verified) gudgeon tls configuration
+func (gtls *GudgeonTLS) ServerConfig() (*tls.Config, error) {
+	if gtls == nil || !gtls.Enabled {
+		return nil, fmt.Errorf("TLS is not enabled")
+	}
+
+	cert, err := tls.LoadX509KeyPair(gtls.Cert, gtls.Key)
+	if err != nil {
+		return nil, fmt.Errorf("Loading TLS certificate '%s' and key '%s': %s", gtls.Cert, gtls.Key, err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tlsVersions[gtls.MinVersion],
+		MaxVersion:   tlsVersions[gtls.MaxVersion],
+		ClientAuth:   tlsClientAuthTypes[gtls.ClientAuth],
+	}
+
+	// when not set in the configuration go chooses the cipher suites
+	if len(gtls.Ciphers) > 0 {
+		tlsConfig.CipherSuites = make([]uint16, 0, len(gtls.Ciphers))
+		for _, cipher := range gtls.Ciphers {
+			if suite, found := tlsCipherSuites[cipher]; found {
+				tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, suite)
+			}
+		}
+		tlsConfig.PreferServerCipherSuites = true
+	}
+
+	// load client ca pool if given
+	if "" != gtls.ClientCA {
+		pem, err := ioutil.ReadFile(gtls.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("Reading TLS client CA '%s': %s", gtls.ClientCA, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in TLS client CA '%s'", gtls.ClientCA)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// decodes a base64 encoded sha256 public key pin
+func decodePin(pin string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("expected a %d byte sha256 hash but found %d bytes", sha256.Size, len(decoded))
+	}
+	return decoded, nil
+}
+
+// creates a client-side tls configuration that verifies the server certificate against the given
+// server name (a host name or an ip) and, if configured, the certificate authorities and public key pins
+func (stls *GudgeonSourceTLS) ClientConfig(serverName string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: serverName,
+	}
+
+	// nothing else to configure
+	if stls == nil {
+		return tlsConfig, nil
+	}
+
+	if "" != stls.CA {
+		pem, err := ioutil.ReadFile(stls.CA)
+		if err != nil {
+			return nil, fmt.Errorf("Reading TLS CA '%s': %s", stls.CA, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in TLS CA '%s'", stls.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(stls.Pins) > 0 {
+		pins := make(map[string]bool, len(stls.Pins))
+		for _, pin := range stls.Pins {
+			decoded, err := decodePin(pin)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid TLS public key pin '%s': %s", pin, err)
+			}
+			pins[string(decoded)] = true
+		}
+
+		// called after the normal verification of the chain, any certificate in the chain can match a pin
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			for _, rawCert := range rawCerts {
+				cert, err := x509.ParseCertificate(rawCert)
+				if err != nil {
+					continue
+				}
+				hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				if pins[string(hash[:])] {
+					return nil
+				}
+			}
+			return fmt.Errorf("No certificate presented by '%s' matches a configured public key pin", serverName)
+		}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/resolver"
+	"github.com/chrisruffalo/gudgeon/rule"
+)
+
+// find the block response that applies to a domain blocked by the given list, the consumer
+// setting is used first, then the first group (in order) that uses the list, and then the list
+func (engine *engine) blockResponseFor(consumerName string, groups []string, list *config.GudgeonList) (string, int) {
+	if consumer, found := engine.consumerMap[consumerName]; found && consumer.configConsumer != nil && "" != consumer.configConsumer.BlockResponse {
+		return consumer.configConsumer.BlockResponse, consumer.configConsumer.BlockTTL
+	}
+
+	for _, groupName := range groups {
+		group, found := engine.groups[groupName]
+		if !found || group.configGroup == nil || "" == group.configGroup.BlockResponse {
+			continue
+		}
+		for _, groupList := range group.lists {
+			if list != nil && groupList.CanonicalName() == list.CanonicalName() {
+				return group.configGroup.BlockResponse, group.configGroup.BlockTTL
+			}
+		}
+	}
+
+	if list != nil && "" != list.BlockResponse {
+		return list.BlockResponse, list.BlockTTL
+	}
+
+	return config.BlockResponseNXDomain, 0
+}
+
+// create the response to a blocked request
+func blockedResponse(request *dns.Msg, blockResponse string, blockTTL int) *dns.Msg {
+	response := new(dns.Msg)
+	response.SetReply(request)
+
+	switch blockResponse {
+	case "", config.BlockResponseNXDomain:
+		response.Rcode = dns.RcodeNameError
+		return response
+	case config.BlockResponseRefused:
+		response.Rcode = dns.RcodeRefused
+		return response
+	case config.BlockResponseNoData:
+		return response
+	}
+
+	// null and sinkhole responses answer address questions with the configured address
+	ipv4, ipv6 := config.BlockResponseAddresses(blockResponse)
+	if config.BlockResponseNull == blockResponse {
+		ipv4 = net.IPv4zero.To4()
+		ipv6 = net.IPv6zero
+	}
+	if blockTTL < 1 {
+		blockTTL = config.DefaultBlockTTL
+	}
+
+	question := request.Question[0]
+	header := dns.RR_Header{Name: question.Name, Class: dns.ClassINET, Ttl: uint32(blockTTL)}
+	if question.Qtype == dns.TypeA && ipv4 != nil {
+		header.Rrtype = dns.TypeA
+		response.Answer = append(response.Answer, &dns.A{Hdr: header, A: ipv4})
+	} else if question.Qtype == dns.TypeAAAA && ipv6 != nil {
+		header.Rrtype = dns.TypeAAAA
+		response.Answer = append(response.Answer, &dns.AAAA{Hdr: header, AAAA: ipv6})
+	}
+
+	// anything else gets an empty (nodata) response
+	return response
+}
+
+// answer the request as blocked because of something found in the answer (and not the question), while blocking
+// is paused for the consumer or groups the match is only recorded in the result and no response is returned
+func (engine *engine) answerBlockedResponse(groups []string, rCon *resolver.RequestContext, request *dns.Msg, result *resolver.ResolutionResult, list *config.GudgeonList, ruleText string) *dns.Msg {
+	result.MatchList = list
+	result.MatchRule = ruleText
+
+	if engine.pauses.active(rCon.Consumer, groups, requestTime(rCon)) != nil {
+		result.Paused = true
+		return nil
+	}
+
+	result.Match = rule.MatchBlock
+	blockResponse, blockTTL := engine.blockResponseFor(rCon.Consumer, groups, list)
+	return blockedResponse(request, blockResponse, blockTTL)
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+// the A/AAAA addresses in the answer, in the order they appear
+func answerAddresses(response *dns.Msg) []net.IP {
+	addresses := make([]net.IP, 0)
+	if response == nil {
+		return addresses
+	}
+	for _, answer := range response.Answer {
+		switch record := answer.(type) {
+		case *dns.A:
+			addresses = append(addresses, record.A)
+		case *dns.AAAA:
+			addresses = append(addresses, record.AAAA)
+		}
+	}
+	return addresses
+}
+
+// find the first address in the response that is in a block-ip list of the groups (that is active at the given time)
+func (engine *engine) ipBlockForGroups(groups []string, response *dns.Msg, at time.Time) (*config.GudgeonList, string) {
+	engine.storeLock.RLock()
+	defer engine.storeLock.RUnlock()
+
+	if engine.ips == nil || len(groups) < 1 {
+		return nil, ""
+	}
+
+	lists := make([]*config.GudgeonList, 0)
+	for _, g := range groups {
+		if group, found := engine.groups[g]; found {
+			lists = append(lists, group.activeLists(group.ipLists, at)...)
+		}
+	}
+
+	if len(lists) < 1 {
+		return nil, ""
+	}
+
+	for _, address := range answerAddresses(response) {
+		if list, ruleText := engine.ips.FindIP(lists, address); list != nil {
+			return list, ruleText
+		}
+	}
+
+	return nil, ""
+}
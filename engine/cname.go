@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/rule"
+)
+
+// the groups that check the cname targets in answers against their block lists
+func (engine *engine) cnameProtectedGroups(groups []string) []string {
+	protected := make([]string, 0, len(groups))
+	for _, g := range groups {
+		if group, found := engine.groups[g]; found && group.configGroup.CnameProtection {
+			protected = append(protected, g)
+		}
+	}
+	return protected
+}
+
+// the targets of the cname records in the answer, in the order they appear
+func cnameTargets(response *dns.Msg) []string {
+	targets := make([]string, 0)
+	if response == nil {
+		return targets
+	}
+	for _, answer := range response.Answer {
+		if cname, ok := answer.(*dns.CNAME); ok {
+			targets = append(targets, cname.Target)
+		}
+	}
+	return targets
+}
+
+// find the first cname target in the response that matches a block list of the groups, a target that is
+// allowed is not blocked but the targets after it are still checked
+func (engine *engine) cnameBlockForGroups(groups []string, response *dns.Msg, at time.Time) (rule.Match, *config.GudgeonList, string, string) {
+	for _, target := range cnameTargets(response) {
+		if match, list, ruleText := engine.domainRuleMatchedForGroups(groups, target, at); match == rule.MatchBlock {
+			return match, list, ruleText, target
+		}
+	}
+	return rule.MatchNone, nil, "", ""
+}
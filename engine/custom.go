@@ -0,0 +1,348 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// custom rules are loaded into built-in lists named for the rule type and (for rules limited to groups) the group
+const (
+	customListName = "custom"
+	customAllow    = rule.ALLOWSTRING
+	customBlock    = "block"
+)
+
+// an allow or block rule added at runtime, kept in the engine db so that it is loaded again by new engines
+type CustomRule struct {
+	ID   int64
+	Rule string
+	Type string
+	// the groups the rule applies to, every group when empty
+	Groups  []string
+	Created time.Time
+	// when the rule is removed, nil if it never expires
+	Expires *time.Time
+}
+
+// true if the rule has expired at the given time
+func (customRule *CustomRule) expired(at time.Time) bool {
+	return customRule.Expires != nil && !at.Before(*customRule.Expires)
+}
+
+func customListKey(ruleType string, group string) string {
+	if "" == group {
+		return customListName + " " + ruleType
+	}
+	return customListName + " " + ruleType + " " + group
+}
+
+// create the custom allow and block lists for every group and for each of the given groups
+func createCustomLists(groups []string) map[string]*config.GudgeonList {
+	lists := make(map[string]*config.GudgeonList)
+	for _, ruleType := range []string{customAllow, customBlock} {
+		for _, group := range append([]string{""}, groups...) {
+			name := customListKey(ruleType, group)
+			lists[name] = &config.GudgeonList{Name: name, Type: ruleType, Tags: &[]string{}}
+		}
+	}
+	return lists
+}
+
+// the custom lists that apply to the groups, the lists for every group come first
+func (engine *engine) customListsForGroups(groups []string) []*config.GudgeonList {
+	lists := make([]*config.GudgeonList, 0, 2*(len(groups)+1))
+	for _, ruleType := range []string{customAllow, customBlock} {
+		for _, group := range append([]string{""}, groups...) {
+			if list, found := engine.customLists[customListKey(ruleType, group)]; found {
+				lists = append(lists, list)
+			}
+		}
+	}
+	return lists
+}
+
+// the custom lists the rule is loaded into
+func (engine *engine) customRuleLists(customRule *CustomRule) []*config.GudgeonList {
+	if len(customRule.Groups) == 0 {
+		return []*config.GudgeonList{engine.customLists[customListKey(customRule.Type, "")]}
+	}
+	lists := make([]*config.GudgeonList, 0, len(customRule.Groups))
+	for _, group := range customRule.Groups {
+		if list, found := engine.customLists[customListKey(customRule.Type, group)]; found {
+			lists = append(lists, list)
+		}
+	}
+	return lists
+}
+
+// add the rule to the store unless a custom rule before it already put the same rule in the same list (stores that
+// count rules, like the cuckoo store, would otherwise keep it after it is removed), the caller holds the store write lock
+func (engine *engine) storeCustomRule(customRule *CustomRule) {
+	if engine.store == nil {
+		return
+	}
+	before := engine.customRules
+	for idx, other := range engine.customRules {
+		if other == customRule {
+			before = engine.customRules[:idx]
+			break
+		}
+	}
+	for _, list := range engine.customRuleLists(customRule) {
+		if !engine.customRuleShared(customRule, list, before) {
+			engine.store.Add(list, customRule.Rule)
+		}
+	}
+}
+
+// true if one of the other custom rules puts the same rule in the list, the caller holds the store lock
+func (engine *engine) customRuleShared(customRule *CustomRule, list *config.GudgeonList, others []*CustomRule) bool {
+	for _, other := range others {
+		if other == customRule || other.Rule != customRule.Rule {
+			continue
+		}
+		for _, otherList := range engine.customRuleLists(other) {
+			if otherList == list {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// take the rule out of the store unless another custom rule puts the same rule in the same list, the caller holds the store write lock
+func (engine *engine) unstoreCustomRule(customRule *CustomRule) {
+	if engine.store == nil {
+		return
+	}
+	for _, list := range engine.customRuleLists(customRule) {
+		if !engine.customRuleShared(customRule, list, engine.customRules) {
+			engine.store.Remove(list, customRule.Rule)
+		}
+	}
+}
+
+// read the custom rules from the engine db into the store, rules that have expired are deleted
+func (engine *engine) loadCustomRules() error {
+	engine.customRules = make([]*CustomRule, 0)
+	if engine.db == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if _, err := engine.db.Exec("DELETE FROM custom_rules WHERE Expires IS NOT NULL AND Expires <= ?", now); err != nil {
+		return fmt.Errorf("Removing expired custom rules: %s", err)
+	}
+
+	rows, err := engine.db.Query("SELECT Id, Rule, Type, Groups, Created, Expires FROM custom_rules ORDER BY Id ASC")
+	if err != nil {
+		return fmt.Errorf("Reading custom rules: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		customRule := &CustomRule{}
+		var groups string
+		if err := rows.Scan(&customRule.ID, &customRule.Rule, &customRule.Type, &groups, &customRule.Created, &customRule.Expires); err != nil {
+			log.Errorf("Custom rule row scan: %s", err)
+			continue
+		}
+		customRule.Groups = make([]string, 0)
+		for _, group := range strings.Split(groups, ",") {
+			if _, found := engine.groups[group]; found {
+				customRule.Groups = append(customRule.Groups, group)
+			} else if "" != group {
+				log.Warnf("Custom rule '%s' is for group '%s' which is not configured", customRule.Rule, group)
+			}
+		}
+		// a rule that was only for groups that are gone would otherwise apply to every group
+		if "" != groups && len(customRule.Groups) == 0 {
+			continue
+		}
+		engine.customRules = append(engine.customRules, customRule)
+		engine.storeCustomRule(customRule)
+	}
+
+	engine.scheduleCustomExpiry()
+
+	return nil
+}
+
+// read the custom rules from the engine db again in place of the ones that were loaded, an engine that is swapped in for
+// another one (on reload) picks up the rules that were added to or removed from the other engine while it was built
+func (engine *engine) ReloadCustomRules() error {
+	engine.storeLock.Lock()
+	defer engine.storeLock.Unlock()
+
+	// the last rule is taken out first so that a rule shared with a rule before it stays in the store until both are gone
+	for len(engine.customRules) > 0 {
+		last := len(engine.customRules) - 1
+		engine.unstoreCustomRule(engine.customRules[last])
+		engine.customRules = engine.customRules[:last]
+	}
+
+	return engine.loadCustomRules()
+}
+
+// set the timer for the next custom rule that expires, the caller holds the store write lock
+func (engine *engine) scheduleCustomExpiry() {
+	if engine.customTimer != nil {
+		engine.customTimer.Stop()
+		engine.customTimer = nil
+	}
+
+	var next *time.Time
+	for _, customRule := range engine.customRules {
+		if customRule.Expires != nil && (next == nil || customRule.Expires.Before(*next)) {
+			next = customRule.Expires
+		}
+	}
+	if next != nil {
+		engine.customTimer = time.AfterFunc(time.Until(*next), engine.expireCustomRules)
+	}
+}
+
+// remove the custom rules that have expired
+func (engine *engine) expireCustomRules() {
+	engine.storeLock.Lock()
+	defer engine.storeLock.Unlock()
+
+	// stopped by shutdown
+	if engine.customTimer == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, customRule := range append([]*CustomRule{}, engine.customRules...) {
+		if customRule.expired(now) {
+			engine.removeCustomRule(customRule)
+		}
+	}
+	engine.scheduleCustomExpiry()
+}
+
+// remove the rule from the db, the store, and the engine, the caller holds the store write lock
+func (engine *engine) removeCustomRule(customRule *CustomRule) {
+	if engine.db != nil {
+		if _, err := engine.db.Exec("DELETE FROM custom_rules WHERE Id = ?", customRule.ID); err != nil {
+			log.Errorf("Could not delete custom rule: %s", err)
+		}
+	}
+
+	engine.unstoreCustomRule(customRule)
+	for idx, other := range engine.customRules {
+		if other == customRule {
+			engine.customRules = append(engine.customRules[:idx], engine.customRules[idx+1:]...)
+			break
+		}
+	}
+}
+
+// add an allow or block rule for the groups (every group when none are given) that lasts for the duration, or until it is removed when the duration is zero
+func (engine *engine) AddCustomRule(ruleText string, ruleType string, groups []string, duration time.Duration) (*CustomRule, error) {
+	if engine.db == nil {
+		return nil, fmt.Errorf("Custom rules can't be saved without the engine database")
+	}
+
+	listRule := rule.ParseListLine(ruleText)
+	if listRule == nil || listRule.Unsupported || listRule.BadFilter || listRule.Exception || listRule.Important {
+		return nil, fmt.Errorf("'%s' is not a rule that can be added", ruleText)
+	}
+
+	ruleType = strings.ToLower(ruleType)
+	if "" == ruleType {
+		ruleType = customBlock
+	}
+	if ruleType != customAllow && ruleType != customBlock {
+		return nil, fmt.Errorf("A custom rule must be an allow or block rule, not '%s'", ruleType)
+	}
+
+	if duration < 0 {
+		return nil, fmt.Errorf("A custom rule can't have a negative duration")
+	}
+
+	ruleGroups := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if "" == group || util.StringIn(group, ruleGroups) {
+			continue
+		}
+		if _, found := engine.groups[group]; !found {
+			return nil, fmt.Errorf("No group named '%s' was found", group)
+		}
+		ruleGroups = append(ruleGroups, group)
+	}
+
+	customRule := &CustomRule{
+		Rule:    strings.ToLower(listRule.Text),
+		Type:    ruleType,
+		Groups:  ruleGroups,
+		Created: time.Now(),
+	}
+	if duration > 0 {
+		expires := customRule.Created.Add(duration)
+		customRule.Expires = &expires
+	}
+
+	engine.storeLock.Lock()
+	defer engine.storeLock.Unlock()
+
+	result, err := engine.db.Exec("INSERT INTO custom_rules (Rule, Type, Groups, Created, Expires) VALUES (?, ?, ?, ?, ?)", customRule.Rule, customRule.Type, strings.Join(customRule.Groups, ","), customRule.Created, customRule.Expires)
+	if err != nil {
+		return nil, fmt.Errorf("Could not save custom rule: %s", err)
+	}
+	if customRule.ID, err = result.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("Could not save custom rule: %s", err)
+	}
+
+	engine.customRules = append(engine.customRules, customRule)
+	engine.storeCustomRule(customRule)
+	if customRule.Expires != nil {
+		engine.scheduleCustomExpiry()
+	}
+
+	copied := *customRule
+	return &copied, nil
+}
+
+// copies of the custom rules that have not expired, in the order they were added
+func (engine *engine) CustomRules() []*CustomRule {
+	engine.storeLock.RLock()
+	defer engine.storeLock.RUnlock()
+
+	now := time.Now()
+	customRules := make([]*CustomRule, 0, len(engine.customRules))
+	for _, customRule := range engine.customRules {
+		if !customRule.expired(now) {
+			copied := *customRule
+			customRules = append(customRules, &copied)
+		}
+	}
+	sort.Slice(customRules, func(i, j int) bool {
+		return customRules[i].ID < customRules[j].ID
+	})
+
+	return customRules
+}
+
+// remove the custom rule with the given id, false if there is no such rule
+func (engine *engine) RemoveCustomRule(id int64) bool {
+	engine.storeLock.Lock()
+	defer engine.storeLock.Unlock()
+
+	for _, customRule := range engine.customRules {
+		if customRule.ID == id {
+			engine.removeCustomRule(customRule)
+			engine.scheduleCustomExpiry()
+			return true
+		}
+	}
+	return false
+}
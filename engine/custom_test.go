@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestCustomRules(t *testing.T) {
+	config := testutil.Conf(t, "testdata/custom.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer func() {
+		testEngine.Shutdown()
+	}()
+
+	check := func(ip string, domain string, expected rule.Match) {
+		if match, _, _ := testEngine.IsDomainRuleMatched(parseIP(ip), domain); match != expected {
+			t.Errorf("Expected %s to have match %d for %s but got %d", domain, expected, ip, match)
+		}
+	}
+
+	// invalid rules
+	if _, err := testEngine.AddCustomRule("", "block", nil, 0); err == nil {
+		t.Errorf("Expected error adding an empty rule")
+	}
+	if _, err := testEngine.AddCustomRule("custom.com", "rewrite", nil, 0); err == nil {
+		t.Errorf("Expected error adding a rule with an unknown type")
+	}
+	if _, err := testEngine.AddCustomRule("custom.com", "block", []string{"nogroup"}, 0); err == nil {
+		t.Errorf("Expected error adding a rule for an unknown group")
+	}
+
+	// a rule for every group and a rule for one group
+	everyone, err := testEngine.AddCustomRule("custom.com", "", nil, 0)
+	if err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+		return
+	}
+	if _, err := testEngine.AddCustomRule("||games.com^", "block", []string{"kids"}, 0); err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+	}
+	if _, err := testEngine.AddCustomRule("one.blocked.com", "allow", []string{"kids"}, 0); err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+	}
+	check("192.168.0.1", "www.custom.com", rule.MatchBlock)
+	check("10.0.0.1", "custom.com", rule.MatchBlock)
+	check("192.168.0.1", "games.com", rule.MatchNone)
+	check("10.0.0.1", "games.com", rule.MatchBlock)
+	check("192.168.0.1", "one.blocked.com", rule.MatchBlock)
+	check("10.0.0.1", "one.blocked.com", rule.MatchAllow)
+
+	// a rule that expires
+	if _, err := testEngine.AddCustomRule("brief.com", "block", nil, 200*time.Millisecond); err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+	}
+	check("192.168.0.1", "brief.com", rule.MatchBlock)
+	if len(testEngine.CustomRules()) != 4 {
+		t.Errorf("Expected 4 custom rules but found %d", len(testEngine.CustomRules()))
+	}
+	time.Sleep(400 * time.Millisecond)
+	check("192.168.0.1", "brief.com", rule.MatchNone)
+	if len(testEngine.CustomRules()) != 3 {
+		t.Errorf("Expected 3 custom rules after one expired but found %d", len(testEngine.CustomRules()))
+	}
+
+	// rules are kept when the lists are rebuilt
+	testEngine.(*engine).refresher.rebuild()
+	check("10.0.0.1", "games.com", rule.MatchBlock)
+
+	// removed rules no longer match
+	if !testEngine.RemoveCustomRule(everyone.ID) {
+		t.Errorf("Expected to remove custom rule")
+	}
+	if testEngine.RemoveCustomRule(everyone.ID) {
+		t.Errorf("Expected custom rule to already be removed")
+	}
+	check("192.168.0.1", "custom.com", rule.MatchNone)
+
+	// rules are saved for the next engine
+	testEngine.Shutdown()
+	testEngine, err = NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create second engine: %s", err)
+		return
+	}
+	if len(testEngine.CustomRules()) != 2 {
+		t.Errorf("Expected 2 custom rules in the second engine but found %d", len(testEngine.CustomRules()))
+	}
+	check("10.0.0.1", "games.com", rule.MatchBlock)
+	check("10.0.0.1", "one.blocked.com", rule.MatchAllow)
+	check("192.168.0.1", "custom.com", rule.MatchNone)
+}
+
+func TestSharedCustomRulesInCuckooStore(t *testing.T) {
+	config := testutil.Conf(t, "testdata/custom.yml")
+	defer os.RemoveAll(config.Home)
+	// the cuckoo store keeps a rule that is added twice until it is removed twice
+	config.Storage.RuleStorage = "cuckoo"
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	check := func(step string, expected rule.Match) {
+		if match, _, _ := testEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), "same.com"); match != expected {
+			t.Errorf("After %s expected same.com to have match %d but got %d", step, expected, match)
+		}
+	}
+
+	first, err := testEngine.AddCustomRule("same.com", "block", nil, 0)
+	if err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+		return
+	}
+	second, err := testEngine.AddCustomRule("same.com", "block", nil, 0)
+	if err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+		return
+	}
+	testEngine.(*engine).refresher.rebuild()
+
+	testEngine.RemoveCustomRule(first.ID)
+	check("removing one of the rules", rule.MatchBlock)
+	testEngine.RemoveCustomRule(second.ID)
+	check("removing both rules", rule.MatchNone)
+}
+
+func TestCustomRulesReload(t *testing.T) {
+	config := testutil.Conf(t, "testdata/custom.yml")
+	defer os.RemoveAll(config.Home)
+
+	oldEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	kept, err := oldEngine.AddCustomRule("kept.com", "block", nil, 0)
+	if err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+	}
+
+	// the new engine reads the custom rules while the old one is still in use
+	newEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer newEngine.Shutdown()
+	if _, err := oldEngine.AddCustomRule("added.com", "block", nil, 0); err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+	}
+	if kept != nil && !oldEngine.RemoveCustomRule(kept.ID) {
+		t.Errorf("Expected custom rule to be removed")
+	}
+	oldEngine.Shutdown()
+
+	// the changes made to the old engine are picked up when the new engine is swapped in
+	if err := newEngine.ReloadCustomRules(); err != nil {
+		t.Errorf("Could not reload custom rules: %s", err)
+	}
+	if match, _, _ := newEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), "added.com"); match != rule.MatchBlock {
+		t.Errorf("Expected the rule added to the old engine to block the domain")
+	}
+	if match, _, _ := newEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), "kept.com"); match != rule.MatchNone {
+		t.Errorf("Expected the rule removed from the old engine to be gone")
+	}
+	if customRules := newEngine.CustomRules(); len(customRules) != 1 || customRules[0].Rule != "added.com" {
+		t.Errorf("Expected only the added custom rule after the reload")
+	}
+}
@@ -1,8 +1,14 @@
 package engine
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
@@ -11,46 +17,78 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/ulikunitz/xz"
 
 	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/util"
 )
 
-func downloadFile(engine Engine, path string, url string) error {
-	// don't do anything with empty url
-	if url == "" {
-		return nil
-	}
+const (
+	// the files kept next to the cached list, the download is only moved over the cached list after it is checked
+	downloadSuffix = "_download"
+	inactiveSuffix = "_inactive"
+	metaSuffix     = ".meta"
+	previousSuffix = "_previous"
 
-	dirpart := paths.Dir(path)
-	if _, err := os.Stat(dirpart); os.IsNotExist(err) {
-		os.MkdirAll(dirpart, os.ModePerm)
-	}
+	megabyte = 1024 * 1024
+)
 
-	// if the file exists already then it might be used during the
-	// download process so we need to move it
-	if _, err := os.Stat(path); err == nil {
-		// download file to temp location
-		inactivePath := path + "_inactive"
-		err = downloadFile(engine, inactivePath, url)
-		if err != nil {
-			return err
-		}
+// the time to wait before the first retry, it doubles with each retry after that
+var downloadBackoff = 2 * time.Second
 
-		// move file over existing file when done
-		os.Rename(inactivePath, path)
+// the magic numbers at the start of compressed downloads
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte{'P', 'K', 0x03, 0x04}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// the http caching headers of the cached copy of a list, used to ask for the list only if it has changed
+type downloadMeta struct {
+	ETag         string `json:"etag"`
+	LastModified string `json:"lastModified"`
+}
+
+// an error that is worth trying the download again for (like a connection error or a server error)
+type retryableError struct {
+	err error
+}
 
-		// complete action
+func (retryable *retryableError) Error() string {
+	return retryable.err.Error()
+}
+
+func readMeta(path string) *downloadMeta {
+	data, err := ioutil.ReadFile(path + metaSuffix)
+	if err != nil {
+		return nil
+	}
+	meta := &downloadMeta{}
+	if err := json.Unmarshal(data, meta); err != nil {
 		return nil
 	}
+	return meta
+}
 
-	out, err := os.Create(path)
+func writeMeta(path string, meta *downloadMeta) {
+	if meta == nil || ("" == meta.ETag && "" == meta.LastModified) {
+		os.Remove(path + metaSuffix)
+		return
+	}
+	data, err := json.Marshal(meta)
+	if err == nil {
+		err = ioutil.WriteFile(path+metaSuffix, data, 0644)
+	}
 	if err != nil {
-		return err
+		log.Warnf("Could not save download details for '%s': %s", path, err)
 	}
-	defer out.Close()
+}
 
+// create the http client used for downloads, the engine (if given) resolves the host names
+func downloadClient(engine Engine, timeout time.Duration) *http.Client {
 	// set up http client
-	client := &http.Client{}
+	client := &http.Client{Timeout: timeout}
 
 	// if we can't resolve the url normally we might need to use the configured resolvers to find it... eek
 	if engine != nil {
@@ -83,33 +121,255 @@ func downloadFile(engine Engine, path string, url string) error {
 		client.Transport = tr
 	}
 
-	resp, err := client.Get(url)
+	return client
+}
+
+// get the url into the download file, returns nil meta (and no error) if the cached copy has not changed
+func fetch(client *http.Client, url string, downloadPath string, cached *downloadMeta, maxSize int64) (*downloadMeta, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if cached != nil {
+		if "" != cached.ETag {
+			request.Header.Set("If-None-Match", cached.ETag)
+		}
+		if "" != cached.LastModified {
+			request.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, &retryableError{err}
 	}
 	defer resp.Body.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return nil, nil
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &retryableError{fmt.Errorf("server responded with %s", resp.Status)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("server responded with %s", resp.Status)
+	}
+
+	out, err := os.Create(downloadPath)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	// read one byte more than the limit to know if the limit was passed
+	written, err := io.Copy(out, io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, &retryableError{err}
+	}
+	if written > maxSize {
+		return nil, fmt.Errorf("download is larger than %d MB", maxSize/megabyte)
+	}
+
+	return &downloadMeta{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}, nil
+}
+
+// copy the reader into the file without going past the size limit
+func copyLimited(out io.Writer, in io.Reader, maxSize int64) (int64, error) {
+	written, err := io.Copy(out, io.LimitReader(in, maxSize+1))
+	if err != nil {
+		return written, err
+	}
+	if written > maxSize {
+		return written, fmt.Errorf("decompressed list is larger than %d MB", maxSize/megabyte)
+	}
+	return written, nil
+}
+
+// decompress a gzip, zip (all of the files in it), or xz download into the output path, other downloads are moved there as they are
+func decompress(downloadPath string, outputPath string, maxSize int64) error {
+	in, err := os.Open(downloadPath)
 	if err != nil {
 		return err
 	}
+	defer in.Close()
+
+	header, _ := bufio.NewReader(in).Peek(len(xzMagic))
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		gzipReader, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case bytes.HasPrefix(header, xzMagic):
+		if reader, err = xz.NewReader(in); err != nil {
+			return err
+		}
+	case bytes.HasPrefix(header, zipMagic):
+		// handled below, zip files need random access
+	default:
+		in.Close()
+		return os.Rename(downloadPath, outputPath)
+	}
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if reader != nil {
+		_, err = copyLimited(out, reader, maxSize)
+		return err
+	}
+
+	archive, err := zip.OpenReader(downloadPath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	remaining := maxSize
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		contents, err := file.Open()
+		if err != nil {
+			return err
+		}
+		written, err := copyLimited(out, contents, remaining)
+		contents.Close()
+		if err != nil {
+			return err
+		}
+		// keep the last line of one file from running into the first line of the next
+		out.Write([]byte("\n"))
+		remaining -= written
+	}
 
 	return nil
 }
 
-func Download(engine Engine, config *config.GudgeonConfig, list *config.GudgeonList) error {
-	// create on-disk name of list
-	path := config.PathToList(list)
+// check that the new copy of the list has enough rules and (if the list is already cached) has not lost too many
+func checkDownload(list *config.GudgeonList, newPath string, cachedPath string, minRules int, maxDrop int) error {
+	count, err := rule.CountRules(list, newPath)
+	if err != nil {
+		return err
+	}
+	if count < uint64(minRules) {
+		return fmt.Errorf("download has %d rules but at least %d are required", count, minRules)
+	}
+
+	if maxDrop <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(cachedPath); err != nil {
+		return nil
+	}
+	cachedCount, err := rule.CountRules(list, cachedPath)
+	if err != nil || cachedCount == 0 || count >= cachedCount {
+		return nil
+	}
+	if drop := (cachedCount - count) * 100 / cachedCount; drop > uint64(maxDrop) {
+		return fmt.Errorf("download has %d rules, %d%% fewer than the %d rules in the cached copy (the most allowed is %d%%)", count, drop, cachedCount, maxDrop)
+	}
+
+	return nil
+}
 
-	// get rul of list
+// download the list and replace the cached copy if the download is good, false is returned when the
+// cached copy is kept because the list has not changed (or is not remote)
+func download(engine Engine, conf *config.GudgeonConfig, list *config.GudgeonList) (bool, error) {
+	// don't do anything with empty url
 	url := list.Source
+	if url == "" {
+		return false, nil
+	}
 
-	// get written lines
-	log.Infof("Downloading '%s'...", url)
-	err := downloadFile(engine, path, url)
+	// create on-disk name of list
+	path := conf.PathToList(list)
+	dirpart := paths.Dir(path)
+	if _, err := os.Stat(dirpart); os.IsNotExist(err) {
+		os.MkdirAll(dirpart, os.ModePerm)
+	}
+
+	downloadPath := path + downloadSuffix
+	inactivePath := path + inactiveSuffix
+	defer os.Remove(downloadPath)
+	defer os.Remove(inactivePath)
+
+	// download settings
+	settings := conf.Download
+	if settings == nil {
+		settings = &config.GudgeonDownload{}
+	}
+	timeout, err := util.ParseDuration(settings.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	retries := 0
+	if settings.Retries != nil {
+		retries = *settings.Retries
+	}
+	maxSize := int64(settings.MaxSize) * megabyte
+	if maxSize <= 0 {
+		maxSize = 256 * megabyte
+	}
+	minRules, maxDrop := conf.DownloadLimits(list)
+
+	// only ask for the list if it changed when there is a cached copy
+	var cached *downloadMeta
+	if _, err := os.Stat(path); err == nil {
+		cached = readMeta(path)
+	}
+
+	client := downloadClient(engine, timeout)
+	var meta *downloadMeta
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			wait := downloadBackoff << uint(attempt-1)
+			log.Warnf("Could not download '%s' (%s), trying again in %s", url, err, wait)
+			time.Sleep(wait)
+		}
+		meta, err = fetch(client, url, downloadPath, cached, maxSize)
+		if _, retry := err.(*retryableError); !retry {
+			break
+		}
+	}
 	if err != nil {
-		return err
+		return false, err
+	}
+	if meta == nil {
+		log.Infof("List '%s' has not changed", list.CanonicalName())
+		return false, nil
 	}
 
-	return nil
+	if err := decompress(downloadPath, inactivePath, maxSize); err != nil {
+		return false, err
+	}
+	if err := checkDownload(list, inactivePath, path, minRules, maxDrop); err != nil {
+		return false, fmt.Errorf("rejected download of list '%s': %s", list.CanonicalName(), err)
+	}
+
+	// move file over existing file when done
+	if err := os.Rename(inactivePath, path); err != nil {
+		return false, err
+	}
+	writeMeta(path, meta)
+
+	return true, nil
+}
+
+func Download(engine Engine, config *config.GudgeonConfig, list *config.GudgeonList) error {
+	// get written lines
+	log.Infof("Downloading '%s'...", list.Source)
+	_, err := download(engine, config, list)
+	return err
 }
@@ -1,13 +1,29 @@
 package engine
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/ulikunitz/xz"
 
 	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/testutil"
 )
 
+func init() {
+	// keep retries from slowing down tests
+	downloadBackoff = time.Millisecond
+}
+
 // shortcut method that downloads all lists
 func downloadAll(t *testing.T, config *config.GudgeonConfig) error {
 	// go through lists
@@ -82,3 +98,182 @@ func TestBadDownloadUrl(t *testing.T) {
 		t.Errorf("Got error during download: %s", err)
 	}
 }
+
+// a list server that fails a given number of times before serving the body with an etag
+type listServer struct {
+	lock     sync.Mutex
+	body     []byte
+	etag     string
+	failures int
+	status   int
+	requests int
+}
+
+func (server *listServer) set(body []byte, etag string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.body, server.etag = body, etag
+}
+
+func (server *listServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.requests++
+	if server.failures > 0 {
+		server.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if server.status != 0 {
+		w.WriteHeader(server.status)
+		return
+	}
+	if "" != server.etag {
+		if r.Header.Get("If-None-Match") == server.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", server.etag)
+	}
+	w.Write(server.body)
+}
+
+func gzipList(t *testing.T, text string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	writer.Write([]byte(text))
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Could not gzip list: %s", err)
+	}
+	return buffer.Bytes()
+}
+
+func xzList(t *testing.T, text string) []byte {
+	var buffer bytes.Buffer
+	writer, err := xz.NewWriter(&buffer)
+	if err != nil {
+		t.Fatalf("Could not create xz writer: %s", err)
+	}
+	writer.Write([]byte(text))
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Could not xz list: %s", err)
+	}
+	return buffer.Bytes()
+}
+
+func zipList(t *testing.T, files ...string) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for idx, text := range files {
+		file, err := writer.Create(string('a'+rune(idx)) + ".txt")
+		if err != nil {
+			t.Fatalf("Could not add file to zip: %s", err)
+		}
+		file.Write([]byte(text))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Could not zip list: %s", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestDownloadChecks(t *testing.T) {
+	server := &listServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	conf := testutil.Conf(t, "testdata/refresh.yml")
+	defer os.RemoveAll(conf.Home)
+	list := conf.Lists[0]
+	list.Source = httpServer.URL + "/ads.list"
+	path := conf.PathToList(list)
+
+	expectList := func(expected string) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Errorf("Could not read downloaded list: %s", err)
+			return
+		}
+		if string(data) != expected {
+			t.Errorf("Expected downloaded list '%s' but got '%s'", expected, string(data))
+		}
+	}
+
+	// errors are not saved as the list
+	server.status = http.StatusNotFound
+	if _, err := download(nil, conf, list); err == nil {
+		t.Errorf("Expected an error for a missing list")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected no list to be saved for a missing list")
+	}
+	server.status = 0
+	server.requests = 0
+
+	// server errors are retried
+	server.set([]byte("ads.com\ntracker.com\n"), "v1")
+	server.failures = 2
+	if changed, err := download(nil, conf, list); err != nil || !changed {
+		t.Errorf("Expected download to succeed after retries but got changed=%t err=%v", changed, err)
+	}
+	expectList("ads.com\ntracker.com\n")
+	if server.requests != 3 {
+		t.Errorf("Expected 3 requests but got %d", server.requests)
+	}
+
+	// the list is only downloaded again if it changed
+	if changed, err := download(nil, conf, list); err != nil || changed {
+		t.Errorf("Expected an unchanged list but got changed=%t err=%v", changed, err)
+	}
+	expectList("ads.com\ntracker.com\n")
+
+	// compressed lists
+	server.set(gzipList(t, "gzip.com\n"), "v2")
+	if _, err := download(nil, conf, list); err != nil {
+		t.Errorf("Could not download gzip list: %s", err)
+	}
+	expectList("gzip.com\n")
+	server.set(xzList(t, "xz.com\n"), "v3")
+	if _, err := download(nil, conf, list); err != nil {
+		t.Errorf("Could not download xz list: %s", err)
+	}
+	expectList("xz.com\n")
+	server.set(zipList(t, "one.com\ntwo.com", "three.com\n"), "")
+	if _, err := download(nil, conf, list); err != nil {
+		t.Errorf("Could not download zip list: %s", err)
+	}
+	expectList("one.com\ntwo.com\nthree.com\n\n")
+
+	// a list without rules is rejected and the cached copy is kept
+	server.set([]byte("# no rules\n\n! just comments\n"), "")
+	if _, err := download(nil, conf, list); err == nil {
+		t.Errorf("Expected a list without rules to be rejected")
+	}
+	expectList("one.com\ntwo.com\nthree.com\n\n")
+
+	// a list that loses too many rules is rejected
+	maxDrop := 50
+	list.MaxDrop = &maxDrop
+	server.set([]byte("one.com\n"), "")
+	if _, err := download(nil, conf, list); err == nil {
+		t.Errorf("Expected a list that dropped too many rules to be rejected")
+	}
+	server.set([]byte("one.com\ntwo.com\n"), "")
+	if _, err := download(nil, conf, list); err != nil {
+		t.Errorf("Expected a list that dropped fewer rules to be downloaded: %s", err)
+	}
+	expectList("one.com\ntwo.com\n")
+
+	// lists over the size limit are rejected, even when they are compressed
+	conf.Download.MaxSize = 1
+	large := strings.Repeat("large.com\n", 200000)
+	server.set([]byte(large), "")
+	if _, err := download(nil, conf, list); err == nil {
+		t.Errorf("Expected a list over the size limit to be rejected")
+	}
+	server.set(gzipList(t, large), "")
+	if _, err := download(nil, conf, list); err == nil {
+		t.Errorf("Expected a compressed list over the size limit to be rejected")
+	}
+	expectList("one.com\ntwo.com\n")
+}
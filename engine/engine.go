@@ -5,8 +5,11 @@ import (
 	"database/sql"
 	"fmt"
 	"net"
+	"os"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 	log "github.com/sirupsen/logrus"
@@ -36,6 +39,41 @@ type group struct {
 	configGroup *config.GudgeonGroup
 
 	lists []*config.GudgeonList
+
+	// lists that rewrite answers instead of allowing/blocking them
+	rewriteLists []*config.GudgeonList
+
+	// lists of addresses that block answers containing them
+	ipLists []*config.GudgeonList
+
+	// response policy zones with query name and answer address triggers
+	rpzLists []*config.GudgeonList
+
+	// schedules that limit when lists apply, by list name
+	listSchedules map[string]*config.GudgeonSchedule
+}
+
+// the lists that are active at the given time
+func (group *group) activeLists(lists []*config.GudgeonList, at time.Time) []*config.GudgeonList {
+	if len(group.listSchedules) == 0 {
+		return lists
+	}
+
+	active := make([]*config.GudgeonList, 0, len(lists))
+	for _, list := range lists {
+		if schedule, found := group.listSchedules[list.CanonicalName()]; !found || schedule.IsActive(at) {
+			active = append(active, list)
+		}
+	}
+	return active
+}
+
+// the time a request is evaluated at
+func requestTime(rCon *resolver.RequestContext) time.Time {
+	if rCon == nil || rCon.Time.IsZero() {
+		return time.Now()
+	}
+	return rCon.Time
 }
 
 // represents a parsed "consumer" type that
@@ -50,6 +88,9 @@ type consumer struct {
 	// list of parsed groups that belong to this consumer
 	groupNames []string
 
+	// schedules that limit when groups apply, by group name
+	groupSchedules map[string]*config.GudgeonSchedule
+
 	// list of parsed resolvers that belong to this consumer
 	resolverNames []string
 
@@ -66,6 +107,9 @@ type engine struct {
 	// database for long term data storage
 	db *sql.DB
 
+	// the same database when query data (the query log and metrics) is persisted, nil otherwise
+	queryDB *sql.DB
+
 	// metrics instance for engine
 	metrics Metrics
 
@@ -89,9 +133,39 @@ type engine struct {
 	// the default group (used to ensure we have one)
 	defaultGroup *group
 
+	// guards the stores built from lists, they are replaced when lists are refreshed
+	storeLock sync.RWMutex
+	// the directory the rule store was built in
+	storeRoot string
+	// the cached copies of the lists (by name) that the stores were built from
+	listFiles map[string]os.FileInfo
+	// refreshes remote lists and rebuilds the stores
+	refresher *listRefresher
+
 	// the backing store for block/allow rules
 	store rule.RuleStore
 
+	// rules added at runtime, they are loaded into the custom lists (by name) of every store
+	customLists map[string]*config.GudgeonList
+	customRules []*CustomRule
+	// removes custom rules when they expire
+	customTimer *time.Timer
+
+	// the rewrites from rewrite lists
+	rewrites *rule.RewriteStore
+
+	// the addresses and networks from block-ip lists
+	ips *rule.IPStore
+
+	// the triggers and actions from rpz lists
+	rpz *rule.RPZStore
+
+	// rebind protection (with the exempt domains and resolvers)
+	rebind *rebindProtection
+
+	// active pauses of blocking
+	pauses *pauseList
+
 	// the resolution structure
 	resolvers resolver.ResolverMap
 
@@ -119,6 +193,21 @@ type Engine interface {
 	HandleWithGroups(groups []string, rCon *resolver.RequestContext, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult)
 	HandleWithResolvers(resolvers []string, rCon *resolver.RequestContext, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult)
 
+	// pause blocking
+	Pause(consumer string, group string, duration time.Duration) (*Pause, error)
+	Pauses() []*Pause
+	CancelPause(id string) bool
+	KeepPauses(from Engine)
+
+	// custom allow/block rules
+	AddCustomRule(ruleText string, ruleType string, groups []string, duration time.Duration) (*CustomRule, error)
+	CustomRules() []*CustomRule
+	RemoveCustomRule(id int64) bool
+	ReloadCustomRules() error
+
+	// explain which allow/block rules match a domain
+	Explain(consumerName string, domain string) *Explanation
+
 	// stats
 	CacheSize() int64
 
@@ -179,13 +268,26 @@ func (engine *engine) getConsumerForIP(consumerIP *net.IP) *consumer {
 
 func (engine *engine) getConsumerGroups(consumerIP *net.IP) []string {
 	consumer := engine.getConsumerForIP(consumerIP)
-	return engine.getGroups(consumer)
+	return engine.getGroups(consumer, time.Now())
 }
 
-func (engine *engine) getGroups(consumer *consumer) []string {
+// the groups of the consumer that are active at the given time
+func (engine *engine) getGroups(consumer *consumer, at time.Time) []string {
 	// return found consumer data if something was found
 	if consumer != nil && len(consumer.groupNames) > 0 {
-		return consumer.groupNames
+		if len(consumer.groupSchedules) == 0 {
+			return consumer.groupNames
+		}
+
+		groupNames := make([]string, 0, len(consumer.groupNames))
+		for _, groupName := range consumer.groupNames {
+			if schedule, found := consumer.groupSchedules[groupName]; !found || schedule.IsActive(at) {
+				groupNames = append(groupNames, groupName)
+			}
+		}
+		if len(groupNames) > 0 {
+			return groupNames
+		}
 	}
 
 	// return the default group in the event nothing else is available
@@ -211,7 +313,7 @@ func (engine *engine) getResolvers(consumer *consumer) []string {
 func (engine *engine) IsDomainRuleMatched(consumerIp *net.IP, domain string) (rule.Match, *config.GudgeonList, string) {
 	// get consumer
 	consumer := engine.getConsumerForIP(consumerIp)
-	return engine.domainRuleMatchedForConsumer(consumer, domain)
+	return engine.domainRuleMatchedForConsumer(consumer, domain, time.Now())
 }
 
 func (engine *engine) domainRuleMatchForLists(lists []*config.GudgeonList, domain string) (rule.Match, *config.GudgeonList, string) {
@@ -220,6 +322,9 @@ func (engine *engine) domainRuleMatchForLists(lists []*config.GudgeonList, domai
 		domain = domain[:len(domain)-1]
 	}
 
+	engine.storeLock.RLock()
+	defer engine.storeLock.RUnlock()
+
 	// sometimes (in testing, downloading) the store mechanism is nil/unloaded
 	if engine.store == nil {
 		return rule.MatchNone, nil, ""
@@ -234,37 +339,40 @@ func (engine *engine) domainRuleMatchForLists(lists []*config.GudgeonList, domai
 	return engine.store.FindMatch(lists, domain)
 }
 
-func (engine *engine) domainRuleMatchedForConsumer(consumer *consumer, domain string) (rule.Match, *config.GudgeonList, string) {
+func (engine *engine) domainRuleMatchedForConsumer(consumer *consumer, domain string, at time.Time) (rule.Match, *config.GudgeonList, string) {
 	if consumer == nil {
 		return rule.MatchNone, nil, ""
 	}
-	return engine.domainRuleMatchForLists(consumer.lists, domain)
+	return engine.domainRuleMatchedForGroups(engine.getGroups(consumer, at), domain, at)
 }
 
-func (engine *engine) domainRuleMatchedForGroups(groups []string, domain string) (rule.Match, *config.GudgeonList, string) {
+func (engine *engine) domainRuleMatchedForGroups(groups []string, domain string, at time.Time) (rule.Match, *config.GudgeonList, string) {
 	if len(groups) < 1 {
 		return rule.MatchNone, nil, ""
 	}
 
-	// select all lists from found groups
-	lists := make([]*config.GudgeonList, 0)
-	for _, g := range groups {
-		if group, found := engine.groups[g]; found {
-			lists = append(lists, group.lists...)
+	// lists with a higher priority are checked first and a match in them wins over any list with a lower priority,
+	// with the same priority allow lists win over block lists
+	for _, lists := range priorityTiers(engine.domainListsForGroups(groups, at)) {
+		if match, list, ruleText := engine.domainRuleMatchForLists(lists, domain); match != rule.MatchNone {
+			return match, list, ruleText
 		}
 	}
 
-	return engine.domainRuleMatchForLists(lists, domain)
+	return rule.MatchNone, nil, ""
 }
 
-// handles recursive resolution of cnames
-func (engine *engine) handleCnameResolution(resolvers []string, rCon *resolver.RequestContext, originalRequest *dns.Msg, originalResponse *dns.Msg) *dns.Msg {
+// handles recursive resolution of cnames, the result of resolving the cname target is returned with the response
+func (engine *engine) handleCnameResolution(resolvers []string, rCon *resolver.RequestContext, originalRequest *dns.Msg, originalResponse *dns.Msg) (*dns.Msg, *resolver.ResolutionResult) {
 	// scope provided finding response
-	var response *dns.Msg
+	var (
+		response    *dns.Msg
+		cnameResult *resolver.ResolutionResult
+	)
 
 	// guard
 	if originalResponse == nil || len(originalResponse.Answer) < 1 || originalRequest == nil || len(originalRequest.Question) < 1 {
-		return nil
+		return nil, nil
 	}
 
 	// if the (first) response is a CNAME then repeat the question but with the cname instead
@@ -276,9 +384,13 @@ func (engine *engine) handleCnameResolution(resolvers []string, rCon *resolver.R
 
 		var cnameResponse *dns.Msg
 		if len(rCon.Groups) > 0 {
-			cnameResponse, _, _ = engine.HandleWithGroups(rCon.Groups, rCon, cnameRequest)
+			cnameResponse, _, cnameResult = engine.HandleWithGroups(rCon.Groups, rCon, cnameRequest)
 		} else {
-			cnameResponse, _, _ = engine.HandleWithResolvers(resolvers, rCon, cnameRequest)
+			cnameResponse, _, cnameResult = engine.HandleWithResolvers(resolvers, rCon, cnameRequest)
+		}
+		// for the original request a block of the target itself is a block of a cname target
+		if cnameResult != nil && cnameResult.Match == rule.MatchBlock && "" == cnameResult.MatchCname {
+			cnameResult.MatchCname = newName
 		}
 		if cnameResponse != nil && !util.IsEmptyResponse(cnameResponse) {
 			// use response
@@ -292,7 +404,7 @@ func (engine *engine) handleCnameResolution(resolvers []string, rCon *resolver.R
 		}
 	}
 
-	return response
+	return response, cnameResult
 }
 
 func (engine *engine) invalidRequestHandler(request *dns.Msg) (bool, *dns.Msg) {
@@ -333,6 +445,12 @@ func (engine *engine) invalidRequestHandler(request *dns.Msg) (bool, *dns.Msg) {
 }
 
 func (engine *engine) HandleWithResolvers(resolverNames []string, rCon *resolver.RequestContext, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult) {
+	return engine.handleWithResolvers(resolverNames, rCon, request, nil)
+}
+
+// resolve the request with the resolvers and, if groups to protect are given, block the answer when a cname target
+// in it matches a block list of those groups
+func (engine *engine) handleWithResolvers(resolverNames []string, rCon *resolver.RequestContext, request *dns.Msg, protectGroups []string) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult) {
 	// scope provided finding response
 	var (
 		response *dns.Msg
@@ -355,7 +473,33 @@ func (engine *engine) HandleWithResolvers(resolverNames []string, rCon *resolver
 		if err != nil {
 			log.Errorf("Could not resolve <%s>: %s", request.Question[0].Name, err)
 		} else {
-			cnameResponse := engine.handleCnameResolution(resolverNames, rCon, request, response)
+			if result == nil {
+				result = &resolver.ResolutionResult{}
+			}
+
+			// check the cname targets in the upstream answer before the chain is followed
+			if len(protectGroups) > 0 {
+				if match, list, ruleText, target := engine.cnameBlockForGroups(protectGroups, response, requestTime(rCon)); match == rule.MatchBlock {
+					result.MatchCname = target
+					if blocked := engine.answerBlockedResponse(protectGroups, rCon, request, result, list, ruleText); blocked != nil {
+						return blocked, rCon, result
+					}
+				}
+			}
+
+			cnameResponse, cnameResult := engine.handleCnameResolution(resolverNames, rCon, request, response)
+
+			// targets further along the chain are checked as the chain is followed, the chain is followed with every
+			// group of the request so a blocked target only blocks the answer when the protected groups block it
+			if len(protectGroups) > 0 && !result.Paused && cnameResult != nil && cnameResult.Match == rule.MatchBlock {
+				if match, list, ruleText := engine.domainRuleMatchedForGroups(protectGroups, cnameResult.MatchCname, requestTime(rCon)); match == rule.MatchBlock {
+					result.MatchCname = cnameResult.MatchCname
+					if blocked := engine.answerBlockedResponse(protectGroups, rCon, request, result, list, ruleText); blocked != nil {
+						return blocked, rCon, result
+					}
+				}
+			}
+
 			if !util.IsEmptyResponse(cnameResponse) {
 				response = cnameResponse
 			}
@@ -410,20 +554,29 @@ func (engine *engine) HandleWithGroups(groups []string, rCon *resolver.RequestCo
 	}
 	rCon.Groups = groups
 
-	match, list, ruleText := engine.domainRuleMatchedForGroups(groups, request.Question[0].Name)
+	// the time that schedules are evaluated at
+	at := requestTime(rCon)
+
+	match, list, ruleText := engine.domainRuleMatchedForGroups(groups, request.Question[0].Name, at)
+
+	// a block is ignored while blocking is paused for the consumer or groups
+	if match == rule.MatchBlock && engine.pauses.active(rCon.Consumer, groups, at) != nil {
+		result.Paused = true
+		result.MatchList = list
+		result.MatchRule = ruleText
+		match = rule.MatchNone
+	}
+
 	if match != rule.MatchNone {
 		result.Match = match
 		result.MatchList = list
 		result.MatchRule = ruleText
 	}
 
-	// handle blocking at the group level
+	// handle blocking at the group level with the configured response
 	if match == rule.MatchBlock {
-		// todo: do configured action here
-		response := new(dns.Msg)
-		response.SetReply(request)
-		response.Rcode = dns.RcodeNameError
-		return response, rCon, result
+		blockResponse, blockTTL := engine.blockResponseFor(rCon.Consumer, groups, list)
+		return blockedResponse(request, blockResponse, blockTTL), rCon, result
 	}
 
 	// accumulate resolver names
@@ -440,7 +593,78 @@ func (engine *engine) HandleWithGroups(groups []string, rCon *resolver.RequestCo
 		resolverNames = append(resolverNames, group.configGroup.Resolvers...)
 	}
 
-	return engine.HandleWithResolvers(resolverNames, rCon, request)
+	// response policy zones apply to domains that weren't allowed or blocked by the group lists
+	if match == rule.MatchNone && !result.Paused {
+		if rpzRule, rpzList := engine.rpzForGroups(groups, request.Question[0].Name, at); rpzRule != nil {
+			if response, handled := engine.rpzResponse(groups, resolverNames, rCon, request, result, rpzRule, rpzList); handled {
+				return response, rCon, result
+			}
+			match = result.Match
+		}
+	}
+
+	// rewrite the answer if a rewrite list of the groups has a rewrite for the domain
+	if rCon.Rewrites < maxRewrites {
+		if rewrite, rewriteList := engine.rewriteForGroups(groups, request.Question[0].Name, at); rewrite != nil {
+			result.Rewritten = true
+			result.RewriteList = rewriteList
+			result.RewriteRule = rewrite.Text
+			return engine.rewrittenResponse(resolverNames, rCon, request, rewrite), rCon, result
+		}
+	}
+
+	// answers are checked for blocked cname targets (with the lists of the groups that protect them) unless the domain
+	// itself was allowed or paused
+	var protectGroups []string
+	if match == rule.MatchNone && !result.Paused {
+		protectGroups = engine.cnameProtectedGroups(groups)
+	}
+
+	response, rCon, resolverResult := engine.handleWithResolvers(resolverNames, rCon, request, protectGroups)
+
+	// keep the match details found for the groups unless they were found for a cname target
+	if resolverResult != nil && "" == resolverResult.MatchCname {
+		resolverResult.Match = result.Match
+		resolverResult.MatchList = result.MatchList
+		resolverResult.MatchRule = result.MatchRule
+		resolverResult.Paused = result.Paused
+	}
+
+	// answers with an address in an rpz-ip trigger of the groups get the action of the trigger
+	if resolverResult != nil && match == rule.MatchNone && !resolverResult.Paused && resolverResult.Match == rule.MatchNone {
+		if rpzRule, rpzList := engine.rpzIPForGroups(groups, response, at); rpzRule != nil {
+			if rpzResponse, handled := engine.rpzResponse(groups, resolverNames, rCon, request, resolverResult, rpzRule, rpzList); handled {
+				return rpzResponse, rCon, resolverResult
+			}
+		}
+	}
+
+	// block answers with an address from a block-ip list of the groups unless the domain itself was allowed or paused
+	if resolverResult != nil && match == rule.MatchNone && !resolverResult.Paused && resolverResult.Match == rule.MatchNone {
+		if list, ruleText := engine.ipBlockForGroups(groups, response, at); list != nil {
+			if blocked := engine.answerBlockedResponse(groups, rCon, request, resolverResult, list, ruleText); blocked != nil {
+				response = blocked
+			}
+		}
+	}
+
+	// reject answers for public names that resolve to private addresses when the groups use rebind protection
+	if resolverResult != nil && resolverResult.Match != rule.MatchBlock && engine.rebindProtected(groups) {
+		if network := engine.rebindNetwork(response); "" != network {
+			if engine.rebind.isExempt(request.Question[0].Name, resolverResult) {
+				resolverResult.RebindExempt = true
+			} else {
+				resolverResult.Rebind = true
+				resolverResult.Match = rule.MatchBlock
+				resolverResult.MatchList = engine.rebind.list
+				resolverResult.MatchRule = network
+				blockResponse, blockTTL := engine.blockResponseFor(rCon.Consumer, groups, engine.rebind.list)
+				response = blockedResponse(request, blockResponse, blockTTL)
+			}
+		}
+	}
+
+	return response, rCon, resolverResult
 }
 
 func (engine *engine) HandleWithConsumerName(consumerName string, rCon *resolver.RequestContext, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult) {
@@ -466,7 +690,15 @@ func (engine *engine) HandleWithConsumer(consumer *consumer, rCon *resolver.Requ
 	}
 
 	// get groups for consumer
-	groups := engine.getGroups(consumer)
+	groups := engine.getGroups(consumer, requestTime(rCon))
+
+	// remember consumer for block responses
+	if consumer != nil && consumer.configConsumer != nil {
+		if rCon == nil {
+			rCon = &resolver.RequestContext{}
+		}
+		rCon.Consumer = consumer.configConsumer.Name
+	}
 
 	// return group response
 	response, rCon, result := engine.HandleWithGroups(groups, rCon, request)
@@ -535,6 +767,9 @@ func (engine *engine) Reverse(address string) string {
 		allGroups = append(allGroups, g.configGroup.Name)
 	}
 	response, _, _ := engine.HandleWithGroups(allGroups, &resolver.RequestContext{Protocol: "udp"}, m)
+	if util.IsEmptyResponse(response) {
+		return ""
+	}
 
 	// look for first pointer
 	for _, answer := range response.Answer {
@@ -577,6 +812,17 @@ func (engine *engine) CacheSize() int64 {
 	return 0
 }
 
+// the size and accuracy of the rule store, nil if the store doesn't report them
+func (engine *engine) ruleStoreStats() *rule.StoreStats {
+	engine.storeLock.RLock()
+	defer engine.storeLock.RUnlock()
+
+	if engine.store == nil {
+		return nil
+	}
+	return rule.GetStoreStats(engine.store)
+}
+
 func (engine *engine) Metrics() Metrics {
 	return engine.metrics
 }
@@ -592,8 +838,29 @@ func (engine *engine) Shutdown() {
 		engine.recorder.shutdown()
 	}
 
+	// stop expiring custom rules
+	engine.storeLock.Lock()
+	if nil != engine.customTimer {
+		engine.customTimer.Stop()
+		engine.customTimer = nil
+	}
+	engine.storeLock.Unlock()
+
 	// close db
 	if nil != engine.db {
 		engine.db.Close()
 	}
+
+	// stop refreshing lists before the stores are closed
+	if nil != engine.refresher {
+		engine.refresher.shutdown()
+	}
+
+	// close rule store
+	if nil != engine.store {
+		engine.store.Close()
+	}
+
+	// remove session folder so that replaced engines don't leave files behind
+	os.RemoveAll(engine.Root())
 }
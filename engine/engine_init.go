@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/GeertJohan/go.rice"
@@ -43,6 +44,39 @@ func assignedLists(listNames []string, listTags []string, lists []*config.Gudgeo
 	return should
 }
 
+// returns the schedules that limit the given lists of a group by list name, a schedule given
+// for the name of a list is used before a schedule given for one of the tags of the list
+func listSchedules(conf *config.GudgeonConfig, configGroup *config.GudgeonGroup, lists []*config.GudgeonList) map[string]*config.GudgeonSchedule {
+	if len(configGroup.ListSchedules) == 0 {
+		return nil
+	}
+
+	// sort keys so that a list with more than one scheduled tag always gets the same schedule
+	keys := make([]string, 0, len(configGroup.ListSchedules))
+	for key := range configGroup.ListSchedules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	schedules := make(map[string]*config.GudgeonSchedule)
+	for _, list := range lists {
+		if schedule := conf.GetSchedule(configGroup.ListSchedules[list.Name]); schedule != nil {
+			schedules[list.CanonicalName()] = schedule
+			continue
+		}
+		for _, key := range keys {
+			if util.StringIn(key, list.SafeTags()) {
+				if schedule := conf.GetSchedule(configGroup.ListSchedules[key]); schedule != nil {
+					schedules[list.CanonicalName()] = schedule
+					break
+				}
+			}
+		}
+	}
+
+	return schedules
+}
+
 func createEngineDB(conf *config.GudgeonConfig) (*sql.DB, error) {
 	// get path to long-standing data ({home}/'data') and make sure it exists
 	dataDir := conf.DataRoot()
@@ -74,6 +108,8 @@ func createEngineDB(conf *config.GudgeonConfig) (*sql.DB, error) {
 	return db, nil
 }
 
+// create an engine for the configuration, an engine that can't be created is shut down so that it doesn't leave its db,
+// recorder, or session folder behind
 func NewEngine(conf *config.GudgeonConfig) (Engine, error) {
 	// error collection
 	var err error
@@ -81,6 +117,7 @@ func NewEngine(conf *config.GudgeonConfig) (Engine, error) {
 	// create return object
 	engine := new(engine)
 	engine.config = conf
+	engine.pauses = newPauseList()
 
 	// create session key
 	uuid := uuid.New()
@@ -93,28 +130,30 @@ func NewEngine(conf *config.GudgeonConfig) (Engine, error) {
 	os.MkdirAll(conf.SessionRoot(), os.ModePerm)
 	os.MkdirAll(engine.Root(), os.ModePerm)
 
-	// configure db if required
-	if *conf.Metrics.Enabled || *conf.QueryLog.Enabled {
-
-		//  if persistence functions are enabled, create db
-		if (*conf.Metrics.Enabled && *conf.Metrics.Persist) || (*conf.QueryLog.Enabled && *conf.QueryLog.Persist) {
-			var err error
-			engine.db, err = createEngineDB(conf)
-			if err != nil {
-				return nil, err
-			}
-		}
+	// the db holds the custom rules and (if persistence functions are enabled) query data
+	engine.db, err = createEngineDB(conf)
+	if err != nil {
+		engine.Shutdown()
+		return nil, err
+	}
+	if (*conf.Metrics.Enabled && *conf.Metrics.Persist) || (*conf.QueryLog.Enabled && *conf.QueryLog.Persist) {
+		engine.queryDB = engine.db
+	}
 
+	// configure metrics and query log if required
+	if *conf.Metrics.Enabled || *conf.QueryLog.Enabled {
 		// build metrics instance (with db if not null)
 		if *conf.Metrics.Enabled {
-			engine.metrics = NewMetrics(conf, engine.db)
+			engine.metrics = NewMetrics(conf, engine.queryDB)
 			engine.metrics.UseCacheSizeFunction(engine.CacheSize)
+			engine.metrics.UseRuleStoreStatsFunction(engine.ruleStoreStats)
 		}
 
 		// build qlog instance (with db if not null)
 		if *conf.QueryLog.Enabled {
-			engine.qlog, err = NewQueryLog(conf, engine.db)
+			engine.qlog, err = NewQueryLog(conf, engine.queryDB)
 			if err != nil {
+				engine.Shutdown()
 				return nil, err
 			}
 		}
@@ -123,6 +162,7 @@ func NewEngine(conf *config.GudgeonConfig) (Engine, error) {
 	// create recorder
 	engine.recorder, err = NewRecorder(engine)
 	if err != nil {
+		engine.Shutdown()
 		return nil, err
 	}
 
@@ -146,8 +186,26 @@ func NewEngine(conf *config.GudgeonConfig) (Engine, error) {
 		engineGroup.engine = engine
 		engineGroup.configGroup = configGroup
 
-		// determine which lists belong to this group
-		engineGroup.lists = assignedLists(configGroup.Lists, configGroup.SafeTags(), lists)
+		// determine which lists belong to this group and split out the rewrite, block-ip, and rpz lists
+		engineGroup.lists = make([]*config.GudgeonList, 0)
+		engineGroup.rewriteLists = make([]*config.GudgeonList, 0)
+		engineGroup.ipLists = make([]*config.GudgeonList, 0)
+		engineGroup.rpzLists = make([]*config.GudgeonList, 0)
+		groupLists := assignedLists(configGroup.Lists, configGroup.SafeTags(), lists)
+		for _, list := range groupLists {
+			if rule.IsRewriteList(list) {
+				engineGroup.rewriteLists = append(engineGroup.rewriteLists, list)
+			} else if rule.IsIPList(list) {
+				engineGroup.ipLists = append(engineGroup.ipLists, list)
+			} else if rule.IsRPZList(list) {
+				engineGroup.rpzLists = append(engineGroup.rpzLists, list)
+			} else {
+				engineGroup.lists = append(engineGroup.lists, list)
+			}
+		}
+
+		// limit lists to their schedules
+		engineGroup.listSchedules = listSchedules(conf, configGroup, groupLists)
 
 		// add created engine group to list of groups
 		groups[idx] = engineGroup
@@ -176,6 +234,16 @@ func NewEngine(conf *config.GudgeonConfig) (Engine, error) {
 			lists:          make([]*config.GudgeonList, 0),
 		}
 
+		// limit groups to their schedules
+		for groupName, scheduleName := range configConsumer.GroupSchedules {
+			if schedule := conf.GetSchedule(scheduleName); schedule != nil {
+				if consumer.groupSchedules == nil {
+					consumer.groupSchedules = make(map[string]*config.GudgeonSchedule)
+				}
+				consumer.groupSchedules[groupName] = schedule
+			}
+		}
+
 		// set as default consumer
 		if strings.EqualFold(configConsumer.Name, "default") {
 			engine.defaultConsumer = consumer
@@ -232,38 +300,55 @@ func NewEngine(conf *config.GudgeonConfig) (Engine, error) {
 			continue
 		}
 
-		// load/download list if required
-		err := Download(engine, conf, list)
-		if err != nil {
-			return nil, err
+		// load/download list if required, a list that can't be downloaded (or is rejected) has no cached copy to keep so
+		// it starts empty until the refresher gets it
+		if err := Download(engine, conf, list); err != nil {
+			log.Errorf("Could not download list '%s', starting without its rules: %s", list.CanonicalName(), err)
 		}
 	}
 
-	// create store based on gudgeon configuration and engine details
+	// create stores based on gudgeon configuration and engine details
 	// (requires lists to be downloaded and present before creation)
-	totalCount := uint64(0)
-	var listCounts []uint64
-	engine.store, listCounts = rule.CreateStore(engine.Root(), conf)
-
-	// use/set metrics if they are enabled
-	if engine.metrics != nil {
-		metrics := engine.metrics
-		for idx, list := range conf.Lists {
-			log.Infof("List '%s' loaded %d rules", list.CanonicalName(), listCounts[idx])
-			rulesCounter := metrics.Get("rules-list-" + list.ShortName())
-			rulesCounter.Clear()
-			rulesCounter.Inc(int64(listCounts[idx]))
-			totalCount += uint64(listCounts[idx])
+	stores := createListStores(conf, engine.Root())
+	engine.store = stores.store
+	engine.rewrites = stores.rewrites
+	engine.ips = stores.ips
+	engine.rpz = stores.rpz
+	engine.storeRoot = engine.Root()
+	engine.listFiles = stores.files
+
+	// rebind protection uses the ip store for the private networks
+	engine.rebind = newRebindProtection(conf.RebindProtection, engine.ips)
+
+	// safe search rewrites come before the other rewrite lists of a group
+	for _, group := range groups {
+		if group.configGroup.SafeSearch {
+			group.rewriteLists = append([]*config.GudgeonList{engine.rewrites.LoadSafeSearch(group.configGroup.SafeSearchYouTube)}, group.rewriteLists...)
 		}
-		totalRulesCounter := metrics.Get(TotalRules)
-		totalRulesCounter.Inc(int64(totalCount))
 	}
 
+	// use/set metrics if they are enabled
+	engine.updateListMetrics(stores.counts, stores.skipped)
+
 	// set consumers as active on engine
 	engine.groups = groupMap
 	engine.consumers = consumers
 	engine.consumerMap = consumerMap
 
+	// load the custom rules into the lists made for them
+	groupNames := make([]string, 0, len(groupMap))
+	for name := range groupMap {
+		groupNames = append(groupNames, name)
+	}
+	engine.customLists = createCustomLists(groupNames)
+	if err := engine.loadCustomRules(); err != nil {
+		engine.Shutdown()
+		return nil, err
+	}
+
+	// download remote lists again on their refresh intervals
+	engine.refresher = newListRefresher(engine)
+
 	// force GC after loading the engine because
 	// of all the extra allocation that gets performed
 	// during the creation of the arrays and whatnot
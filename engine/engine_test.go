@@ -4,7 +4,11 @@ import (
 	"net"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/resolver"
 	"github.com/chrisruffalo/gudgeon/rule"
 	"github.com/chrisruffalo/gudgeon/testutil"
 	"github.com/chrisruffalo/gudgeon/util"
@@ -133,3 +137,420 @@ func TestReverseLookup(t *testing.T) {
 
 	engine.Shutdown()
 }
+
+func TestBlockResponses(t *testing.T) {
+	config := testutil.Conf(t, "testdata/block-response.yml")
+	defer os.RemoveAll(config.Home)
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer engine.Shutdown()
+
+	data := []struct {
+		ip       string
+		domain   string
+		qType    uint16
+		rcode    int
+		expected string
+		ttl      uint32
+	}{
+		// lists
+		{"192.168.0.1", "allowed.com", dns.TypeA, dns.RcodeSuccess, "127.0.0.1", 0},
+		{"192.168.0.1", "one.blocked.com", dns.TypeA, dns.RcodeNameError, "", 0},
+		{"192.168.0.1", "two.blocked.com", dns.TypeA, dns.RcodeSuccess, "0.0.0.0", 60},
+		{"192.168.0.1", "two.blocked.com", dns.TypeAAAA, dns.RcodeSuccess, "::", 60},
+		{"192.168.0.1", "three.blocked.com", dns.TypeA, dns.RcodeSuccess, "10.0.0.99", 300},
+		{"192.168.0.1", "three.blocked.com", dns.TypeAAAA, dns.RcodeSuccess, "fd00::99", 300},
+		{"192.168.0.1", "three.blocked.com", dns.TypeMX, dns.RcodeSuccess, "", 0},
+		// group
+		{"10.0.0.1", "one.blocked.com", dns.TypeA, dns.RcodeRefused, "", 0},
+		// consumer
+		{"10.0.0.2", "one.blocked.com", dns.TypeA, dns.RcodeSuccess, "", 0},
+		{"10.0.0.2", "three.blocked.com", dns.TypeA, dns.RcodeSuccess, "", 0},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(dns.Fqdn(d.domain), d.qType)
+
+		response, _, _ := engine.Handle(parseIP(d.ip), "udp", request)
+		if response == nil {
+			t.Errorf("No response for %s from %s", d.domain, d.ip)
+			continue
+		}
+		if response.Rcode != d.rcode {
+			t.Errorf("Expected rcode %s for %s from %s but got %s", dns.RcodeToString[d.rcode], d.domain, d.ip, dns.RcodeToString[response.Rcode])
+		}
+		if "" == d.expected {
+			if len(response.Answer) > 0 {
+				t.Errorf("Expected no answers for %s from %s but got %s", d.domain, d.ip, response.Answer[0])
+			}
+			continue
+		}
+		if len(response.Answer) < 1 {
+			t.Errorf("Expected answer %s for %s from %s but got none", d.expected, d.domain, d.ip)
+			continue
+		}
+		var answer string
+		switch record := response.Answer[0].(type) {
+		case *dns.A:
+			answer = record.A.String()
+		case *dns.AAAA:
+			answer = record.AAAA.String()
+		}
+		if answer != d.expected {
+			t.Errorf("Expected answer %s for %s from %s but got %s", d.expected, d.domain, d.ip, answer)
+		}
+		if d.ttl > 0 && response.Answer[0].Header().Ttl != d.ttl {
+			t.Errorf("Expected ttl %d for %s from %s but got %d", d.ttl, d.domain, d.ip, response.Answer[0].Header().Ttl)
+		}
+	}
+}
+
+func TestRewrites(t *testing.T) {
+	config := testutil.Conf(t, "testdata/rewrite.yml")
+	defer os.RemoveAll(config.Home)
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer engine.Shutdown()
+
+	data := []struct {
+		ip        string
+		domain    string
+		qType     uint16
+		expected  string
+		rewritten bool
+	}{
+		// cname rewrites are resolved
+		{"192.168.0.1", "alias.com", dns.TypeA, "127.0.0.1", true},
+		{"192.168.0.1", "alias.com", dns.TypeAAAA, "fd00::1", true},
+		{"192.168.0.1", "alias.com", dns.TypeCNAME, "target.com.", true},
+		{"192.168.0.1", "one.wild.com", dns.TypeA, "127.0.0.1", true},
+		{"192.168.0.1", "wild.com", dns.TypeA, "", false},
+		// fixed rewrites
+		{"192.168.0.1", "fixed.com", dns.TypeA, "10.0.0.10", true},
+		{"192.168.0.1", "fixed.com", dns.TypeAAAA, "fd00::10", true},
+		{"192.168.0.1", "fixed.com", dns.TypeMX, "", true},
+		// blocked targets and loops are answered with just the cname
+		{"192.168.0.1", "bad.com", dns.TypeA, "one.blocked.com.", true},
+		{"192.168.0.1", "loop.com", dns.TypeA, "loop.com.", true},
+		// lists are used in order
+		{"10.0.0.1", "alias.com", dns.TypeA, "192.168.0.10", true},
+		{"10.0.0.1", "nas.lan", dns.TypeA, "192.168.0.20", true},
+		{"192.168.0.1", "nas.lan", dns.TypeA, "", false},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(dns.Fqdn(d.domain), d.qType)
+
+		response, _, result := engine.Handle(parseIP(d.ip), "udp", request)
+		if response == nil || result == nil {
+			t.Errorf("No response for %s from %s", d.domain, d.ip)
+			continue
+		}
+		if result.Rewritten != d.rewritten {
+			t.Errorf("Expected rewritten to be %t for %s from %s", d.rewritten, d.domain, d.ip)
+		}
+		if d.rewritten && (result.RewriteList == nil || "" == result.RewriteRule) {
+			t.Errorf("Expected rewrite list and rule in result for %s from %s", d.domain, d.ip)
+		}
+		if "" == d.expected {
+			if len(response.Answer) > 0 {
+				t.Errorf("Expected no answers for %s from %s but got %s", d.domain, d.ip, response.Answer[0])
+			}
+			continue
+		}
+		if len(response.Answer) < 1 {
+			t.Errorf("Expected answer %s for %s from %s but got none", d.expected, d.domain, d.ip)
+			continue
+		}
+		var answer string
+		switch record := response.Answer[0].(type) {
+		case *dns.A:
+			answer = record.A.String()
+		case *dns.AAAA:
+			answer = record.AAAA.String()
+		case *dns.CNAME:
+			answer = record.Target
+		}
+		if answer != d.expected {
+			t.Errorf("Expected answer %s for %s from %s but got %s", d.expected, d.domain, d.ip, answer)
+		}
+		if response.Answer[0].Header().Name != dns.Fqdn(d.domain) {
+			t.Errorf("Expected answer for %s from %s but got answer for %s", d.domain, d.ip, response.Answer[0].Header().Name)
+		}
+	}
+}
+
+func TestSafeSearch(t *testing.T) {
+	config := testutil.Conf(t, "testdata/safesearch.yml")
+	defer os.RemoveAll(config.Home)
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer engine.Shutdown()
+
+	data := []struct {
+		ip        string
+		domain    string
+		expected  string
+		rewritten bool
+	}{
+		// groups without safe search are not rewritten
+		{"192.168.0.1", "www.google.com", "172.217.0.1", false},
+		// google (all ccTLDs), bing, duckduckgo, pixabay
+		{"10.0.0.1", "www.google.com", "216.239.38.120", true},
+		{"10.0.0.1", "google.co.uk", "216.239.38.120", true},
+		{"10.0.0.1", "www.google.com.au", "216.239.38.120", true},
+		{"10.0.0.1", "www.bing.com", "204.79.197.220", true},
+		{"10.0.0.1", "duckduckgo.com", "40.89.244.237", true},
+		{"10.0.0.1", "pixabay.com", "104.18.82.97", true},
+		// youtube strict and moderate
+		{"10.0.0.1", "www.youtube.com", "216.239.38.120", true},
+		{"10.0.0.2", "www.youtube.com", "216.239.38.119", true},
+		{"10.0.0.2", "m.youtube.com", "216.239.38.119", true},
+		{"10.0.0.2", "www.google.de", "216.239.38.120", true},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(dns.Fqdn(d.domain), dns.TypeA)
+
+		response, _, result := engine.Handle(parseIP(d.ip), "udp", request)
+		if response == nil || result == nil {
+			t.Errorf("No response for %s from %s", d.domain, d.ip)
+			continue
+		}
+		if result.Rewritten != d.rewritten {
+			t.Errorf("Expected rewritten to be %t for %s from %s", d.rewritten, d.domain, d.ip)
+		}
+		if answer := util.GetFirstIPResponse(response); answer != d.expected {
+			t.Errorf("Expected answer %s for %s from %s but got %s", d.expected, d.domain, d.ip, answer)
+		}
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	config := testutil.Conf(t, "testdata/schedule.yml")
+	defer os.RemoveAll(config.Home)
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer engine.Shutdown()
+
+	data := []struct {
+		consumer string
+		domain   string
+		at       time.Time
+		blocked  bool
+	}{
+		// scheduled list: sunday night into monday morning but not friday night
+		{"kids", "social.com", time.Date(2019, time.March, 10, 20, 0, 0, 0, time.UTC), false},
+		{"kids", "social.com", time.Date(2019, time.March, 10, 22, 0, 0, 0, time.UTC), true},
+		{"kids", "social.com", time.Date(2019, time.March, 11, 6, 0, 0, 0, time.UTC), true},
+		{"kids", "social.com", time.Date(2019, time.March, 15, 22, 0, 0, 0, time.UTC), false},
+		// unscheduled list in the same group
+		{"kids", "games.com", time.Date(2019, time.March, 10, 20, 0, 0, 0, time.UTC), true},
+		{"kids", "games.com", time.Date(2019, time.March, 15, 22, 0, 0, 0, time.UTC), true},
+		// scheduled group membership
+		{"weekend-gamers", "games.com", time.Date(2019, time.March, 9, 12, 0, 0, 0, time.UTC), true},
+		{"weekend-gamers", "games.com", time.Date(2019, time.March, 11, 12, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(dns.Fqdn(d.domain), dns.TypeA)
+
+		rCon := resolver.DefaultRequestContext()
+		rCon.Time = d.at
+
+		_, _, result := engine.HandleWithConsumerName(d.consumer, rCon, request)
+		if blocked := result != nil && result.Match == rule.MatchBlock; blocked != d.blocked {
+			t.Errorf("Expected %s to be blocked=%t for %s at %s but got %t", d.domain, d.blocked, d.consumer, d.at, blocked)
+		}
+	}
+}
+
+func TestCnameProtection(t *testing.T) {
+	config := testutil.Conf(t, "testdata/cname.yml")
+	defer os.RemoveAll(config.Home)
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer engine.Shutdown()
+
+	data := []struct {
+		ip      string
+		domain  string
+		blocked bool
+		cname   string
+	}{
+		// cname targets are blocked for protected groups
+		{"192.168.0.1", "metrics.shop.com", true, "shop.eulerian.net."},
+		{"192.168.0.1", "chained.shop.com", true, "shop.eulerian.net."},
+		{"192.168.0.1", "shop.eulerian.net", true, ""},
+		// allowed domains are not checked
+		{"192.168.0.1", "allowed.shop.com", false, ""},
+		{"192.168.0.1", "www.shop.com", false, ""},
+		// other groups only check the question
+		{"10.0.0.1", "metrics.shop.com", false, ""},
+		{"10.0.0.1", "shop.eulerian.net", true, ""},
+		// cname targets are only checked against the block lists of the protected groups
+		{"10.0.0.2", "metrics.shop.com", false, ""},
+		{"10.0.0.2", "shop.eulerian.net", true, ""},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(dns.Fqdn(d.domain), dns.TypeA)
+
+		response, _, result := engine.Handle(parseIP(d.ip), "udp", request)
+		if response == nil || result == nil {
+			t.Errorf("No response for %s from %s", d.domain, d.ip)
+			continue
+		}
+		if blocked := result.Match == rule.MatchBlock; blocked != d.blocked {
+			t.Errorf("Expected blocked to be %t for %s from %s", d.blocked, d.domain, d.ip)
+		}
+		if result.MatchCname != d.cname {
+			t.Errorf("Expected cname match '%s' for %s from %s but got '%s'", d.cname, d.domain, d.ip, result.MatchCname)
+		}
+		if d.blocked && (response.Rcode != dns.RcodeNameError || len(response.Answer) > 0) {
+			t.Errorf("Expected blocked response for %s from %s but got %s", d.domain, d.ip, response)
+		}
+		if !d.blocked && len(response.Answer) < 1 {
+			t.Errorf("Expected answer for %s from %s but got none", d.domain, d.ip)
+		}
+	}
+}
+
+func TestIPBlocking(t *testing.T) {
+	config := testutil.Conf(t, "testdata/blockip.yml")
+	defer os.RemoveAll(config.Home)
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer engine.Shutdown()
+
+	data := []struct {
+		ip       string
+		domain   string
+		qType    uint16
+		expected string
+	}{
+		// answers with blocked addresses are blocked
+		{"192.168.0.1", "rebind.com", dns.TypeA, "10.0.0.0/8"},
+		{"192.168.0.1", "rebind.com", dns.TypeAAAA, "fc00::/7"},
+		{"192.168.0.1", "malware.com", dns.TypeA, "203.0.113.7"},
+		{"192.168.0.1", "safe.com", dns.TypeA, ""},
+		// allowed domains are not checked
+		{"192.168.0.1", "nas.home.com", dns.TypeA, ""},
+		// other groups don't use the list
+		{"10.0.0.1", "rebind.com", dns.TypeA, ""},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(dns.Fqdn(d.domain), d.qType)
+
+		response, _, result := engine.Handle(parseIP(d.ip), "udp", request)
+		if response == nil || result == nil {
+			t.Errorf("No response for %s from %s", d.domain, d.ip)
+			continue
+		}
+		if "" == d.expected {
+			if result.Match == rule.MatchBlock || len(response.Answer) < 1 {
+				t.Errorf("Expected answer for %s from %s but it was blocked", d.domain, d.ip)
+			}
+			continue
+		}
+		if result.Match != rule.MatchBlock || result.MatchList == nil || result.MatchRule != d.expected {
+			t.Errorf("Expected %s from %s to be blocked by rule %s but got rule '%s'", d.domain, d.ip, d.expected, result.MatchRule)
+		}
+		if response.Rcode != dns.RcodeNameError || len(response.Answer) > 0 {
+			t.Errorf("Expected blocked response for %s from %s but got %s", d.domain, d.ip, response)
+		}
+	}
+}
+
+func TestRPZ(t *testing.T) {
+	config := testutil.Conf(t, "testdata/rpz.yml")
+	defer os.RemoveAll(config.Home)
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer engine.Shutdown()
+
+	data := []struct {
+		ip       string
+		domain   string
+		match    rule.Match
+		rule     string
+		dropped  bool
+		rcode    int
+		expected string
+	}{
+		{"192.168.0.1", "nxdomain.com", rule.MatchBlock, "nxdomain.com NXDOMAIN", false, dns.RcodeNameError, ""},
+		{"192.168.0.1", "www.nxdomain.com", rule.MatchBlock, "*.nxdomain.com NXDOMAIN", false, dns.RcodeNameError, ""},
+		{"192.168.0.1", "passthru.nxdomain.com", rule.MatchAllow, "passthru.nxdomain.com PASSTHRU", false, dns.RcodeSuccess, "192.0.2.10"},
+		{"192.168.0.1", "nodata.com", rule.MatchBlock, "nodata.com NODATA", false, dns.RcodeSuccess, ""},
+		{"192.168.0.1", "drop.com", rule.MatchBlock, "drop.com DROP", true, 0, ""},
+		{"192.168.0.1", "garden.com", rule.MatchNone, "", false, dns.RcodeSuccess, "192.0.2.1"},
+		{"192.168.0.1", "redirect.com", rule.MatchNone, "", false, dns.RcodeSuccess, "203.0.113.8"},
+		{"192.168.0.1", "malware.com", rule.MatchBlock, "203.0.113.7/32 NXDOMAIN", false, dns.RcodeNameError, ""},
+		{"192.168.0.1", "safe.com", rule.MatchNone, "", false, dns.RcodeSuccess, "203.0.113.8"},
+		// other groups don't use the zone
+		{"10.0.0.1", "nxdomain.com", rule.MatchNone, "", false, dns.RcodeSuccess, "203.0.113.9"},
+		{"10.0.0.1", "malware.com", rule.MatchNone, "", false, dns.RcodeSuccess, "203.0.113.7"},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(dns.Fqdn(d.domain), dns.TypeA)
+
+		response, _, result := engine.Handle(parseIP(d.ip), "udp", request)
+		if result == nil {
+			t.Errorf("No result for %s from %s", d.domain, d.ip)
+			continue
+		}
+		if result.Match != d.match || result.MatchRule != d.rule {
+			t.Errorf("Expected %s from %s to match %d with rule '%s' but got %d with rule '%s'", d.domain, d.ip, d.match, d.rule, result.Match, result.MatchRule)
+		}
+		if d.dropped {
+			if response != nil {
+				t.Errorf("Expected %s from %s to be dropped but got %s", d.domain, d.ip, response)
+			}
+			continue
+		}
+		if response == nil {
+			t.Errorf("No response for %s from %s", d.domain, d.ip)
+			continue
+		}
+		if response.Rcode != d.rcode || util.GetFirstIPResponse(response) != d.expected {
+			t.Errorf("Expected %s from %s to be answered with '%s' (%s) but got %s", d.domain, d.ip, d.expected, dns.RcodeToString[d.rcode], response)
+		}
+	}
+}
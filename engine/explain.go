@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/rule"
+)
+
+// every allow/block rule that matches a domain for a consumer and the one that decides the answer, answers that are
+// changed after resolution (rpz, block-ip, rebind protection, cname targets) are not explained
+type Explanation struct {
+	Domain   string
+	Consumer string
+	Groups   []string
+	// the lists in the order they are checked, see domainListsForGroups
+	Lists []*ExplainedList
+	// every rule that matches the domain or one of its parent domains in the order the lists are checked
+	Matches []*ExplainedMatch
+	// the match that decides the answer, nil when no rule matches
+	Winner *ExplainedMatch
+	Match  rule.Match
+	// a block that is ignored because blocking is paused
+	Paused bool
+	Reason string
+}
+
+// a list that is checked for the domain with the priority it is checked at and the groups of the consumer that use it
+type ExplainedList struct {
+	List     string
+	Type     string
+	Priority int
+	Groups   []string
+	Custom   bool
+}
+
+// a rule that matches the domain with the priority and groups of its list
+type ExplainedMatch struct {
+	Match    rule.Match
+	List     string
+	Rule     string
+	Priority int
+	Groups   []string
+	Custom   bool
+}
+
+func (engine *engine) domainRuleMatchesForLists(lists []*config.GudgeonList, domain string) []*rule.RuleMatch {
+	engine.storeLock.RLock()
+	defer engine.storeLock.RUnlock()
+
+	if engine.store == nil || len(lists) < 1 {
+		return []*rule.RuleMatch{}
+	}
+	return engine.store.FindAllMatches(lists, domain)
+}
+
+// explain which rules match the domain for the named consumer (or the default consumer when there is no such consumer)
+func (engine *engine) Explain(consumerName string, domain string) *Explanation {
+	consumer, found := engine.consumerMap[consumerName]
+	if !found {
+		consumer = engine.defaultConsumer
+	}
+
+	at := time.Now()
+	explanation := &Explanation{
+		Domain:  strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), "."),
+		Groups:  engine.getGroups(consumer, at),
+		Matches: make([]*ExplainedMatch, 0),
+	}
+	if consumer != nil && consumer.configConsumer != nil {
+		explanation.Consumer = consumer.configConsumer.Name
+	}
+
+	customLists := make(map[*config.GudgeonList]bool)
+	for _, list := range engine.customLists {
+		customLists[list] = true
+	}
+
+	prioritized := engine.domainListsForGroups(explanation.Groups, at)
+	lists := make([]*config.GudgeonList, 0, len(prioritized))
+	explained := make(map[*config.GudgeonList]*ExplainedList)
+	explanation.Lists = make([]*ExplainedList, 0, len(prioritized))
+	for _, list := range prioritized {
+		lists = append(lists, list.list)
+		explained[list.list] = &ExplainedList{
+			List:     list.list.CanonicalName(),
+			Type:     list.list.Type,
+			Priority: list.priority,
+			Groups:   list.groups,
+			Custom:   customLists[list.list],
+		}
+		explanation.Lists = append(explanation.Lists, explained[list.list])
+	}
+
+	for _, match := range engine.domainRuleMatchesForLists(lists, explanation.Domain) {
+		explanation.Matches = append(explanation.Matches, &ExplainedMatch{
+			Match:    match.Match,
+			List:     match.List.CanonicalName(),
+			Rule:     match.Rule,
+			Priority: explained[match.List].Priority,
+			Groups:   explained[match.List].Groups,
+			Custom:   explained[match.List].Custom,
+		})
+	}
+
+	// the winner is the match found the same way a query is answered
+	match, list, ruleText := engine.domainRuleMatchedForGroups(explanation.Groups, explanation.Domain, at)
+	explanation.Match = match
+	if list != nil {
+		for _, explained := range explanation.Matches {
+			if explained.List == list.CanonicalName() && explained.Rule == ruleText {
+				explanation.Winner = explained
+				break
+			}
+		}
+		// stores that keep hashes report the hash of the rule when answering
+		for _, explained := range explanation.Matches {
+			if explanation.Winner == nil && explained.List == list.CanonicalName() && explained.Match == match {
+				explanation.Winner = explained
+			}
+		}
+	}
+	explanation.Paused = match == rule.MatchBlock && engine.pauses.active(explanation.Consumer, explanation.Groups, at) != nil
+	explanation.Reason = explainReason(explanation, consumer != nil && consumer.configConsumer != nil && consumer.configConsumer.Block)
+
+	return explanation
+}
+
+// why the winning match decides the answer
+func explainReason(explanation *Explanation, consumerBlocked bool) string {
+	if consumerBlocked {
+		return "The consumer is blocked so every request is refused"
+	}
+
+	winner := explanation.Winner
+	if winner == nil {
+		return "No rule in the lists of the consumer's groups matches the domain"
+	}
+
+	// matches with the same priority as the winner are checked with it (custom rules are checked before the lists with
+	// the same priority), those with a lower priority are checked after it
+	counts := make(map[rule.Match]int)
+	lower, after := 0, 0
+	for _, match := range explanation.Matches {
+		if match.Priority == winner.Priority && match.Custom == winner.Custom {
+			counts[match.Match]++
+		} else if match.Priority == winner.Priority {
+			after++
+		} else if match.Priority < winner.Priority {
+			lower++
+		}
+	}
+	listed := ""
+	if after > 0 {
+		listed = fmt.Sprintf(" (%d rules in the lists of the groups with the same priority also match)", after)
+	}
+	priority := ""
+	if lower > 0 {
+		priority = fmt.Sprintf(" and its priority of %d is higher than the priority of the other %d matching rules", winner.Priority, lower)
+	}
+
+	var reason string
+	if winner.Match == rule.MatchAllow {
+		switch {
+		case winner.Custom:
+			reason = fmt.Sprintf("Custom allow rule '%s' is the first matching allow rule with priority %d and custom rules are checked before the lists of the groups with the same priority", winner.Rule, winner.Priority) + listed
+		case strings.HasPrefix(winner.Rule, "@@"):
+			reason = fmt.Sprintf("Exception rule '%s' in list '%s' allows the domain in place of the block rules of the list", winner.Rule, winner.List)
+		default:
+			reason = fmt.Sprintf("Allow rule '%s' in list '%s' is the first matching allow rule and allow rules are checked before block rules", winner.Rule, winner.List)
+		}
+		if counts[rule.MatchBlock] > 0 {
+			reason += fmt.Sprintf(" (%d block rules also match)", counts[rule.MatchBlock])
+		}
+		return reason + priority
+	}
+
+	switch {
+	case winner.Custom:
+		reason = fmt.Sprintf("Custom block rule '%s' is the first matching block rule with priority %d, custom rules are checked before the lists of the groups with the same priority and no custom allow rule with the same priority matches", winner.Rule, winner.Priority) + listed
+	case counts[rule.MatchAllow] > 0:
+		reason = fmt.Sprintf("Important rule '%s' in list '%s' is checked before allow rules and exceptions (%d allow rules also match)", winner.Rule, winner.List, counts[rule.MatchAllow])
+	default:
+		reason = fmt.Sprintf("Block rule '%s' in list '%s' is the first matching block rule and no allow rule with the same priority matches", winner.Rule, winner.List)
+	}
+	reason += priority
+	if explanation.Paused {
+		reason += " but blocking is paused so the domain is not blocked"
+	}
+	return reason
+}
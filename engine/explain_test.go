@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestExplain(t *testing.T) {
+	config := testutil.Conf(t, "testdata/explain.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	data := []struct {
+		consumer string
+		domain   string
+		matches  []string
+		match    rule.Match
+		winner   string
+		reason   string
+	}{
+		{"strict", "x.www.ads.com.", []string{"ads ads.com", "more www.ads.com", "more ads.com"}, rule.MatchBlock, "ads ads.com", "first matching block rule"},
+		{"strict", "shop.ads.com", []string{"ads ads.com", "exceptions shop.ads.com", "more ads.com"}, rule.MatchAllow, "exceptions shop.ads.com", "(2 block rules also match)"},
+		{"", "good.ads.com", []string{"ads @@good.ads.com", "ads ads.com"}, rule.MatchAllow, "ads @@good.ads.com", "Exception rule"},
+		{"", "tracker.com", []string{"ads tracker.com$important", "exceptions tracker.com"}, rule.MatchBlock, "ads tracker.com$important", "Important rule"},
+		{"", "ad1.example.com", []string{"ads /^ad[0-9]+\\./"}, rule.MatchBlock, "ads /^ad[0-9]+\\./", "first matching block rule"},
+		{"", "nothing.org", []string{}, rule.MatchNone, "", "No rule"},
+	}
+
+	for _, d := range data {
+		explanation := testEngine.Explain(d.consumer, d.domain)
+		found := make([]string, 0, len(explanation.Matches))
+		for _, match := range explanation.Matches {
+			found = append(found, match.List+" "+match.Rule)
+		}
+		if strings.Join(found, ", ") != strings.Join(d.matches, ", ") {
+			t.Errorf("Expected '%s' to match [%s] but found [%s]", d.domain, strings.Join(d.matches, ", "), strings.Join(found, ", "))
+		}
+		winner := ""
+		if explanation.Winner != nil {
+			winner = explanation.Winner.List + " " + explanation.Winner.Rule
+		}
+		if explanation.Match != d.match || winner != d.winner {
+			t.Errorf("Expected '%s' to have match %d from '%s' but got %d from '%s'", d.domain, d.match, d.winner, explanation.Match, winner)
+		}
+		if !strings.Contains(explanation.Reason, d.reason) {
+			t.Errorf("Expected the reason for '%s' to contain '%s' but it was '%s'", d.domain, d.reason, explanation.Reason)
+		}
+	}
+
+	// the groups that use a list are given with each match
+	explanation := testEngine.Explain("strict", "ads.com")
+	if len(explanation.Matches) == 0 || strings.Join(explanation.Matches[0].Groups, ",") != "default,strict" {
+		t.Errorf("Expected the first match to be from a list in both groups")
+	}
+
+	// custom rules come first
+	if _, err := testEngine.AddCustomRule("ads.com", "allow", []string{"strict"}, 0); err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+		return
+	}
+	explanation = testEngine.Explain("strict", "x.ads.com")
+	if explanation.Winner == nil || !explanation.Winner.Custom || strings.Join(explanation.Winner.Groups, ",") != "strict" || !strings.Contains(explanation.Reason, "Custom allow rule") {
+		t.Errorf("Expected the custom rule for the strict group to win but got: %s", explanation.Reason)
+	}
+	if explanation = testEngine.Explain("", "x.ads.com"); explanation.Match != rule.MatchBlock {
+		t.Errorf("Expected the custom rule to only apply to the strict group")
+	}
+}
@@ -36,7 +36,13 @@ func MulticastMdnsQuery() {
 	log.Debug("Sent mDNS Multicast Query")
 }
 
-func MulticastMdnsListen(msgChan chan *dns.Msg) {
+// listen for multicast messages and send them to the message channel until the stop channel is closed, the message
+// channel is closed when the listener stops
+func MulticastMdnsListen(msgChan chan *dns.Msg, stopChan chan bool) {
+	if msgChan != nil {
+		defer close(msgChan)
+	}
+
 	addr, err := net.ResolveUDPAddr("udp", mdnsAddressString)
 	if err != nil {
 		log.Errorf("Address resolve failed: %s\n", err)
@@ -47,7 +53,12 @@ func MulticastMdnsListen(msgChan chan *dns.Msg) {
 		log.Errorf("Listen multicast failed")
 		return
 	}
-	defer co.Close()
+
+	// closing the connection ends the read that is waiting for a message
+	go func() {
+		<-stopChan
+		co.Close()
+	}()
 
 	// make query after open
 	MulticastMdnsQuery()
@@ -55,11 +66,20 @@ func MulticastMdnsListen(msgChan chan *dns.Msg) {
 	for {
 		msg, err := co.ReadMsg()
 		if err != nil {
+			select {
+			case <-stopChan:
+				return
+			default:
+			}
 			log.Debugf("Reading mDNS message: %s", err)
 			continue
 		}
 		if msgChan != nil && msg != nil {
-			msgChan <- msg
+			select {
+			case msgChan <- msg:
+			case <-stopChan:
+				return
+			}
 		}
 	}
 }
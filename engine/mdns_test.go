@@ -15,7 +15,8 @@ func TestMdns(t *testing.T) {
 	defer cancel()
 
 	msgChan := make(chan *dns.Msg)
-	go MulticastMdnsListen(msgChan)
+	stopChan := make(chan bool)
+	go MulticastMdnsListen(msgChan, stopChan)
 	counter := 0
 	go func() {
 		MulticastMdnsQuery()
@@ -25,7 +26,7 @@ func TestMdns(t *testing.T) {
 	}()
 
 	<-ctx.Done()
-	close(msgChan)
+	close(stopChan)
 
 	if counter < 1 {
 		t.Errorf("Did not see any mDNS/Avahi services")
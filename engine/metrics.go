@@ -36,8 +36,16 @@ const (
 	QueriesPerSecond       = "session-queries-ps"
 	BlocksPerSecond        = "session-blocks-ps"
 	QueryTime              = "query-time"
+	// rebind protection
+	RebindBlockedQueries = "rebind-blocked-queries"
+	RebindExemptQueries  = "rebind-exempt-queries"
 	// cache entries
 	CurrentCacheEntries = "cache-entries"
+	// rule store size and accuracy, for stores that report them
+	RuleStoreMemory           = "rule-store-bytes"
+	RuleStoreLookups          = "rule-store-lookups"
+	RuleStoreFalsePositives   = "rule-store-false-positives"
+	RuleStoreFalsePositivePPM = "rule-store-false-positive-ppm" // 120 == 0.012 percent, in parts per million
 	// rutnime metrics
 	GoRoutines         = "goroutines"
 	Threads            = "process-threads"
@@ -97,7 +105,8 @@ type metrics struct {
 	metricsInfoChan chan *metricsInfo
 	db              *sql.DB
 
-	cacheSizeFunc CacheSizeFunction
+	cacheSizeFunc      CacheSizeFunction
+	ruleStoreStatsFunc RuleStoreStatsFunction
 
 	// time management for interval insert
 	lastInsert time.Time
@@ -106,6 +115,8 @@ type metrics struct {
 
 type CacheSizeFunction = func() int64
 
+type RuleStoreStatsFunction = func() *rule.StoreStats
+
 type Metrics interface {
 	GetAll() map[string]*Metric
 	Get(name string) *Metric
@@ -113,6 +124,9 @@ type Metrics interface {
 	// use cache function
 	UseCacheSizeFunction(function CacheSizeFunction)
 
+	// use rule store stats function
+	UseRuleStoreStatsFunction(function RuleStoreStatsFunction)
+
 	// Query metrics from db
 	Query(start time.Time, end time.Time) ([]*MetricsEntry, error)
 	QueryStream(returnChan chan *MetricsEntry, start time.Time, end time.Time) error
@@ -234,6 +248,16 @@ func (metrics *metrics) update() {
 	if metrics.cacheSizeFunc != nil {
 		metrics.Get(CurrentCacheEntries).Set(metrics.cacheSizeFunc())
 	}
+
+	// capture rule store size and accuracy
+	if metrics.ruleStoreStatsFunc != nil {
+		if stats := metrics.ruleStoreStatsFunc(); stats != nil {
+			metrics.Get(RuleStoreMemory).Set(int64(stats.MemoryBytes))
+			metrics.Get(RuleStoreLookups).Set(int64(stats.Lookups))
+			metrics.Get(RuleStoreFalsePositives).Set(int64(stats.FalsePositives))
+			metrics.Get(RuleStoreFalsePositivePPM).Set(int64(math.Round(stats.FalsePositiveRate * 1000000)))
+		}
+	}
 }
 
 func (metrics *metrics) record(info *InfoRecord) {
@@ -258,6 +282,14 @@ func (metrics *metrics) record(info *InfoRecord) {
 			metrics.Get("rules-lifetime-matched-" + info.Result.MatchList.ShortName()).Inc(1)
 		}
 	}
+
+	// add answers with private addresses that were rejected or exempt
+	if info.Result != nil && info.Result.Rebind {
+		metrics.Get(RebindBlockedQueries).Inc(1)
+	}
+	if info.Result != nil && info.Result.RebindExempt {
+		metrics.Get(RebindExemptQueries).Inc(1)
+	}
 }
 
 func (metrics *metrics) insert(tx *sql.Tx, currentTime time.Time) {
@@ -410,6 +442,10 @@ func (metrics *metrics) UseCacheSizeFunction(function CacheSizeFunction) {
 	metrics.cacheSizeFunc = function
 }
 
+func (metrics *metrics) UseRuleStoreStatsFunction(function RuleStoreStatsFunction) {
+	metrics.ruleStoreStatsFunc = function
+}
+
 func (metrics *metrics) Stop() {
 
 }
@@ -2,6 +2,9 @@ package engine
 
 import (
 	"testing"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/rule"
 )
 
 func TestMetric(t *testing.T) {
@@ -44,3 +47,26 @@ func TestMetricMap(t *testing.T) {
 		t.Errorf("Expected (mb=)2000 but got %d", mb.Value())
 	}
 }
+
+func TestRuleStoreMetrics(t *testing.T) {
+	ms := &metrics{
+		config:     &config.GudgeonConfig{Metrics: &config.GudgeonMetrics{Interval: "15s"}},
+		metricsMap: make(map[string]*Metric),
+	}
+	ms.UseRuleStoreStatsFunction(func() *rule.StoreStats {
+		return &rule.StoreStats{MemoryBytes: 2048, Lookups: 10000, FalsePositives: 2, FalsePositiveRate: 0.0002, Measured: true}
+	})
+	ms.update()
+
+	expected := map[string]int64{
+		RuleStoreMemory:           2048,
+		RuleStoreLookups:          10000,
+		RuleStoreFalsePositives:   2,
+		RuleStoreFalsePositivePPM: 200,
+	}
+	for name, value := range expected {
+		if value != ms.Get(name).Value() {
+			t.Errorf("Expected %s to be %d but got %d", name, value, ms.Get(name).Value())
+		}
+	}
+}
@@ -0,0 +1,9 @@
+-- add columns for rewritten answers
+ALTER TABLE buffer ADD COLUMN Rewritten BOOLEAN DEFAULT false;
+ALTER TABLE buffer ADD COLUMN RewriteList TEXT DEFAULT '';
+ALTER TABLE buffer ADD COLUMN RewriteRule TEXT DEFAULT '';
+
+-- add query log columns for rewritten answers
+ALTER TABLE qlog ADD COLUMN Rewritten BOOLEAN DEFAULT false;
+ALTER TABLE qlog ADD COLUMN RewriteList TEXT DEFAULT '';
+ALTER TABLE qlog ADD COLUMN RewriteRule TEXT DEFAULT '';
@@ -0,0 +1,5 @@
+-- add column for matches that were ignored while blocking was paused
+ALTER TABLE buffer ADD COLUMN Paused BOOLEAN DEFAULT false;
+
+-- add query log column for matches that were ignored while blocking was paused
+ALTER TABLE qlog ADD COLUMN Paused BOOLEAN DEFAULT false;
@@ -0,0 +1,73 @@
+-- nuke buffer and remake
+DROP TABLE buffer;
+CREATE TABLE buffer (
+    Id             INTEGER       PRIMARY KEY,
+    Address        TEXT          DEFAULT '',
+    Consumer       TEXT          DEFAULT '',
+    ClientName     TEXT          DEFAULT '',
+    RequestDomain  TEXT          DEFAULT '',
+    RequestType    TEXT          DEFAULT '',
+    ResponseText   TEXT          DEFAULT '',
+    Cached         BOOLEAN       DEFAULT false,
+    Blocked        BOOLEAN       DEFAULT false,
+    Match          INT           DEFAULT 0,
+    MatchList      TEXT          DEFAULT '',
+    MatchListShort TEXT          DEFAULT '',
+    MatchRule      TEXT          DEFAULT '',
+    Created        DATETIME,
+    StartTime      DATETIME,
+    EndTime        DATETIME,
+    Rcode          TEXT          DEFAULT '',
+    Rewritten      BOOLEAN       DEFAULT false,
+    RewriteList    TEXT          DEFAULT '',
+    RewriteRule    TEXT          DEFAULT '',
+    Paused         BOOLEAN       DEFAULT false
+);
+
+-- move old qlog table
+ALTER TABLE qlog RENAME TO _qlog_old;
+DROP INDEX idx_qlog_Address;
+DROP INDEX idx_qlog_RequestDomain;
+DROP INDEX idx_qlog_Match;
+DROP INDEX idx_qlog_Created;
+DROP INDEX idx_qlog_Cached;
+
+-- create qlog schema without the match cname column
+CREATE TABLE qlog (
+    Id             INTEGER       PRIMARY KEY,
+    Address        TEXT          DEFAULT '',
+    Consumer       TEXT          DEFAULT '',
+    ClientName     TEXT          DEFAULT '',
+    RequestDomain  TEXT          DEFAULT '',
+    RequestType    TEXT          DEFAULT '',
+    ResponseText   TEXT          DEFAULT '',
+    Cached         BOOLEAN       DEFAULT false,
+    Blocked        BOOLEAN       DEFAULT false,
+    Match          INT           DEFAULT 0,
+    MatchList      TEXT          DEFAULT '',
+    MatchListShort TEXT          DEFAULT '',
+    MatchRule      TEXT          DEFAULT '',
+    Created        DATETIME,
+    StartTime      DATETIME,
+    EndTime        DATETIME,
+    Rcode          TEXT          DEFAULT '',
+    Rewritten      BOOLEAN       DEFAULT false,
+    RewriteList    TEXT          DEFAULT '',
+    RewriteRule    TEXT          DEFAULT '',
+    Paused         BOOLEAN       DEFAULT false
+);
+
+-- create qlog index columns
+CREATE INDEX idx_qlog_Address ON qlog (Address);
+CREATE INDEX idx_qlog_RequestDomain ON qlog (RequestDomain);
+CREATE INDEX idx_qlog_Match ON qlog (Match);
+CREATE INDEX idx_qlog_Created ON qlog (Created);
+CREATE INDEX idx_qlog_Cached ON qlog (Cached);
+
+-- move records
+INSERT INTO qlog (Address, Consumer, ClientName, RequestDomain, RequestType, ResponseText, Cached, Blocked, Match, MatchList, MatchListShort, MatchRule, Created, StartTime, EndTime, Rcode, Rewritten, RewriteList, RewriteRule, Paused)
+    SELECT Address, Consumer, ClientName, RequestDomain, RequestType, ResponseText, Cached, Blocked, Match, MatchList, MatchListShort, MatchRule, Created, StartTime, EndTime, Rcode, Rewritten, RewriteList, RewriteRule, Paused
+    FROM _qlog_old;
+
+-- drop old table
+DROP TABLE _qlog_old;
@@ -0,0 +1,5 @@
+-- add column for the cname target that matched instead of the requested domain
+ALTER TABLE buffer ADD COLUMN MatchCname TEXT DEFAULT '';
+
+-- add query log column for the cname target that matched instead of the requested domain
+ALTER TABLE qlog ADD COLUMN MatchCname TEXT DEFAULT '';
@@ -0,0 +1 @@
+DROP TABLE custom_rules;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- allow and block rules added at runtime, loaded into the custom lists of each new engine
+CREATE TABLE custom_rules (
+    Id             INTEGER       PRIMARY KEY,
+    Rule           TEXT          DEFAULT '',
+    Type           TEXT          DEFAULT 'block',
+    Groups         TEXT          DEFAULT '',
+    Created        DATETIME,
+    Expires        DATETIME
+);
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// a pause turns off blocking for a consumer, a group, or (with neither) globally until it expires
+type Pause struct {
+	ID       string
+	Consumer string
+	Group    string
+	Created  time.Time
+	Until    time.Time
+}
+
+// true if the pause applies to every consumer and group
+func (pause *Pause) IsGlobal() bool {
+	return "" == pause.Consumer && "" == pause.Group
+}
+
+// true if the pause applies to the consumer or any of the groups at the given time
+func (pause *Pause) appliesTo(consumer string, groups []string, at time.Time) bool {
+	if at.Before(pause.Created) || !at.Before(pause.Until) {
+		return false
+	}
+	return pause.IsGlobal() || ("" != pause.Consumer && pause.Consumer == consumer) || ("" != pause.Group && util.StringIn(pause.Group, groups))
+}
+
+// the pauses are kept apart from the rest of the engine so that they can be handed to a new engine on reload
+type pauseList struct {
+	lock   sync.RWMutex
+	pauses []*Pause
+}
+
+func newPauseList() *pauseList {
+	return &pauseList{
+		pauses: make([]*Pause, 0),
+	}
+}
+
+// remove expired pauses, must hold the write lock
+func (pauses *pauseList) prune(at time.Time) {
+	active := pauses.pauses[:0]
+	for _, pause := range pauses.pauses {
+		if at.Before(pause.Until) {
+			active = append(active, pause)
+		}
+	}
+	pauses.pauses = active
+}
+
+func (pauses *pauseList) add(consumer string, group string, duration time.Duration) *Pause {
+	now := time.Now()
+	pause := &Pause{
+		ID:       uuid.New().String(),
+		Consumer: consumer,
+		Group:    group,
+		Created:  now,
+		Until:    now.Add(duration),
+	}
+
+	pauses.lock.Lock()
+	defer pauses.lock.Unlock()
+	pauses.prune(now)
+	pauses.pauses = append(pauses.pauses, pause)
+
+	return pause
+}
+
+// cancel the pause with the given id, an empty id cancels all pauses
+func (pauses *pauseList) cancel(id string) bool {
+	pauses.lock.Lock()
+	defer pauses.lock.Unlock()
+
+	if "" == id {
+		cancelled := len(pauses.pauses) > 0
+		pauses.pauses = make([]*Pause, 0)
+		return cancelled
+	}
+
+	for idx, pause := range pauses.pauses {
+		if pause.ID == id {
+			pauses.pauses = append(pauses.pauses[:idx], pauses.pauses[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// copies of the pauses that have not expired, ordered by when they expire
+func (pauses *pauseList) list() []*Pause {
+	pauses.lock.Lock()
+	defer pauses.lock.Unlock()
+	pauses.prune(time.Now())
+
+	list := make([]*Pause, 0, len(pauses.pauses))
+	for _, pause := range pauses.pauses {
+		copied := *pause
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Until.Before(list[j].Until)
+	})
+
+	return list
+}
+
+// the first pause that applies to the consumer or groups, nil if blocking is not paused
+func (pauses *pauseList) active(consumer string, groups []string, at time.Time) *Pause {
+	if pauses == nil {
+		return nil
+	}
+
+	pauses.lock.RLock()
+	defer pauses.lock.RUnlock()
+	for _, pause := range pauses.pauses {
+		if pause.appliesTo(consumer, groups, at) {
+			return pause
+		}
+	}
+	return nil
+}
+
+// pause blocking for the consumer, group, or (with neither) globally for the given duration
+func (engine *engine) Pause(consumer string, group string, duration time.Duration) (*Pause, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("A pause must have a positive duration")
+	}
+	if "" != consumer && "" != group {
+		return nil, fmt.Errorf("A pause can be for a consumer or a group but not both")
+	}
+	if _, found := engine.consumerMap[consumer]; "" != consumer && !found {
+		return nil, fmt.Errorf("No consumer named '%s' was found", consumer)
+	}
+	if _, found := engine.groups[group]; "" != group && !found {
+		return nil, fmt.Errorf("No group named '%s' was found", group)
+	}
+	return engine.pauses.add(consumer, group, duration), nil
+}
+
+func (engine *engine) Pauses() []*Pause {
+	return engine.pauses.list()
+}
+
+func (engine *engine) CancelPause(id string) bool {
+	return engine.pauses.cancel(id)
+}
+
+// engines that can hand their pauses to another engine
+type pauseKeeper interface {
+	sharedPauses() *pauseList
+}
+
+func (engine *engine) sharedPauses() *pauseList {
+	return engine.pauses
+}
+
+// use the pauses of another engine so that they survive a reload
+func (engine *engine) KeepPauses(from Engine) {
+	keeper, ok := from.(pauseKeeper)
+	if !ok {
+		return
+	}
+	if pauses := keeper.sharedPauses(); pauses != nil {
+		engine.pauses = pauses
+	}
+}
@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/resolver"
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestPauses(t *testing.T) {
+	config := testutil.Conf(t, "testdata/block-response.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer func() {
+		testEngine.Shutdown()
+	}()
+
+	// checks if one.blocked.com is blocked for the address and that a pause is noted if it isn't
+	blocked := func(ip string) bool {
+		request := new(dns.Msg)
+		request.SetQuestion("one.blocked.com.", dns.TypeA)
+		_, _, result := testEngine.Handle(parseIP(ip), "udp", request)
+		if result.Match != rule.MatchBlock && (!result.Paused || result.MatchList == nil) {
+			t.Errorf("Expected ignored match to be noted in result for %s", ip)
+		}
+		return result.Match == rule.MatchBlock
+	}
+
+	if !blocked("192.168.0.1") || !blocked("10.0.0.1") {
+		t.Errorf("Expected domain to be blocked before pausing")
+	}
+
+	// invalid pauses
+	if _, err := testEngine.Pause("nobody", "", time.Minute); err == nil {
+		t.Errorf("Expected error pausing unknown consumer")
+	}
+	if _, err := testEngine.Pause("", "nogroup", time.Minute); err == nil {
+		t.Errorf("Expected error pausing unknown group")
+	}
+	if _, err := testEngine.Pause("", "", 0); err == nil {
+		t.Errorf("Expected error pausing without a duration")
+	}
+
+	// group pause
+	groupPause, err := testEngine.Pause("", "refused", time.Minute)
+	if err != nil {
+		t.Errorf("Could not pause group: %s", err)
+		return
+	}
+	if blocked("10.0.0.1") || !blocked("192.168.0.1") {
+		t.Errorf("Expected only the paused group to be unblocked")
+	}
+
+	// consumer pause
+	consumerPause, err := testEngine.Pause("nodata", "", time.Minute)
+	if err != nil {
+		t.Errorf("Could not pause consumer: %s", err)
+		return
+	}
+	if blocked("10.0.0.2") || !blocked("192.168.0.1") {
+		t.Errorf("Expected only the paused consumer to be unblocked")
+	}
+	if len(testEngine.Pauses()) != 2 {
+		t.Errorf("Expected 2 pauses but found %d", len(testEngine.Pauses()))
+	}
+
+	// cancel pauses
+	if !testEngine.CancelPause(groupPause.ID) || !testEngine.CancelPause(consumerPause.ID) {
+		t.Errorf("Expected pauses to be cancelled")
+	}
+	if testEngine.CancelPause(groupPause.ID) {
+		t.Errorf("Expected cancelling a cancelled pause to fail")
+	}
+	if !blocked("10.0.0.1") || !blocked("10.0.0.2") {
+		t.Errorf("Expected domain to be blocked after cancelling pauses")
+	}
+
+	// pauses apply to the time of the request
+	requestAt := func(at time.Time) bool {
+		request := new(dns.Msg)
+		request.SetQuestion("one.blocked.com.", dns.TypeA)
+		rCon := resolver.DefaultRequestContext()
+		rCon.Time = at
+		_, _, result := testEngine.HandleWithConsumerName("nodata", rCon, request)
+		return result != nil && result.Match == rule.MatchBlock
+	}
+	timedPause, err := testEngine.Pause("nodata", "", time.Minute)
+	if err != nil {
+		t.Errorf("Could not pause consumer: %s", err)
+		return
+	}
+	if requestAt(time.Now()) || !requestAt(time.Now().Add(time.Hour)) || !requestAt(time.Now().Add(-time.Hour)) {
+		t.Errorf("Expected the consumer pause to only apply to requests while it is active")
+	}
+	testEngine.CancelPause(timedPause.ID)
+
+	// global pauses survive a reload
+	globalPause, err := testEngine.Pause("", "", time.Hour)
+	if err != nil {
+		t.Errorf("Could not pause globally: %s", err)
+		return
+	}
+	reloadedEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	reloadedEngine.KeepPauses(testEngine)
+	testEngine.Shutdown()
+	testEngine = reloadedEngine
+
+	if blocked("192.168.0.1") || blocked("10.0.0.1") {
+		t.Errorf("Expected global pause to unblock every consumer")
+	}
+	if !testEngine.CancelPause(globalPause.ID) {
+		t.Errorf("Expected global pause to be cancelled")
+	}
+
+	// pauses expire
+	if _, err := testEngine.Pause("", "", 50*time.Millisecond); err != nil {
+		t.Errorf("Could not pause globally: %s", err)
+		return
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !blocked("192.168.0.1") {
+		t.Errorf("Expected domain to be blocked after the pause expired")
+	}
+	if len(testEngine.Pauses()) != 0 {
+		t.Errorf("Expected expired pauses to be removed")
+	}
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"sort"
+	"time"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+// a list that is checked for a domain with the priority it is checked at and the groups that use it
+type prioritizedList struct {
+	list     *config.GudgeonList
+	priority int
+	groups   []string
+	// custom lists are checked on their own before the lists of the groups with the same priority
+	custom bool
+}
+
+// the priority of the named group, zero if there is no such group
+func (engine *engine) groupPriority(groupName string) int {
+	if group, found := engine.groups[groupName]; found && group.configGroup != nil {
+		return group.configGroup.Priority
+	}
+	return 0
+}
+
+// add the list used by the group, a list used by more than one group is only added once
+func (engine *engine) addPrioritizedList(prioritized []*prioritizedList, list *config.GudgeonList, groupName string) []*prioritizedList {
+	for _, existing := range prioritized {
+		if existing.list == list {
+			existing.groups = append(existing.groups, groupName)
+			return prioritized
+		}
+	}
+	return append(prioritized, &prioritizedList{list: list, groups: []string{groupName}})
+}
+
+// the custom lists and the active allow/block lists of the groups in the order they are checked: the highest priority
+// first and then (with the same priority) the custom lists and the lists in group order, a list without its own priority
+// has the highest priority of the groups that use it
+func (engine *engine) domainListsForGroups(groups []string, at time.Time) []*prioritizedList {
+	prioritized := make([]*prioritizedList, 0)
+	for _, list := range engine.customListsForGroups(groups) {
+		// the custom lists made for every group are used by all of them
+		listGroups := groups
+		for _, groupName := range groups {
+			if engine.customLists[customListKey(list.Type, groupName)] == list {
+				listGroups = []string{groupName}
+			}
+		}
+		for _, groupName := range listGroups {
+			prioritized = engine.addPrioritizedList(prioritized, list, groupName)
+		}
+	}
+	for _, list := range prioritized {
+		list.custom = true
+	}
+	for _, groupName := range groups {
+		if group, found := engine.groups[groupName]; found {
+			for _, list := range group.activeLists(group.lists, at) {
+				prioritized = engine.addPrioritizedList(prioritized, list, groupName)
+			}
+		}
+	}
+
+	for _, list := range prioritized {
+		if list.list.Priority != nil {
+			list.priority = *list.list.Priority
+			continue
+		}
+		for idx, groupName := range list.groups {
+			if priority := engine.groupPriority(groupName); idx == 0 || priority > list.priority {
+				list.priority = priority
+			}
+		}
+	}
+	sort.SliceStable(prioritized, func(i, j int) bool {
+		return prioritized[i].priority > prioritized[j].priority
+	})
+
+	return prioritized
+}
+
+// the lists split into the groups of lists with the same priority, in the order they are checked, the custom lists of a
+// priority are a group of their own so that a custom block rule wins over the allow lists of the groups
+func priorityTiers(prioritized []*prioritizedList) [][]*config.GudgeonList {
+	tiers := make([][]*config.GudgeonList, 0, 1)
+	for idx, list := range prioritized {
+		if idx == 0 || list.priority != prioritized[idx-1].priority || list.custom != prioritized[idx-1].custom {
+			tiers = append(tiers, make([]*config.GudgeonList, 0, len(prioritized)-idx))
+		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], list.list)
+	}
+	return tiers
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestListPriority(t *testing.T) {
+	config := testutil.Conf(t, "testdata/priority.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	check := func(ip string, domain string, expected rule.Match, expectedList string) {
+		match, list, _ := testEngine.IsDomainRuleMatched(parseIP(ip), domain)
+		listName := ""
+		if list != nil {
+			listName = list.CanonicalName()
+		}
+		if match != expected || listName != expectedList {
+			t.Errorf("Expected %s to have match %d from list '%s' for %s but got %d from list '%s'", domain, expected, expectedList, ip, match, listName)
+		}
+	}
+
+	// a block list with a higher priority wins over an allow list
+	check("192.168.0.1", "www.social.com", rule.MatchBlock, "corporate")
+	// allow lists win over block lists with the same priority
+	check("192.168.0.1", "news.com", rule.MatchAllow, "general allow")
+	check("192.168.0.1", "ads.com", rule.MatchBlock, "general block")
+	// lists without a priority have the priority of their group
+	check("10.0.0.1", "news.com", rule.MatchBlock, "strict block")
+	check("10.0.0.1", "social.com", rule.MatchBlock, "corporate")
+
+	// the order the lists are checked in is explained
+	explanation := testEngine.Explain("strict", "news.com")
+	order := make([]string, 0)
+	for _, list := range explanation.Lists {
+		if !list.Custom {
+			order = append(order, list.List)
+		}
+	}
+	if strings.Join(order, ", ") != "corporate, strict block, general allow, general block" {
+		t.Errorf("Expected lists to be checked by priority but the order was: %s", strings.Join(order, ", "))
+	}
+	if explanation.Winner == nil || explanation.Winner.List != "strict block" || explanation.Winner.Priority != 10 {
+		t.Errorf("Expected the strict block list to win with priority 10")
+	}
+	if !strings.Contains(explanation.Reason, "priority of 10 is higher than the priority of the other 2 matching rules") {
+		t.Errorf("Expected the reason to explain the priority but it was: %s", explanation.Reason)
+	}
+
+	// custom rules have the priority of their group so a list with a higher priority wins over them
+	if _, err := testEngine.AddCustomRule("social.com", "allow", []string{"default"}, 0); err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+	}
+	check("192.168.0.1", "www.social.com", rule.MatchBlock, "corporate")
+	explanation = testEngine.Explain("", "www.social.com")
+	customMatched := false
+	for _, match := range explanation.Matches {
+		customMatched = customMatched || (match.Custom && match.Priority == 0)
+	}
+	if !customMatched || explanation.Winner == nil || explanation.Winner.Custom || explanation.Winner.List != "corporate" {
+		t.Errorf("Expected the corporate list to win over the matching custom rule")
+	}
+	if !strings.Contains(explanation.Reason, "priority of 100 is higher than the priority of the other 2 matching rules") {
+		t.Errorf("Expected the reason to explain the priority over the custom rule but it was: %s", explanation.Reason)
+	}
+
+	// a custom rule is explained with the priority it is checked at
+	if _, err := testEngine.AddCustomRule("ads.com", "allow", []string{"default"}, 0); err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+	}
+	explanation = testEngine.Explain("", "ads.com")
+	if explanation.Winner == nil || !explanation.Winner.Custom || explanation.Match != rule.MatchAllow {
+		t.Errorf("Expected the custom rule to allow the domain")
+	} else if !strings.Contains(explanation.Reason, "first matching allow rule with priority 0") {
+		t.Errorf("Expected the reason to explain the priority of the custom rule but it was: %s", explanation.Reason)
+	}
+
+	// custom rules are checked before the lists with the same priority so a custom block wins over an allow list
+	if _, err := testEngine.AddCustomRule("news.com", "block", []string{"default"}, 0); err != nil {
+		t.Errorf("Could not add custom rule: %s", err)
+	}
+	match, list, _ := testEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), "news.com")
+	if match != rule.MatchBlock || list == nil || list.CanonicalName() == "general allow" {
+		t.Errorf("Expected the custom block rule to win over the allow list with the same priority")
+	}
+	explanation = testEngine.Explain("", "news.com")
+	if explanation.Winner == nil || !explanation.Winner.Custom || !strings.Contains(explanation.Reason, "(2 rules in the lists of the groups with the same priority also match)") {
+		t.Errorf("Expected the reason to explain the custom block over the allow list but it was: %s", explanation.Reason)
+	}
+}
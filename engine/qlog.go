@@ -17,7 +17,7 @@ import (
 )
 
 // lit of valid sort names (lower case for ease of use with util.StringIn)
-var validSorts = []string{"address", "connectiontype", "requestdomain", "requesttype", "blocked", "blockedlist", "blockedrule", "created"}
+var validSorts = []string{"address", "connectiontype", "requestdomain", "requesttype", "blocked", "blockedlist", "blockedrule", "paused", "rewritten", "created"}
 
 // allows a dependency injection-way of defining a reverse lookup function, takes a string address (should be an IP) and returns a string that contains the domain name result
 type ReverseLookupFunction = func(addres string) string
@@ -34,6 +34,8 @@ type QueryLogQuery struct {
 	RequestType    string
 	ResponseText   string
 	Blocked        *bool
+	Paused         *bool
+	Rewritten      *bool
 	Cached         *bool
 	Match          *rule.Match
 	// query on created time
@@ -128,7 +130,7 @@ func (qlog *qlog) prune(tx *sql.Tx) {
 }
 
 func (qlog *qlog) flush(tx *sql.Tx) {
-	_, err := tx.Exec("INSERT INTO qlog (Address, Consumer, ClientName, RequestDomain, RequestType, ResponseText, Rcode, Cached, Blocked, Match, MatchList, MatchRule, Created) SELECT Address, Consumer, ClientName, RequestDomain, RequestType, ResponseText, Rcode, Cached, Blocked, Match, MatchList, MatchRule, Created FROM buffer WHERE true")
+	_, err := tx.Exec("INSERT INTO qlog (Address, Consumer, ClientName, RequestDomain, RequestType, ResponseText, Rcode, Cached, Blocked, Match, MatchList, MatchRule, MatchCname, Paused, Rewritten, RewriteList, RewriteRule, Created) SELECT Address, Consumer, ClientName, RequestDomain, RequestType, ResponseText, Rcode, Cached, Blocked, Match, MatchList, MatchRule, MatchCname, Paused, Rewritten, RewriteList, RewriteRule, Created FROM buffer WHERE true")
 	if err != nil {
 		log.Errorf("Could not flush query log data: %s", err)
 		return
@@ -183,7 +185,32 @@ func (qlog *qlog) log(info *InfoRecord) {
 		fields["rcode"] = info.Rcode
 	}
 
-	if response.Rcode == dns.RcodeServerFailure {
+	if response == nil {
+		// dropped requests are not answered
+		builder.WriteString("DROPPED")
+		if result != nil && result.MatchList != nil {
+			builder.WriteString("[")
+			builder.WriteString(result.MatchList.CanonicalName())
+			if result.MatchRule != "" {
+				builder.WriteString("|")
+				builder.WriteString(result.MatchRule)
+			}
+			builder.WriteString("]")
+			if qlog.fileLogger != nil {
+				fields["matchList"] = result.MatchList.CanonicalName()
+				fields["matchRule"] = result.MatchRule
+			}
+		}
+		if qlog.fileLogger != nil {
+			fields["dropped"] = "true"
+			qlog.fileLogger.WithFields(fields).Info("DROPPED")
+		}
+		if qlog.stdLogger != nil {
+			qlog.stdLogger.Info(builder.String())
+		}
+
+		return
+	} else if response.Rcode == dns.RcodeServerFailure {
 		// write as error and return
 		if qlog.fileLogger != nil {
 			qlog.fileLogger.WithFields(fields).Error(fmt.Sprintf("SERVFAIL:[%s]", result.Message))
@@ -216,6 +243,13 @@ func (qlog *qlog) log(info *InfoRecord) {
 						fields["matchRule"] = result.MatchRule
 					}
 				}
+				if result.MatchCname != "" {
+					builder.WriteString("|CNAME ")
+					builder.WriteString(result.MatchCname)
+					if qlog.fileLogger != nil {
+						fields["matchCname"] = result.MatchCname
+					}
+				}
 				builder.WriteString("]")
 			}
 		} else {
@@ -225,7 +259,62 @@ func (qlog *qlog) log(info *InfoRecord) {
 					fields["matchType"] = "ALLOWED"
 				}
 			}
-			if result.Cached {
+			if result.Paused {
+				builder.WriteString("PAUSED")
+				if qlog.fileLogger != nil {
+					fields["paused"] = "true"
+				}
+				if result.MatchList != nil {
+					builder.WriteString("[")
+					builder.WriteString(result.MatchList.CanonicalName())
+					if qlog.fileLogger != nil {
+						fields["matchList"] = result.MatchList.CanonicalName()
+					}
+					if result.MatchRule != "" {
+						builder.WriteString("|")
+						builder.WriteString(result.MatchRule)
+						if qlog.fileLogger != nil {
+							fields["matchRule"] = result.MatchRule
+						}
+					}
+					if result.MatchCname != "" {
+						builder.WriteString("|CNAME ")
+						builder.WriteString(result.MatchCname)
+						if qlog.fileLogger != nil {
+							fields["matchCname"] = result.MatchCname
+						}
+					}
+					builder.WriteString("]")
+				}
+				builder.WriteString("->")
+			}
+			if result.RebindExempt {
+				builder.WriteString("REBIND EXEMPT->")
+				if qlog.fileLogger != nil {
+					fields["rebindExempt"] = "true"
+				}
+			}
+			if result.Rewritten {
+				builder.WriteString("REWRITTEN")
+				if qlog.fileLogger != nil {
+					fields["rewritten"] = "true"
+				}
+				if result.RewriteList != nil {
+					builder.WriteString("[")
+					builder.WriteString(result.RewriteList.CanonicalName())
+					if qlog.fileLogger != nil {
+						fields["rewriteList"] = result.RewriteList.CanonicalName()
+					}
+					if result.RewriteRule != "" {
+						builder.WriteString("|")
+						builder.WriteString(result.RewriteRule)
+						if qlog.fileLogger != nil {
+							fields["rewriteRule"] = result.RewriteRule
+						}
+					}
+					builder.WriteString("]")
+				}
+			} else if result.Cached {
 				builder.WriteString("c:[")
 				builder.WriteString(result.Resolver)
 				builder.WriteString("]")
@@ -293,7 +382,7 @@ func (qlog *qlog) query(query *QueryLogQuery, accumulator queryAccumulator) {
 	}
 
 	// select entries from qlog
-	selectStmt := "SELECT Address, ClientName, Consumer, RequestDomain, RequestType, ResponseText, Rcode, Blocked, Match, MatchList, MatchRule, Cached, Created FROM qlog"
+	selectStmt := "SELECT Address, ClientName, Consumer, RequestDomain, RequestType, ResponseText, Rcode, Blocked, Match, MatchList, MatchRule, MatchCname, Paused, Rewritten, RewriteList, RewriteRule, Cached, Created FROM qlog"
 	countStmt := "SELECT COUNT(*) FROM qlog"
 
 	// so we can dynamically build the where clause
@@ -332,6 +421,16 @@ func (qlog *qlog) query(query *QueryLogQuery, accumulator queryAccumulator) {
 		whereValues = append(whereValues, query.Blocked)
 	}
 
+	if query.Paused != nil {
+		whereClauses = append(whereClauses, "Paused = ?")
+		whereValues = append(whereValues, query.Paused)
+	}
+
+	if query.Rewritten != nil {
+		whereClauses = append(whereClauses, "Rewritten = ?")
+		whereValues = append(whereValues, query.Rewritten)
+	}
+
 	if query.Match != nil {
 		whereClauses = append(whereClauses, "Match = ?")
 		whereValues = append(whereValues, query.Match)
@@ -423,7 +522,7 @@ func (qlog *qlog) query(query *QueryLogQuery, accumulator queryAccumulator) {
 	var info *InfoRecord
 	for rows.Next() {
 		info = &InfoRecord{}
-		err = rows.Scan(&info.Address, &info.ClientName, &info.Consumer, &info.RequestDomain, &info.RequestType, &info.ResponseText, &info.Rcode, &info.Blocked, &info.Match, &info.MatchList, &info.MatchRule, &info.Cached, &info.Created)
+		err = rows.Scan(&info.Address, &info.ClientName, &info.Consumer, &info.RequestDomain, &info.RequestType, &info.ResponseText, &info.Rcode, &info.Blocked, &info.Match, &info.MatchList, &info.MatchRule, &info.MatchCname, &info.Paused, &info.Rewritten, &info.RewriteList, &info.RewriteRule, &info.Cached, &info.Created)
 		if err != nil {
 			log.Errorf("Scanning qlog results: %s", err)
 			continue
@@ -84,6 +84,11 @@ func TestQueryLogQuery(t *testing.T) {
 			msg.MatchRule = "*"
 			msg.MatchList = "testlist"
 		}
+		if i%5 == 1 { // rewrite one fifth of queries
+			msg.Rewritten = true
+			msg.RewriteList = "safesearch-strict"
+			msg.RewriteRule = "google.com forcesafesearch.google.com"
+		}
 		if i%20 == 0 {
 			msg.RequestDomain = "netflix.com."
 		} else {
@@ -136,6 +141,21 @@ func TestQueryLogQuery(t *testing.T) {
 		t.Errorf("Match query returned unexpected results: %d but expected %d", len(results), totalEntries/4)
 	}
 
+	// query rewritten entries
+	rewritten := true
+	query = &QueryLogQuery{
+		Rewritten: &rewritten,
+	}
+	results, _ = qlog.Query(query)
+	if len(results) != totalEntries/5 {
+		t.Errorf("Rewritten query returned unexpected results: %d but expected %d", len(results), totalEntries/5)
+	}
+	for _, result := range results {
+		if !result.Rewritten || "safesearch-strict" != result.RewriteList {
+			t.Errorf("Expected rewritten result from safesearch-strict but got %t from '%s'", result.Rewritten, result.RewriteList)
+		}
+	}
+
 	// query by query type and rule matched with limit
 	query = &QueryLogQuery{
 		Match:       &ptrMatch,
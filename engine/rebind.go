@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/resolver"
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// rejects answers for public names that resolve to private addresses unless the domain or resolver is exempt
+type rebindProtection struct {
+	// the block-ip list with the private networks
+	list *config.GudgeonList
+
+	// exempt domains (with their subdomains) and wildcards
+	exemptDomains []string
+	exemptRules   []rule.ComplexRule
+
+	// exempt resolvers
+	exemptResolvers []string
+}
+
+func newRebindProtection(conf *config.GudgeonRebindProtection, ips *rule.IPStore) *rebindProtection {
+	rebind := &rebindProtection{
+		list:            ips.LoadRebind(),
+		exemptDomains:   make([]string, 0),
+		exemptRules:     make([]rule.ComplexRule, 0),
+		exemptResolvers: make([]string, 0),
+	}
+	if conf == nil {
+		return rebind
+	}
+
+	for _, domain := range conf.ExemptDomains {
+		if rule.IsComplex(domain) {
+			if complexRule := rule.CreateComplexRule(domain); complexRule != nil {
+				rebind.exemptRules = append(rebind.exemptRules, complexRule)
+			}
+		} else if "" != domain {
+			rebind.exemptDomains = append(rebind.exemptDomains, domain)
+		}
+	}
+	rebind.exemptResolvers = append(rebind.exemptResolvers, conf.ExemptResolvers...)
+
+	return rebind
+}
+
+// true if the answer for the domain (from the resolver and source in the result) may have private addresses, names
+// without a dot and answers from local hosts or zone files are never public
+func (rebind *rebindProtection) isExempt(domain string, result *resolver.ResolutionResult) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if !strings.Contains(domain, ".") {
+		return true
+	}
+
+	if result != nil && (resolver.IsLocalSource(result.Source) || util.StringIn(result.Resolver, rebind.exemptResolvers)) {
+		return true
+	}
+
+	for _, parent := range util.DomainList(domain) {
+		if util.StringIn(parent, rebind.exemptDomains) {
+			return true
+		}
+	}
+	for _, complexRule := range rebind.exemptRules {
+		if complexRule.IsMatch(domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// true if any of the groups uses rebind protection, a group setting overrides the global setting
+func (engine *engine) rebindProtected(groups []string) bool {
+	if engine.rebind == nil {
+		return false
+	}
+	for _, g := range groups {
+		group, found := engine.groups[g]
+		if !found {
+			continue
+		}
+		if group.configGroup.RebindProtection != nil {
+			if *group.configGroup.RebindProtection {
+				return true
+			}
+		} else if engine.config.RebindProtection != nil && engine.config.RebindProtection.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// the network (as rule text) of the first private address in the response, empty if there is none
+func (engine *engine) rebindNetwork(response *dns.Msg) string {
+	engine.storeLock.RLock()
+	defer engine.storeLock.RUnlock()
+
+	for _, address := range answerAddresses(response) {
+		if list, ruleText := engine.ips.FindIP([]*config.GudgeonList{engine.rebind.list}, address); list != nil {
+			return ruleText
+		}
+	}
+	return ""
+}
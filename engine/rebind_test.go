@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestRebindProtection(t *testing.T) {
+	// a server that stands in for the upstream and lan servers
+	answers := map[string]string{
+		"public.com.":           "93.184.216.34",
+		"rebind.com.":           "192.168.1.1",
+		"loopback.com.":         "127.0.0.1",
+		"cgnat.com.":            "100.64.0.1",
+		"linklocal.com.":        "169.254.1.1",
+		"ula.com.":              "fd00::1",
+		"nas.home.arpa.":        "192.168.1.2",
+		"vpn.corp.example.com.": "10.1.1.1",
+		"printer.lan.":          "192.168.1.3",
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Errorf("Could not listen for dns: %s", err)
+		return
+	}
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		response := new(dns.Msg)
+		response.SetReply(r)
+		question := r.Question[0]
+		if ip := net.ParseIP(answers[question.Name]); ip != nil {
+			header := dns.RR_Header{Name: question.Name, Class: dns.ClassINET, Ttl: 60}
+			if ipv4 := ip.To4(); ipv4 != nil && question.Qtype == dns.TypeA {
+				header.Rrtype = dns.TypeA
+				response.Answer = append(response.Answer, &dns.A{Hdr: header, A: ipv4})
+			} else if ipv4 == nil && question.Qtype == dns.TypeAAAA {
+				header.Rrtype = dns.TypeAAAA
+				response.Answer = append(response.Answer, &dns.AAAA{Hdr: header, AAAA: ip})
+			}
+		}
+		w.WriteMsg(response)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	config := testutil.Conf(t, "testdata/rebind.yml")
+	defer os.RemoveAll(config.Home)
+	for _, name := range []string{"lan", "upstream"} {
+		config.GetResolver(name).Sources = []string{conn.LocalAddr().String()}
+	}
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer func() { engine.Shutdown() }()
+
+	data := []struct {
+		ip       string
+		domain   string
+		qType    uint16
+		expected string
+		exempt   bool
+	}{
+		// public names with private addresses are rejected
+		{"192.168.0.1", "rebind.com", dns.TypeA, "192.168.0.0/16", false},
+		{"192.168.0.1", "loopback.com", dns.TypeA, "127.0.0.0/8", false},
+		{"192.168.0.1", "cgnat.com", dns.TypeA, "100.64.0.0/10", false},
+		{"192.168.0.1", "linklocal.com", dns.TypeA, "169.254.0.0/16", false},
+		{"192.168.0.1", "ula.com", dns.TypeAAAA, "fc00::/7", false},
+		{"192.168.0.1", "public.com", dns.TypeA, "", false},
+		// exempt domains, resolvers, and local hosts
+		{"192.168.0.1", "nas.home.arpa", dns.TypeA, "", true},
+		{"192.168.0.1", "vpn.corp.example.com", dns.TypeA, "", true},
+		{"192.168.0.1", "printer.lan", dns.TypeA, "", true},
+		{"192.168.0.1", "hosted.com", dns.TypeA, "", true},
+		// groups can turn off rebind protection
+		{"10.0.0.1", "rebind.com", dns.TypeA, "", false},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(dns.Fqdn(d.domain), d.qType)
+
+		response, _, result := engine.Handle(parseIP(d.ip), "udp", request)
+		if response == nil || result == nil {
+			t.Errorf("No response for %s from %s", d.domain, d.ip)
+			continue
+		}
+		if result.RebindExempt != d.exempt {
+			t.Errorf("Expected rebind exempt to be %t for %s from %s", d.exempt, d.domain, d.ip)
+		}
+		if "" == d.expected {
+			if result.Rebind || result.Match == rule.MatchBlock || len(response.Answer) < 1 {
+				t.Errorf("Expected answer for %s from %s but it was rejected", d.domain, d.ip)
+			}
+			continue
+		}
+		if !result.Rebind || result.Match != rule.MatchBlock || result.MatchRule != d.expected {
+			t.Errorf("Expected %s from %s to be rejected for network %s but got '%s'", d.domain, d.ip, d.expected, result.MatchRule)
+		}
+		if len(response.Answer) > 0 {
+			t.Errorf("Expected no answers for %s from %s but got %s", d.domain, d.ip, response.Answer[0])
+		}
+	}
+
+	// the rejected and exempt answers are counted
+	metrics := engine.Metrics()
+	for wait := 0; wait < 200 && metrics.Get(RebindExemptQueries).Value() < 4; wait++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if blocked := metrics.Get(RebindBlockedQueries).Value(); blocked != 5 {
+		t.Errorf("Expected 5 rejected answers to be counted but got %d", blocked)
+	}
+	if exempt := metrics.Get(RebindExemptQueries).Value(); exempt != 4 {
+		t.Errorf("Expected 4 exempt answers to be counted but got %d", exempt)
+	}
+}
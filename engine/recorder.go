@@ -23,7 +23,7 @@ const (
 	recordQueueSize = 100000
 
 	// single instance of insert statement used for inserting into the "buffer"
-	bufferInsertStatement = "INSERT INTO buffer (Address, ClientName, Consumer, RequestDomain, RequestType, ResponseText, Rcode, Blocked, Match, MatchList, MatchListShort, MatchRule, Cached, Created) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	bufferInsertStatement = "INSERT INTO buffer (Address, ClientName, Consumer, RequestDomain, RequestType, ResponseText, Rcode, Blocked, Match, MatchList, MatchListShort, MatchRule, MatchCname, Paused, Rewritten, RewriteList, RewriteRule, Cached, Created) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 )
 
 // coordinates all recording functions/features
@@ -44,6 +44,8 @@ type recorder struct {
 	// cache lookup info
 	cache     *cache.Cache
 	mdnsCache *cache.Cache
+	// closed to stop listening for mdns messages
+	mdnsStop chan bool
 
 	// reference to subordinate components
 	qlog    QueryLog
@@ -83,6 +85,15 @@ type InfoRecord struct {
 	MatchList      string
 	MatchListShort string
 	MatchRule      string
+	MatchCname     string
+
+	// a block match was ignored because blocking was paused
+	Paused bool
+
+	// rewritten answers
+	Rewritten   bool
+	RewriteList string
+	RewriteRule string
 
 	// cached in resolver cache store
 	Cached bool
@@ -97,7 +108,7 @@ type InfoRecord struct {
 func NewRecorder(engine *engine) (*recorder, error) {
 	recorder := &recorder{
 		engine:    engine,
-		db:        engine.db,
+		db:        engine.queryDB,
 		conf:      engine.config,
 		qlog:      engine.qlog,
 		metrics:   engine.metrics,
@@ -113,7 +124,8 @@ func NewRecorder(engine *engine) (*recorder, error) {
 
 			// create background channel for listening
 			msgChan := make(chan *dns.Msg)
-			go MulticastMdnsListen(msgChan)
+			recorder.mdnsStop = make(chan bool)
+			go MulticastMdnsListen(msgChan, recorder.mdnsStop)
 			go CacheMulticastMessages(recorder.mdnsCache, msgChan)
 		}
 	}
@@ -231,12 +243,22 @@ func (recorder *recorder) condition(info *InfoRecord) {
 		}
 
 		info.Match = info.Result.Match
-		if info.Result.Match != rule.MatchNone {
+		info.Paused = info.Result.Paused
+		if info.Result.Match != rule.MatchNone || info.Result.Paused {
 			if info.Result.MatchList != nil {
 				info.MatchList = info.Result.MatchList.CanonicalName()
 				info.MatchListShort = info.Result.MatchList.ShortName()
 			}
 			info.MatchRule = info.Result.MatchRule
+			info.MatchCname = info.Result.MatchCname
+		}
+
+		if info.Result.Rewritten {
+			info.Rewritten = true
+			if info.Result.RewriteList != nil {
+				info.RewriteList = info.Result.RewriteList.CanonicalName()
+			}
+			info.RewriteRule = info.Result.RewriteRule
 		}
 	}
 
@@ -407,7 +429,7 @@ func (recorder *recorder) buffer(info *InfoRecord) {
 	}
 
 	// insert into buffer table
-	_, err = recorder.tx.Exec(bufferInsertStatement, info.Address, info.ClientName, info.Consumer, info.RequestDomain, info.RequestType, info.ResponseText, info.Rcode, info.Blocked, info.Match, info.MatchList, info.MatchListShort, info.MatchRule, info.Cached, info.Created)
+	_, err = recorder.tx.Exec(bufferInsertStatement, info.Address, info.ClientName, info.Consumer, info.RequestDomain, info.RequestType, info.ResponseText, info.Rcode, info.Blocked, info.Match, info.MatchList, info.MatchListShort, info.MatchRule, info.MatchCname, info.Paused, info.Rewritten, info.RewriteList, info.RewriteRule, info.Cached, info.Created)
 	if err != nil {
 		log.Errorf("Insert into buffer: %s", err)
 	}
@@ -467,6 +489,11 @@ func (recorder *recorder) shutdown() {
 	infoQueue := recorder.infoQueue
 	recorder.infoQueue = nil
 
+	// stop listening for mdns messages, the caching goroutine ends when the listener closes the message channel
+	if recorder.mdnsStop != nil {
+		close(recorder.mdnsStop)
+	}
+
 	// signal done
 	recorder.doneChan <- true
 	<-recorder.doneChan
@@ -0,0 +1,312 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/rule"
+)
+
+// the stores built from the rules in the configured lists, they are replaced together when a list is refreshed
+type listStores struct {
+	store    rule.RuleStore
+	rewrites *rule.RewriteStore
+	ips      *rule.IPStore
+	rpz      *rule.RPZStore
+
+	// the number of rules loaded and skipped for each configured list (in order)
+	counts  []uint64
+	skipped []uint64
+
+	// the cached copies of the lists (by name) that the stores were built from
+	files map[string]os.FileInfo
+}
+
+// create the stores for the configured lists in the given directory, the lists must already be downloaded
+func createListStores(conf *config.GudgeonConfig, storeRoot string) *listStores {
+	stores := &listStores{files: make(map[string]os.FileInfo)}
+
+	// downloads replace the cached copy with a new file so the copy that is read can be told apart from a copy that
+	// replaces it later (like one downloaded by the refresher of another engine during a reload)
+	for _, list := range conf.Lists {
+		if info, err := os.Stat(conf.PathToList(list)); err == nil {
+			stores.files[list.CanonicalName()] = info
+		}
+	}
+
+	stores.store, stores.counts, stores.skipped = rule.CreateStore(storeRoot, conf)
+
+	// rewrites are kept apart from the allow/block rules, their counts are added to the list counts
+	var rewriteCounts []uint64
+	stores.rewrites, rewriteCounts = rule.CreateRewriteStore(conf)
+	for idx := range stores.counts {
+		stores.counts[idx] += rewriteCounts[idx]
+	}
+
+	// addresses from block-ip lists are checked against answers and kept in their own store
+	var ipCounts []uint64
+	stores.ips, ipCounts = rule.CreateIPStore(conf)
+	for idx := range stores.counts {
+		stores.counts[idx] += ipCounts[idx]
+	}
+
+	// response policy zones have their own store, rules that can't be used are counted as skipped
+	var rpzCounts, rpzSkippedCounts []uint64
+	stores.rpz, rpzCounts, rpzSkippedCounts = rule.CreateRPZStore(conf)
+	for idx := range stores.counts {
+		stores.counts[idx] += rpzCounts[idx]
+		stores.skipped[idx] += rpzSkippedCounts[idx]
+	}
+
+	// the rebind networks and safe search rewrites are loaded into every new store
+	stores.ips.LoadRebind()
+	for _, group := range conf.Groups {
+		if group.SafeSearch {
+			stores.rewrites.LoadSafeSearch(group.SafeSearchYouTube)
+		}
+	}
+
+	return stores
+}
+
+// set the rule counts for each list (and the total) in the metrics
+func (engine *engine) updateListMetrics(counts []uint64, skipped []uint64) {
+	if engine.metrics == nil {
+		return
+	}
+
+	totalCount := uint64(0)
+	for idx, list := range engine.config.Lists {
+		log.Infof("List '%s' loaded %d rules", list.CanonicalName(), counts[idx])
+		rulesCounter := engine.metrics.Get("rules-list-" + list.ShortName())
+		rulesCounter.Clear()
+		rulesCounter.Inc(int64(counts[idx]))
+		skippedCounter := engine.metrics.Get("rules-skipped-list-" + list.ShortName())
+		skippedCounter.Clear()
+		skippedCounter.Inc(int64(skipped[idx]))
+		totalCount += counts[idx]
+	}
+	totalRulesCounter := engine.metrics.Get(TotalRules)
+	totalRulesCounter.Clear()
+	totalRulesCounter.Inc(int64(totalCount))
+}
+
+// set the rule count of a list that was updated in place, the total changes by the difference
+func (engine *engine) updateListMetric(list *config.GudgeonList, count uint64, skipped uint64) {
+	if engine.metrics == nil {
+		return
+	}
+
+	log.Infof("List '%s' loaded %d rules", list.CanonicalName(), count)
+	rulesCounter := engine.metrics.Get("rules-list-" + list.ShortName())
+	engine.metrics.Get(TotalRules).Inc(int64(count) - rulesCounter.Value())
+	rulesCounter.Set(int64(count))
+	engine.metrics.Get("rules-skipped-list-" + list.ShortName()).Set(int64(skipped))
+}
+
+// replace the stores used by the engine, the old rule store is closed once no request can be using it
+func (engine *engine) swapStores(stores *listStores, storeRoot string) {
+	engine.storeLock.Lock()
+	oldStore, oldRoot := engine.store, engine.storeRoot
+	engine.store = stores.store
+	engine.rewrites = stores.rewrites
+	engine.ips = stores.ips
+	engine.rpz = stores.rpz
+	engine.storeRoot = storeRoot
+	engine.listFiles = stores.files
+	// custom rules are kept in the engine and loaded into each new store
+	for _, customRule := range engine.customRules {
+		engine.storeCustomRule(customRule)
+	}
+	engine.storeLock.Unlock()
+
+	if oldStore != nil {
+		oldStore.Close()
+	}
+	// the first store is in the session root which is removed on shutdown
+	if "" != oldRoot && engine.Root() != oldRoot {
+		os.RemoveAll(oldRoot)
+	}
+}
+
+// downloads remote lists again on their refresh intervals and rebuilds the stores when a list changes
+type listRefresher struct {
+	engine *engine
+
+	// only one rebuild runs at a time and none run after shutdown
+	lock    sync.Mutex
+	stopped bool
+	stop    chan bool
+
+	// the number of rebuilds, each new store is built in its own directory
+	generation int
+}
+
+// start refreshing each remote list that has a refresh interval
+func newListRefresher(engine *engine) *listRefresher {
+	refresher := &listRefresher{
+		engine: engine,
+		stop:   make(chan bool),
+	}
+
+	for _, list := range engine.config.Lists {
+		if interval := list.RefreshInterval(); interval > 0 {
+			go refresher.run(list, interval)
+		}
+	}
+
+	return refresher
+}
+
+// the time until the list should be refreshed, based on when the cached copy was last downloaded
+func untilRefresh(path string, interval time.Duration) time.Duration {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if until := interval - time.Since(info.ModTime()); until > 0 {
+		return until
+	}
+	return 0
+}
+
+func (refresher *listRefresher) run(list *config.GudgeonList, interval time.Duration) {
+	timer := time.NewTimer(untilRefresh(refresher.engine.config.PathToList(list), interval))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-refresher.stop:
+			return
+		case <-timer.C:
+			refresher.refresh(list)
+			timer.Reset(interval)
+		}
+	}
+}
+
+// true if the cached copy of the list is not the copy the stores were built from
+func (engine *engine) listReplaced(list *config.GudgeonList) bool {
+	engine.storeLock.RLock()
+	built, found := engine.listFiles[list.CanonicalName()]
+	engine.storeLock.RUnlock()
+
+	current, err := os.Stat(engine.config.PathToList(list))
+	if !found {
+		return err == nil
+	}
+	return err != nil || !os.SameFile(built, current)
+}
+
+// download the list again and rebuild the stores (or apply the changed rules in place when the store can), the rules
+// already loaded are kept when the download fails or the list has not changed
+func (refresher *listRefresher) refresh(list *config.GudgeonList) error {
+	listPath := refresher.engine.config.PathToList(list)
+
+	// another engine using the same cached copies (like the engine that was replaced on reload) can download the list
+	// after the stores were built, the download then finds that the list has not changed but the stores don't have it
+	replaced := refresher.engine.listReplaced(list)
+
+	// keep a link to the copy the store was built from to find the changed rules
+	previousPath := ""
+	refresher.engine.storeLock.RLock()
+	store := refresher.engine.store
+	refresher.engine.storeLock.RUnlock()
+	if store != nil && !replaced && rule.UpdatesInPlace(store) {
+		os.Remove(listPath + previousSuffix)
+		if err := os.Link(listPath, listPath+previousSuffix); err == nil {
+			previousPath = listPath + previousSuffix
+			defer os.Remove(previousPath)
+		}
+	}
+
+	changed, err := download(refresher.engine, refresher.engine.config, list)
+	if err != nil {
+		log.Errorf("Could not refresh list '%s', keeping the rules that are loaded: %s", list.CanonicalName(), err)
+		return err
+	}
+	if !changed {
+		// touch the cached copy so the next refresh is an interval from now even after a restart
+		now := time.Now()
+		os.Chtimes(listPath, now, now)
+		if replaced {
+			refresher.rebuild()
+		}
+		return nil
+	}
+	if "" != previousPath && refresher.apply(list, store, previousPath) {
+		return nil
+	}
+	refresher.rebuild()
+	return nil
+}
+
+// add and remove the rules that changed since the previous copy of the list, false if the changes could not be applied
+// and the stores need to be rebuilt
+func (refresher *listRefresher) apply(list *config.GudgeonList, store rule.RuleStore, previousPath string) bool {
+	refresher.lock.Lock()
+	defer refresher.lock.Unlock()
+	if refresher.stopped {
+		return true
+	}
+
+	start := time.Now()
+	changes, ok := rule.ReadListChanges(refresher.engine.config, list, previousPath)
+	if !ok {
+		return false
+	}
+
+	engine := refresher.engine
+	engine.storeLock.Lock()
+	// a store that was rebuilt since the copy was kept might already have some of the changes
+	if engine.store != store {
+		engine.storeLock.Unlock()
+		return false
+	}
+	changes.Apply(engine.store, list)
+	if info, err := os.Stat(engine.config.PathToList(list)); err == nil {
+		engine.listFiles[list.CanonicalName()] = info
+	} else {
+		delete(engine.listFiles, list.CanonicalName())
+	}
+	engine.storeLock.Unlock()
+	engine.updateListMetric(list, changes.Loaded, changes.Skipped)
+
+	log.Infof("Added %d and removed %d rules of list '%s' in place in %s", len(changes.Added), len(changes.Removed), list.CanonicalName(), time.Since(start))
+	return true
+}
+
+// build new stores from the lists on disk and swap them into the engine
+func (refresher *listRefresher) rebuild() {
+	refresher.lock.Lock()
+	defer refresher.lock.Unlock()
+	if refresher.stopped {
+		return
+	}
+
+	refresher.generation++
+	storeRoot := path.Join(refresher.engine.Root(), fmt.Sprintf("refresh-%d", refresher.generation))
+	start := time.Now()
+
+	stores := createListStores(refresher.engine.config, storeRoot)
+	refresher.engine.swapStores(stores, storeRoot)
+	refresher.engine.updateListMetrics(stores.counts, stores.skipped)
+
+	log.Infof("Rebuilt list stores in %s", time.Since(start))
+}
+
+// stop refreshing lists, waits for a rebuild that is running to finish
+func (refresher *listRefresher) shutdown() {
+	refresher.lock.Lock()
+	defer refresher.lock.Unlock()
+	if !refresher.stopped {
+		refresher.stopped = true
+		close(refresher.stop)
+	}
+}
@@ -0,0 +1,306 @@
+package engine
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestListRefresh(t *testing.T) {
+	// serve the lists from memory so that they can change between refreshes
+	var lock sync.Mutex
+	lists := map[string]string{
+		"/ads.list":   "ads.com\n",
+		"/never.list": "never.com\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		w.Write([]byte(lists[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	config := testutil.Conf(t, "testdata/refresh.yml")
+	defer os.RemoveAll(config.Home)
+	config.Lists[0].Source = server.URL + "/ads.list"
+	config.Lists[1].Source = server.URL + "/never.list"
+
+	if config.Lists[0].RefreshInterval() != time.Hour || config.Lists[1].RefreshInterval() != 0 {
+		t.Errorf("Expected refresh intervals of 1h and 0 but got %s and %s", config.Lists[0].RefreshInterval(), config.Lists[1].RefreshInterval())
+	}
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	check := func(domain string, expected rule.Match) {
+		if match, _, _ := testEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), domain); match != expected {
+			t.Errorf("Expected %s to match %d but got %d", domain, expected, match)
+		}
+	}
+	check("ads.com", rule.MatchBlock)
+	check("tracker.com", rule.MatchNone)
+
+	// a refreshed list replaces the rules of the list
+	lock.Lock()
+	lists["/ads.list"] = "tracker.com\nmore.com\n"
+	lock.Unlock()
+
+	refresher := testEngine.(*engine).refresher
+	if err := refresher.refresh(config.Lists[0]); err != nil {
+		t.Errorf("Could not refresh list: %s", err)
+	}
+	check("ads.com", rule.MatchNone)
+	check("tracker.com", rule.MatchBlock)
+	check("never.com", rule.MatchBlock)
+
+	if count := testEngine.Metrics().Get("rules-list-ads").Value(); count != 2 {
+		t.Errorf("Expected 2 rules in the refreshed list but got %d", count)
+	}
+	if count := testEngine.Metrics().Get(TotalRules).Value(); count != 3 {
+		t.Errorf("Expected 3 active rules after the refresh but got %d", count)
+	}
+
+	// a failed download keeps the rules that are loaded
+	server.Close()
+	if err := refresher.refresh(config.Lists[0]); err == nil {
+		t.Errorf("Expected an error refreshing a list from a closed server")
+	}
+	check("tracker.com", rule.MatchBlock)
+}
+
+func TestListRefreshAfterOtherDownload(t *testing.T) {
+	// serve the lists with an etag so that a list that has not changed is not downloaded again
+	var lock sync.Mutex
+	lists := map[string]string{
+		"/ads.list":   "ads.com\n",
+		"/never.list": "never.com\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		etag := fmt.Sprintf("\"%x\"", md5.Sum([]byte(lists[r.URL.Path])))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(lists[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	for _, storage := range []string{"memory", "cuckoo"} {
+		lock.Lock()
+		lists["/ads.list"] = "ads.com\n"
+		lock.Unlock()
+
+		config := testutil.Conf(t, "testdata/refresh.yml")
+		defer os.RemoveAll(config.Home)
+		config.Lists[0].Source = server.URL + "/ads.list"
+		config.Lists[1].Source = server.URL + "/never.list"
+		config.Storage.RuleStorage = storage
+
+		testEngine, err := NewEngine(config)
+		if err != nil {
+			t.Errorf("Could not create engine: %s", err)
+			return
+		}
+
+		// the engine that is replaced on reload downloads the changed list after the new engine read it
+		lock.Lock()
+		lists["/ads.list"] = "tracker.com\n"
+		lock.Unlock()
+		if changed, err := download(nil, config, config.Lists[0]); err != nil || !changed {
+			t.Errorf("Expected the other engine to download the changed list")
+		}
+
+		// the list has not changed since that download but the stores don't have it
+		if err := testEngine.(*engine).refresher.refresh(config.Lists[0]); err != nil {
+			t.Errorf("Could not refresh list: %s", err)
+		}
+		if match, _, _ := testEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), "tracker.com"); match != rule.MatchBlock {
+			t.Errorf("Expected the %s store to be rebuilt with the list the other engine downloaded", storage)
+		}
+		if match, _, _ := testEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), "ads.com"); match != rule.MatchNone {
+			t.Errorf("Expected the %s store to drop the rules of the copy it was built from", storage)
+		}
+		testEngine.Shutdown()
+	}
+}
+
+func TestRejectedListOnStart(t *testing.T) {
+	var lock sync.Mutex
+	lists := map[string]string{
+		"/never.list": "never.com\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if content, found := lists[r.URL.Path]; found {
+			w.Write([]byte(content))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	config := testutil.Conf(t, "testdata/refresh.yml")
+	defer os.RemoveAll(config.Home)
+	config.Lists[0].Source = server.URL + "/ads.list"
+	config.Lists[1].Source = server.URL + "/never.list"
+
+	// a list without a cached copy that can't be downloaded starts empty
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Expected the engine to start without the missing list but got: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	check := func(domain string, expected rule.Match) {
+		if match, _, _ := testEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), domain); match != expected {
+			t.Errorf("Expected %s to match %d but got %d", domain, expected, match)
+		}
+	}
+	check("ads.com", rule.MatchNone)
+	check("never.com", rule.MatchBlock)
+
+	// and is loaded when it is refreshed
+	lock.Lock()
+	lists["/ads.list"] = "ads.com\n"
+	lock.Unlock()
+	if err := testEngine.(*engine).refresher.refresh(config.Lists[0]); err != nil {
+		t.Errorf("Could not refresh list: %s", err)
+	}
+	check("ads.com", rule.MatchBlock)
+	check("never.com", rule.MatchBlock)
+}
+
+func TestListRefreshClosesOldStore(t *testing.T) {
+	var lock sync.Mutex
+	lists := map[string]string{
+		"/ads.list":   "ads.com\n",
+		"/never.list": "never.com\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		w.Write([]byte(lists[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	config := testutil.Conf(t, "testdata/refresh.yml")
+	defer os.RemoveAll(config.Home)
+	config.Lists[0].Source = server.URL + "/ads.list"
+	config.Lists[1].Source = server.URL + "/never.list"
+	// the sqlite store keeps a db open until it is closed, the hash store can't update in place so the stores are rebuilt
+	config.Storage.RuleStorage = "hash32+sqlite"
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	oldStore := testEngine.(*engine).store
+	if match, _, _ := oldStore.FindMatch(config.Lists, "ads.com"); match != rule.MatchBlock {
+		t.Errorf("Expected the store to block ads.com before the refresh")
+	}
+
+	lock.Lock()
+	lists["/ads.list"] = "tracker.com\n"
+	lock.Unlock()
+	if err := testEngine.(*engine).refresher.refresh(config.Lists[0]); err != nil {
+		t.Errorf("Could not refresh list: %s", err)
+	}
+
+	// the store that was swapped out is closed along with the store it wraps, so its db finds nothing
+	if match, _, _ := oldStore.FindMatch(config.Lists, "never.com"); match != rule.MatchNone {
+		t.Errorf("Expected the old store to be closed after the refresh")
+	}
+	if match, _, _ := testEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), "never.com"); match != rule.MatchBlock {
+		t.Errorf("Expected the new store to block never.com")
+	}
+}
+
+func TestListRefreshInPlace(t *testing.T) {
+	var lock sync.Mutex
+	lists := map[string]string{
+		"/ads.list":   "ads.com\nkept.com\n",
+		"/never.list": "never.com\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		w.Write([]byte(lists[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	config := testutil.Conf(t, "testdata/refresh.yml")
+	defer os.RemoveAll(config.Home)
+	config.Lists[0].Source = server.URL + "/ads.list"
+	config.Lists[1].Source = server.URL + "/never.list"
+	config.Storage.RuleStorage = "cuckoo+sqlite"
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	check := func(domain string, expected rule.Match) {
+		if match, _, _ := testEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), domain); match != expected {
+			t.Errorf("Expected %s to match %d but got %d", domain, expected, match)
+		}
+	}
+	refresh := func(content string) {
+		lock.Lock()
+		lists["/ads.list"] = content
+		lock.Unlock()
+		if err := testEngine.(*engine).refresher.refresh(config.Lists[0]); err != nil {
+			t.Errorf("Could not refresh list: %s", err)
+		}
+	}
+
+	// the changed rules are applied to the store that is loaded
+	store := testEngine.(*engine).store
+	refresh("kept.com\ntracker.com\n")
+	if testEngine.(*engine).store != store {
+		t.Errorf("Expected the changes to be applied in place")
+	}
+	check("ads.com", rule.MatchNone)
+	check("kept.com", rule.MatchBlock)
+	check("tracker.com", rule.MatchBlock)
+	check("never.com", rule.MatchBlock)
+	if count := testEngine.Metrics().Get("rules-list-ads").Value(); count != 2 {
+		t.Errorf("Expected 2 rules in the refreshed list but got %d", count)
+	}
+	if count := testEngine.Metrics().Get(TotalRules).Value(); count != 3 {
+		t.Errorf("Expected 3 active rules after the refresh but got %d", count)
+	}
+	if _, err := os.Stat(config.PathToList(config.Lists[0]) + previousSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected the previous copy of the list to be removed")
+	}
+
+	// exception rules change the lists the store was made with so the stores are rebuilt
+	refresh("tracker.com\n||ads.com^\n@@||good.ads.com^\n")
+	if testEngine.(*engine).store == store {
+		t.Errorf("Expected the stores to be rebuilt for a list with exception rules")
+	}
+	check("kept.com", rule.MatchNone)
+	check("www.ads.com", rule.MatchBlock)
+	check("good.ads.com", rule.MatchAllow)
+}
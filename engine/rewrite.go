@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/resolver"
+	"github.com/chrisruffalo/gudgeon/rule"
+)
+
+const (
+	// the ttl of rewritten answers
+	rewriteTTL = 60
+	// the most rewrites that can be applied to a single request, this stops rewrite loops
+	maxRewrites = 8
+)
+
+// find the first rewrite for the domain in the rewrite lists of the given groups (in order) that are active at the given time
+func (engine *engine) rewriteForGroups(groups []string, domain string, at time.Time) (*rule.Rewrite, *config.GudgeonList) {
+	engine.storeLock.RLock()
+	defer engine.storeLock.RUnlock()
+
+	if engine.rewrites == nil || len(groups) < 1 {
+		return nil, nil
+	}
+
+	lists := make([]*config.GudgeonList, 0)
+	for _, g := range groups {
+		if group, found := engine.groups[g]; found {
+			lists = append(lists, group.activeLists(group.rewriteLists, at)...)
+		}
+	}
+
+	if len(lists) < 1 {
+		return nil, nil
+	}
+
+	return engine.rewrites.FindRewrite(lists, domain)
+}
+
+// create the response to a rewritten request, a cname rewrite is answered through the normal cname resolution and
+// a rewrite with addresses answers A/AAAA questions with those addresses (and other questions with an empty answer)
+func (engine *engine) rewrittenResponse(resolverNames []string, rCon *resolver.RequestContext, request *dns.Msg, rewrite *rule.Rewrite) *dns.Msg {
+	response := new(dns.Msg)
+	response.SetReply(request)
+
+	question := request.Question[0]
+	header := dns.RR_Header{Name: question.Name, Class: dns.ClassINET, Ttl: rewriteTTL}
+
+	if rewrite.IsCNAME() {
+		header.Rrtype = dns.TypeCNAME
+		response.Answer = append(response.Answer, &dns.CNAME{Hdr: header, Target: rewrite.Target})
+
+		// count the rewrite before resolving the target so that rewrite loops end
+		rCon.Rewrites++
+
+		cnameResponse, _ := engine.handleCnameResolution(resolverNames, rCon, request, response)
+		if cnameResponse != nil && len(cnameResponse.Answer) > 0 {
+			return cnameResponse
+		}
+
+		// if the target can't be resolved (or a cname was asked for) answer with just the cname
+		return response
+	}
+
+	for _, address := range rewrite.Addresses {
+		if ipv4 := address.To4(); ipv4 != nil {
+			if question.Qtype == dns.TypeA {
+				header.Rrtype = dns.TypeA
+				response.Answer = append(response.Answer, &dns.A{Hdr: header, A: ipv4})
+			}
+		} else if question.Qtype == dns.TypeAAAA {
+			header.Rrtype = dns.TypeAAAA
+			response.Answer = append(response.Answer, &dns.AAAA{Hdr: header, AAAA: address})
+		}
+	}
+
+	return response
+}
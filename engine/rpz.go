@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/resolver"
+	"github.com/chrisruffalo/gudgeon/rule"
+)
+
+// the rpz lists of the given groups (in order) that are active at the given time, the caller holds the store lock
+func (engine *engine) activeRPZLists(groups []string, at time.Time) []*config.GudgeonList {
+	lists := make([]*config.GudgeonList, 0)
+	if engine.rpz == nil {
+		return lists
+	}
+	for _, g := range groups {
+		if group, found := engine.groups[g]; found {
+			lists = append(lists, group.activeLists(group.rpzLists, at)...)
+		}
+	}
+	return lists
+}
+
+// find the first rpz rule triggered by the domain in the rpz lists of the groups
+func (engine *engine) rpzForGroups(groups []string, domain string, at time.Time) (*rule.RPZRule, *config.GudgeonList) {
+	engine.storeLock.RLock()
+	defer engine.storeLock.RUnlock()
+
+	lists := engine.activeRPZLists(groups, at)
+	if len(lists) < 1 {
+		return nil, nil
+	}
+	return engine.rpz.FindRPZ(lists, domain)
+}
+
+// find the first rpz-ip rule triggered by an address in the response in the rpz lists of the groups
+func (engine *engine) rpzIPForGroups(groups []string, response *dns.Msg, at time.Time) (*rule.RPZRule, *config.GudgeonList) {
+	engine.storeLock.RLock()
+	defer engine.storeLock.RUnlock()
+
+	lists := engine.activeRPZLists(groups, at)
+	if len(lists) < 1 {
+		return nil, nil
+	}
+	for _, address := range answerAddresses(response) {
+		if rpzRule, list := engine.rpz.FindRPZIP(lists, address); rpzRule != nil {
+			return rpzRule, list
+		}
+	}
+	return nil, nil
+}
+
+// apply the action of an rpz rule to the result and create the response, false is returned when the request should be
+// answered normally (passthru, paused, or too many rewrites) and a nil response with true means the request is dropped
+func (engine *engine) rpzResponse(groups []string, resolverNames []string, rCon *resolver.RequestContext, request *dns.Msg, result *resolver.ResolutionResult, rpzRule *rule.RPZRule, list *config.GudgeonList) (*dns.Msg, bool) {
+	switch rpzRule.Action {
+	case rule.RPZPASSTHRU:
+		result.Match = rule.MatchAllow
+		result.MatchList = list
+		result.MatchRule = rpzRule.Text
+		return nil, false
+	case rule.RPZLOCALDATA:
+		if rCon.Rewrites >= maxRewrites {
+			return nil, false
+		}
+		result.Rewritten = true
+		result.RewriteList = list
+		result.RewriteRule = rpzRule.Text
+		return engine.rewrittenResponse(resolverNames, rCon, request, rpzRule.Rewrite), true
+	}
+
+	// the other actions are blocks that are ignored while blocking is paused
+	result.MatchList = list
+	result.MatchRule = rpzRule.Text
+	if engine.pauses.active(rCon.Consumer, groups, requestTime(rCon)) != nil {
+		result.Paused = true
+		return nil, false
+	}
+	result.Match = rule.MatchBlock
+
+	switch rpzRule.Action {
+	case rule.RPZNODATA:
+		return blockedResponse(request, config.BlockResponseNoData, 0), true
+	case rule.RPZDROP:
+		return nil, true
+	}
+	return blockedResponse(request, config.BlockResponseNXDomain, 0), true
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
+	"sync"
 	"syscall"
 
 	"github.com/google/gops/agent"
@@ -27,6 +29,15 @@ type Gudgeon struct {
 	engine   engine.Engine
 	provider provider.Provider
 	web      web.Web
+
+	// the file the configuration was loaded from, used to reload the configuration
+	configPath string
+	// only one reload at a time
+	reloadLock sync.Mutex
+	// guards swapping the engine and shutting down so that a reload that finishes after shutdown doesn't swap in an
+	// engine that is never stopped
+	lock    sync.Mutex
+	stopped bool
 }
 
 // NewGudgeon Create a new Gudgeon instance from a given Gudgeon Config
@@ -61,6 +72,7 @@ func (gudgeon *Gudgeon) Start() error {
 	// open web ui if web enabled
 	if config.Web.Enabled {
 		web := web.New()
+		web.SetReloadFunc(gudgeon.Reload)
 		web.Serve(config, engine)
 		gudgeon.web = web
 	}
@@ -73,7 +85,81 @@ func (gudgeon *Gudgeon) Start() error {
 	return nil
 }
 
+// Reload the configuration from the original configuration file and swap a new engine in for the current engine
+func (gudgeon *Gudgeon) Reload() error {
+	gudgeon.reloadLock.Lock()
+	defer gudgeon.reloadLock.Unlock()
+
+	log.Infof("Reloading configuration...")
+
+	// load config
+	config, warnings, err := config.Load(gudgeon.configPath)
+	if err != nil {
+		return err
+	}
+	for _, warn := range warnings {
+		log.Warn(warn)
+	}
+
+	// build the new engine while the old one keeps serving requests
+	newEngine, err := engine.NewEngine(config)
+	if err != nil {
+		return err
+	}
+	if newEngine == nil {
+		return fmt.Errorf("Could not create required engine component")
+	}
+
+	// a shutdown that happened while the new engine was built leaves nothing to swap it in for
+	gudgeon.lock.Lock()
+	defer gudgeon.lock.Unlock()
+	if gudgeon.stopped {
+		newEngine.Shutdown()
+		return fmt.Errorf("Gudgeon was shut down during the reload")
+	}
+
+	// swap in the new engine and (if needed) rebind listeners
+	oldEngine := gudgeon.engine
+	if oldEngine != nil {
+		// active pauses carry over to the new engine
+		newEngine.KeepPauses(oldEngine)
+	}
+	if gudgeon.provider != nil {
+		gudgeon.provider.UpdateEngine(newEngine)
+		if err := gudgeon.provider.UpdateConfig(config); err != nil {
+			log.Errorf("Updating DNS endpoints: %s", err)
+		}
+	}
+	if gudgeon.web != nil {
+		if !reflect.DeepEqual(gudgeon.config.Web, config.Web) {
+			log.Warnf("Changes to the web configuration require a restart")
+		}
+		gudgeon.web.UpdateEngine(config, newEngine)
+	}
+	// the custom rules were read while the new engine was built, the web api has stopped using the old engine now so
+	// the rules that were added to or removed from it since then are in the db
+	if err := newEngine.ReloadCustomRules(); err != nil {
+		log.Errorf("Reloading custom rules: %s", err)
+	}
+	gudgeon.engine = newEngine
+	gudgeon.config = config
+
+	// nothing is using the old engine anymore so it can be stopped
+	if oldEngine != nil {
+		log.Infof("Shutting down previous Engine...")
+		oldEngine.Shutdown()
+	}
+
+	log.Infof("Reload complete")
+
+	return nil
+}
+
 func (gudgeon *Gudgeon) Shutdown() {
+	gudgeon.lock.Lock()
+	defer gudgeon.lock.Unlock()
+	gudgeon.stopped = true
+
 	// stop providers
 	if gudgeon.provider != nil {
 		log.Infof("Shutting down DNS endpoints...")
@@ -148,6 +234,7 @@ func main() {
 
 	// create new Gudgeon instance
 	instance := NewGudgeon(config)
+	instance.configPath = filename
 
 	// start new instance
 	err = instance.Start()
@@ -156,18 +243,25 @@ func main() {
 		os.Exit(1)
 	}
 
-	// wait for signal
-	sig := make(chan os.Signal)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	// wait for signal, reloading on hangup (in the background so that a signal to stop is handled during a reload)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	s := <-sig
-
-	// clean out session directory
-	if "" != config.SessionRoot() {
-		util.ClearDirectory(config.SessionRoot())
+	for s == syscall.SIGHUP {
+		go func() {
+			if err := instance.Reload(); err != nil {
+				log.Errorf("Could not reload: %s", err)
+			}
+		}()
+		s = <-sig
 	}
 
 	log.Infof("Signal (%s) received, stopping", s)
 	// stop gudgeon, hopefully gracefully
 	instance.Shutdown()
 
+	// clean out session directory of the configuration in use (a reload can change it)
+	if sessionRoot := instance.config.SessionRoot(); "" != sessionRoot {
+		util.ClearDirectory(sessionRoot)
+	}
 }
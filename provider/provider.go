@@ -2,9 +2,11 @@ package provider
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -18,14 +20,22 @@ import (
 )
 
 type provider struct {
-	engine  engine.Engine
-	servers []*dns.Server
+	// guards the engine so that it can be swapped while requests are being handled
+	engineLock sync.RWMutex
+	engine     engine.Engine
+
+	// the configuration that the servers were started with
+	config *config.GudgeonConfig
+
+	// servers started from the configured interfaces (which can be restarted) and from systemd (which can't)
+	servers        []*dns.Server
+	systemdServers []*dns.Server
 }
 
 type Provider interface {
 	Host(config *config.GudgeonConfig, engine engine.Engine) error
-	//UpdateConfig(config *GudgeonConfig) error
-	//UpdateEngine(engine *engine.Engine) error
+	UpdateConfig(config *config.GudgeonConfig) error
+	UpdateEngine(engine engine.Engine) error
 	Shutdown() error
 }
 
@@ -33,6 +43,7 @@ func NewProvider(engine engine.Engine) Provider {
 	provider := new(provider)
 	provider.engine = engine
 	provider.servers = make([]*dns.Server, 0)
+	provider.systemdServers = make([]*dns.Server, 0)
 	return provider
 }
 
@@ -57,6 +68,23 @@ func (provider *provider) serve(netType string, addr string) *dns.Server {
 	return server
 }
 
+func (provider *provider) serveTLS(addr string, tlsConfig *tls.Config) *dns.Server {
+	server := defaultServer()
+	server.Addr = addr
+	server.Net = "tcp-tls"
+	server.TLSConfig = tlsConfig
+	// tls connections show up as tcp connections so the protocol is set by the handler
+	server.Handler = dns.HandlerFunc(provider.handleTLS)
+
+	log.Infof("Listen to TCP-TLS on address: %s", addr)
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			log.Errorf("Failed starting tcp-tls server: %s", err.Error())
+		}
+	}()
+	return server
+}
+
 func (provider *provider) listen(listener net.Listener, packetConn net.PacketConn) *dns.Server {
 	server := defaultServer()
 	if packetConn != nil {
@@ -80,6 +108,15 @@ func (provider *provider) listen(listener net.Listener, packetConn net.PacketCon
 }
 
 func (provider *provider) handle(writer dns.ResponseWriter, request *dns.Msg) {
+	provider.handleProtocol("", writer, request)
+}
+
+func (provider *provider) handleTLS(writer dns.ResponseWriter, request *dns.Msg) {
+	provider.handleProtocol("tcp-tls", writer, request)
+}
+
+// handle the request, if the protocol is empty it is determined from the remote address
+func (provider *provider) handleProtocol(protocol string, writer dns.ResponseWriter, request *dns.Msg) {
 	// define response
 	var (
 		address  *net.IP
@@ -87,33 +124,27 @@ func (provider *provider) handle(writer dns.ResponseWriter, request *dns.Msg) {
 	)
 
 	// get consumer ip from request
-	protocol := ""
+	remoteProtocol := ""
 	if ip, ok := writer.RemoteAddr().(*net.UDPAddr); ok {
 		address = &(ip.IP)
-		protocol = "udp"
+		remoteProtocol = "udp"
 	}
 	if ip, ok := writer.RemoteAddr().(*net.TCPAddr); ok {
 		address = &(ip.IP)
-		protocol = "tcp"
+		remoteProtocol = "tcp"
+	}
+	if "" == protocol {
+		protocol = remoteProtocol
 	}
 
-	// if an engine is available actually provide some resolution
-	if provider.engine != nil {
-		// make query and get information back for metrics/logging
-		response, _, _ = provider.engine.Handle(address, protocol, request)
-	} else {
-		// when no engine defined return that there was a server failure
-		response = new(dns.Msg)
-		response.SetReply(request)
-		response.Rcode = dns.RcodeServerFailure
+	// get response from the current engine
+	response = provider.respond(address, protocol, request)
 
-		// log that there is no engine to service request?
-		log.Errorf("No engine to process request")
+	// write response to response writer, a request without a response was dropped
+	if response != nil {
+		writer.WriteMsg(response)
 	}
 
-	// write response to response writer
-	writer.WriteMsg(response)
-
 	// we were having some errors during write that we need to figure out
 	// and this is a good(??) way to try and find them out.
 	if recovery := recover(); recovery != nil {
@@ -124,6 +155,29 @@ func (provider *provider) handle(writer dns.ResponseWriter, request *dns.Msg) {
 	writer.Close()
 }
 
+// handle the request with the engine, the engine can't be swapped until the request has been handled
+func (provider *provider) respond(address *net.IP, protocol string, request *dns.Msg) *dns.Msg {
+	provider.engineLock.RLock()
+	defer provider.engineLock.RUnlock()
+
+	// if an engine is available actually provide some resolution
+	if provider.engine != nil {
+		// make query and get information back for metrics/logging
+		response, _, _ := provider.engine.Handle(address, protocol, request)
+		return response
+	}
+
+	// when no engine defined return that there was a server failure
+	response := new(dns.Msg)
+	response.SetReply(request)
+	response.Rcode = dns.RcodeServerFailure
+
+	// log that there is no engine to service request?
+	log.Errorf("No engine to process request")
+
+	return response
+}
+
 func (provider *provider) Host(config *config.GudgeonConfig, engine engine.Engine) error {
 	// get network config
 	netConf := config.Network
@@ -149,8 +203,9 @@ func (provider *provider) Host(config *config.GudgeonConfig, engine engine.Engin
 	}
 
 	if engine != nil {
-		provider.engine = engine
+		provider.UpdateEngine(engine)
 	}
+	provider.config = config
 
 	// global dns handle function
 	dns.HandleFunc(".", provider.handle)
@@ -161,15 +216,23 @@ func (provider *provider) Host(config *config.GudgeonConfig, engine engine.Engin
 		for _, f := range fileSockets {
 			// check if udp
 			if pc, err := net.FilePacketConn(f); err == nil {
-				provider.servers = append(provider.servers, provider.listen(nil, pc))
+				provider.systemdServers = append(provider.systemdServers, provider.listen(nil, pc))
 				f.Close()
 			} else if pc, err := net.FileListener(f); err == nil { // then check if tcp
-				provider.servers = append(provider.servers, provider.listen(pc, nil))
+				provider.systemdServers = append(provider.systemdServers, provider.listen(pc, nil))
 				f.Close()
 			}
 		}
 	}
 
+	// start configured interfaces
+	provider.hostInterfaces(interfaces)
+
+	return nil
+}
+
+// start servers for each of the configured interfaces
+func (provider *provider) hostInterfaces(interfaces []*config.GudgeonInterface) {
 	if len(interfaces) > 0 {
 		log.Infof("Using [%d] configured interfaces...", len(interfaces))
 		for _, iface := range interfaces {
@@ -181,13 +244,54 @@ func (provider *provider) Host(config *config.GudgeonConfig, engine engine.Engin
 			if *iface.UDP {
 				provider.servers = append(provider.servers, provider.serve("udp", addr))
 			}
+			if iface.TLS != nil && iface.TLS.Enabled {
+				tlsConfig, err := iface.TLS.ServerConfig()
+				if err != nil {
+					log.Errorf("Could not start TLS on interface %s: %s", iface.IP, err)
+					continue
+				}
+				tlsAddr := fmt.Sprintf("%s:%d", iface.IP, iface.TLS.Port)
+				provider.servers = append(provider.servers, provider.serveTLS(tlsAddr, tlsConfig))
+			}
 		}
 	}
+}
+
+// use the new configuration, the configured interfaces are only restarted if the network configuration changed
+func (provider *provider) UpdateConfig(config *config.GudgeonConfig) error {
+	if config == nil || config.Network == nil {
+		return fmt.Errorf("No network configuration to update provider with")
+	}
+
+	// nothing to restart
+	if provider.config != nil && reflect.DeepEqual(provider.config.Network, config.Network) {
+		provider.config = config
+		return nil
+	}
+
+	if provider.config != nil && !reflect.DeepEqual(provider.config.Network.Systemd, config.Network.Systemd) {
+		log.Warnf("Changes to systemd socket activation require a restart")
+	}
+
+	log.Infof("Network configuration changed, restarting configured interfaces...")
+	shutdownServers(provider.servers)
+	provider.servers = make([]*dns.Server, 0)
+	provider.config = config
+	provider.hostInterfaces(config.Network.Interfaces)
 
 	return nil
 }
 
-func (provider *provider) Shutdown() error {
+// swap the engine used to handle requests, returns once no requests are being handled by the old engine
+func (provider *provider) UpdateEngine(engine engine.Engine) error {
+	provider.engineLock.Lock()
+	provider.engine = engine
+	provider.engineLock.Unlock()
+	return nil
+}
+
+// shut down the given servers and wait for them to stop
+func shutdownServers(servers []*dns.Server) {
 	// set with a 60 second timeout
 	context, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
@@ -195,22 +299,25 @@ func (provider *provider) Shutdown() error {
 	// start a waitgroup
 	wg := &sync.WaitGroup{}
 
-	for _, server := range provider.servers {
+	for _, server := range servers {
 		// stop each server separately
 		if server != nil {
 			// add newly started go function to wg
 			wg.Add(1)
 			// do a go shutdown function with wg for each server
-			go func() {
+			go func(server *dns.Server) {
 				server.ShutdownContext(context)
 				log.Infof("Shtudown server: %s", server.Addr)
 				wg.Done()
-			}()
+			}(server)
 		}
 	}
 
 	// wait for group to be done
 	wg.Wait()
+}
 
+func (provider *provider) Shutdown() error {
+	shutdownServers(append(provider.servers, provider.systemdServers...))
 	return nil
 }
@@ -1,11 +1,16 @@
 package provider
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/miekg/dns"
 
+	gconfig "github.com/chrisruffalo/gudgeon/config"
 	"github.com/chrisruffalo/gudgeon/engine"
 	"github.com/chrisruffalo/gudgeon/resolver"
 	"github.com/chrisruffalo/gudgeon/testutil"
@@ -111,3 +116,135 @@ func TestProviderLocalResolution(t *testing.T) {
 	// make sure they shut down
 	provider.Shutdown()
 }
+
+func TestProviderTLSResolution(t *testing.T) {
+	// create from config
+	config := testutil.Conf(t, "./testdata/provider-test.yml")
+	defer os.RemoveAll(config.Home)
+
+	// create certificate for local tls listener
+	certPath, keyPath, err := testutil.TLSCertificate(config.Home, "127.0.0.1")
+	if err != nil {
+		t.Errorf("Could not create test certificate: %s", err)
+		return
+	}
+	config.Network.Interfaces[0].TLS = &gconfig.GudgeonTLS{
+		Enabled: true,
+		Port:    25853,
+		Cert:    certPath,
+		Key:     keyPath,
+	}
+
+	// prepare engine with config options
+	engine, err := engine.NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not build engine: %s", err)
+		return
+	}
+
+	// create a new provider and start hosting
+	provider := NewProvider(engine)
+	provider.Host(config, engine)
+	time.Sleep(1 * time.Second)
+
+	// trust the generated certificate
+	pem, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		t.Errorf("Could not read test certificate: %s", err)
+		return
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pem)
+	client := &dns.Client{Net: "tcp-tls", TLSConfig: &tls.Config{RootCAs: pool}}
+
+	m := new(dns.Msg)
+	m.SetQuestion("google.com.", dns.TypeA)
+	response, _, err := client.Exchange(m, "127.0.0.1:25853")
+	if err != nil {
+		t.Errorf("Could not resolve over tls: %s", err)
+	} else if first := util.GetFirstIPResponse(response); "127.0.0.1" != first {
+		t.Errorf("Expected answer '127.0.0.1' but got '%s' over tls", first)
+	}
+
+	// a client that does not trust the certificate should fail
+	untrusted := &dns.Client{Net: "tcp-tls", TLSConfig: &tls.Config{}}
+	if _, _, err := untrusted.Exchange(m, "127.0.0.1:25853"); err == nil {
+		t.Errorf("Expected untrusted tls client to fail")
+	}
+
+	// make sure they shut down
+	provider.Shutdown()
+	engine.Shutdown()
+}
+
+func TestProviderUpdate(t *testing.T) {
+	// question for each step
+	query := func(address string) string {
+		m := new(dns.Msg)
+		m.SetQuestion("google.com.", dns.TypeA)
+		client := &dns.Client{Net: "tcp", Timeout: time.Second}
+		response, _, err := client.Exchange(m, address)
+		if err != nil {
+			return ""
+		}
+		return util.GetFirstIPResponse(response)
+	}
+
+	config := testutil.Conf(t, "./testdata/provider-test.yml")
+	defer os.RemoveAll(config.Home)
+	firstEngine, err := engine.NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not build engine: %s", err)
+		return
+	}
+
+	testProvider := NewProvider(firstEngine)
+	testProvider.Host(config, firstEngine)
+	defer testProvider.Shutdown()
+	time.Sleep(1 * time.Second)
+
+	if answer := query("127.0.0.1:25353"); answer != "127.0.0.1" {
+		t.Errorf("Expected answer '127.0.0.1' from the first engine but got '%s'", answer)
+	}
+
+	// same network, different engine: the listeners are kept
+	sameNetwork := testutil.Conf(t, "./testdata/provider-test.yml")
+	defer os.RemoveAll(sameNetwork.Home)
+	sameNetwork.Resolvers[0].Hosts = []string{"10.0.0.1 google.com"}
+	secondEngine, err := engine.NewEngine(sameNetwork)
+	if err != nil {
+		t.Errorf("Could not build engine: %s", err)
+		return
+	}
+	servers := testProvider.(*provider).servers
+	testProvider.UpdateEngine(secondEngine)
+	testProvider.UpdateConfig(sameNetwork)
+	firstEngine.Shutdown()
+	if len(servers) != len(testProvider.(*provider).servers) || servers[0] != testProvider.(*provider).servers[0] {
+		t.Errorf("Expected listeners to be kept when the network configuration did not change")
+	}
+	if answer := query("127.0.0.1:25353"); answer != "10.0.0.1" {
+		t.Errorf("Expected answer '10.0.0.1' from the second engine but got '%s'", answer)
+	}
+
+	// different network: the listeners are moved
+	otherNetwork := testutil.Conf(t, "./testdata/provider-reload.yml")
+	defer os.RemoveAll(otherNetwork.Home)
+	thirdEngine, err := engine.NewEngine(otherNetwork)
+	if err != nil {
+		t.Errorf("Could not build engine: %s", err)
+		return
+	}
+	testProvider.UpdateEngine(thirdEngine)
+	testProvider.UpdateConfig(otherNetwork)
+	secondEngine.Shutdown()
+	defer thirdEngine.Shutdown()
+	time.Sleep(1 * time.Second)
+
+	if answer := query("127.0.0.1:25354"); answer != "10.0.0.2" {
+		t.Errorf("Expected answer '10.0.0.2' from the new listener but got '%s'", answer)
+	}
+	if answer := query("127.0.0.1:25353"); answer != "" {
+		t.Errorf("Expected the old listener to be closed but got answer '%s'", answer)
+	}
+}
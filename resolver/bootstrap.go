@@ -0,0 +1,128 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultBootstrap = "system"
+	minBootstrapTTL  = 30 * time.Second
+)
+
+// sources that need to resolve their own (host) names do so through a named resolver
+type bootstrapSource interface {
+	setBootstrap(resolverName string)
+}
+
+// looks up (and keeps) the addresses of a source host through the bootstrap resolver
+type bootstrapper struct {
+	host string
+
+	// name of the resolver used to look up the host
+	bootstrap string
+
+	// addresses found for the host and when they need to be looked up again
+	addressLock   sync.RWMutex
+	addresses     []string
+	addressExpiry time.Time
+}
+
+func (bootstrapper *bootstrapper) setBootstrap(resolverName string) {
+	if "" == resolverName {
+		resolverName = defaultBootstrap
+	}
+	bootstrapper.bootstrap = resolverName
+}
+
+// true if the host is an ip and does not need to be looked up
+func (bootstrapper *bootstrapper) isAddress() bool {
+	return net.ParseIP(bootstrapper.host) != nil
+}
+
+// the current addresses for the host
+func (bootstrapper *bootstrapper) hostAddresses() []string {
+	if bootstrapper.isAddress() {
+		return []string{bootstrapper.host}
+	}
+
+	bootstrapper.addressLock.RLock()
+	defer bootstrapper.addressLock.RUnlock()
+	return bootstrapper.addresses
+}
+
+// look up the addresses for the host if they have not been found or they have expired
+func (bootstrapper *bootstrapper) lookupHost(rCon *RequestContext, context *ResolutionContext) error {
+	if bootstrapper.isAddress() {
+		return nil
+	}
+
+	bootstrapper.addressLock.RLock()
+	valid := len(bootstrapper.addresses) > 0 && time.Now().Before(bootstrapper.addressExpiry)
+	bootstrapper.addressLock.RUnlock()
+	if valid {
+		return nil
+	}
+
+	addresses := make([]string, 0)
+	minTTL := uint32(0)
+
+	if context != nil && context.ResolverMap != nil {
+		for _, qType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			request := new(dns.Msg)
+			request.SetQuestion(dns.Fqdn(bootstrapper.host), qType)
+
+			// carry over visited resolvers so that a source can't bootstrap through its own resolver
+			bootstrapContext := DefaultResolutionContextWithMap(context.ResolverMap)
+			bootstrapContext.Visited = append(bootstrapContext.Visited, context.Visited...)
+
+			response, _, err := context.ResolverMap.answerWithContext(rCon, bootstrapper.bootstrap, bootstrapContext, request)
+			if err != nil || response == nil {
+				continue
+			}
+			for _, rr := range response.Answer {
+				var ip net.IP
+				switch record := rr.(type) {
+				case *dns.A:
+					ip = record.A
+				case *dns.AAAA:
+					ip = record.AAAA
+				default:
+					continue
+				}
+				addresses = append(addresses, ip.String())
+				if minTTL == 0 || rr.Header().Ttl < minTTL {
+					minTTL = rr.Header().Ttl
+				}
+			}
+		}
+	} else {
+		// without a resolver map fall back to the system resolver
+		hosts, err := net.LookupHost(bootstrapper.host)
+		if err != nil {
+			return err
+		}
+		addresses = append(addresses, hosts...)
+		minTTL = ttl
+	}
+
+	if len(addresses) < 1 {
+		return fmt.Errorf("Could not bootstrap host '%s' with resolver '%s'", bootstrapper.host, bootstrapper.bootstrap)
+	}
+
+	expiry := time.Duration(minTTL) * time.Second
+	if expiry < minBootstrapTTL {
+		expiry = minBootstrapTTL
+	}
+
+	bootstrapper.addressLock.Lock()
+	bootstrapper.addresses = addresses
+	bootstrapper.addressExpiry = time.Now().Add(expiry)
+	bootstrapper.addressLock.Unlock()
+
+	return nil
+}
@@ -11,14 +11,16 @@ import (
 
 	"github.com/miekg/dns"
 
+	"github.com/chrisruffalo/gudgeon/config"
 	"github.com/chrisruffalo/gudgeon/util"
 )
 
 const (
-	defaultPort    = uint(53)
-	defaultTLSPort = uint(853)
-	portDelimeter  = ":"
-	protoDelimeter = "/"
+	defaultPort     = uint(53)
+	defaultTLSPort  = uint(853)
+	portDelimeter   = ":"
+	protoDelimeter  = "/"
+	serverDelimeter = "#"
 )
 
 // how long to wait before source is active again
@@ -28,13 +30,17 @@ var defaultTimeout = 1 * time.Second
 var validProtocols = []string{"udp", "tcp", "tcp-tls"}
 
 type dnsSource struct {
+	bootstrapper
+
 	dnsServer     string
 	port          uint
 	remoteAddress string
 	protocol      string
 
 	backoffTime *time.Time
-	tlsConfig   *tls.Config
+	// name used to verify the certificate of a tls server
+	serverName string
+	tlsConfig  *tls.Config
 }
 
 func newDNSSource(sourceAddress string) Source {
@@ -42,6 +48,14 @@ func newDNSSource(sourceAddress string) Source {
 	source.port = 0
 	source.dnsServer = ""
 	source.protocol = ""
+	source.bootstrap = defaultBootstrap
+
+	// a tls server can be given a name to verify against (1.1.1.1/tcp-tls#cloudflare-dns.com)
+	if strings.Contains(sourceAddress, serverDelimeter) {
+		split := strings.SplitN(sourceAddress, serverDelimeter, 2)
+		sourceAddress = split[0]
+		source.serverName = strings.ToLower(split[1])
+	}
 
 	// determine first if there is an attached protocol
 	if strings.Contains(sourceAddress, protoDelimeter) {
@@ -79,14 +93,25 @@ func newDNSSource(sourceAddress string) Source {
 		}
 	}
 
-	// set up tls config
-	source.tlsConfig = &tls.Config{InsecureSkipVerify: true}
-
-	// check final output
+	// check final output, only tls servers can be given by name because the name is needed for verification
+	source.host = source.dnsServer
 	if ip := net.ParseIP(source.dnsServer); ip == nil {
-		return nil
+		if "tcp-tls" != source.protocol || "" == source.dnsServer || strings.ContainsAny(source.dnsServer, "/ ") {
+			return nil
+		}
+		if "" == source.serverName {
+			source.serverName = strings.ToLower(source.dnsServer)
+		}
+	}
+
+	// without a name the certificate is verified against the ip of the server
+	if "" == source.serverName {
+		source.serverName = source.dnsServer
 	}
 
+	// set up tls config, the certificate is verified against the system certificate pool by default
+	source.tlsConfig = &tls.Config{ServerName: source.serverName}
+
 	// save/parse remote address once
 	source.remoteAddress = fmt.Sprintf("%s%s%d", source.dnsServer, portDelimeter, source.port)
 
@@ -97,6 +122,16 @@ func (dnsSource *dnsSource) Name() string {
 	return dnsSource.remoteAddress
 }
 
+// verify tls servers with the configured certificate authorities and pins
+func (dnsSource *dnsSource) setTLS(sourceTLS *config.GudgeonSourceTLS) error {
+	tlsConfig, err := sourceTLS.ClientConfig(dnsSource.serverName)
+	if err != nil {
+		return err
+	}
+	dnsSource.tlsConfig = tlsConfig
+	return nil
+}
+
 func (dnsSource *dnsSource) query(coType string, request *dns.Msg, remoteAddress string) (*dns.Msg, error) {
 	var err error
 
@@ -166,8 +201,20 @@ func (dnsSource *dnsSource) Answer(rCon *RequestContext, context *ResolutionCont
 		protocol = "udp"
 	}
 
-	// forward message without interference
-	response, err := dnsSource.query(protocol, request, dnsSource.remoteAddress)
+	// servers given by name need to be looked up first
+	if err := dnsSource.lookupHost(rCon, context); err != nil {
+		return nil, err
+	}
+
+	// forward message without interference, trying each address of the server in turn
+	var response *dns.Msg
+	var err error
+	for _, address := range dnsSource.hostAddresses() {
+		response, err = dnsSource.query(protocol, request, net.JoinHostPort(address, strconv.FormatUint(uint64(dnsSource.port), 10)))
+		if err == nil {
+			break
+		}
+	}
 	if err != nil {
 		backoff := time.Now().Add(backoffInterval)
 		dnsSource.backoffTime = &backoff
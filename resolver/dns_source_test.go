@@ -1,9 +1,18 @@
 package resolver
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"os"
 	"testing"
 
 	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/testutil"
 )
 
 func TestDnsSourceResolution(t *testing.T) {
@@ -59,3 +68,87 @@ func TestDnsSourceResolution(t *testing.T) {
 		}
 	}
 }
+
+func TestDnsSourceTLSVerification(t *testing.T) {
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+
+	// local dns-over-tls server with a certificate for 127.0.0.1 and dns.gudgeon.test
+	certPath, keyPath, err := testutil.TLSCertificate(dir, "127.0.0.1", "dns.gudgeon.test")
+	if err != nil {
+		t.Errorf("Could not create test certificate: %s", err)
+		return
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Errorf("Could not load test certificate: %s", err)
+		return
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Errorf("Could not listen for tls: %s", err)
+		return
+	}
+	server := &dns.Server{Listener: listener, Net: "tcp-tls", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		response := new(dns.Msg)
+		response.SetReply(r)
+		response.Answer = append(response.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("10.0.0.1"),
+		})
+		w.WriteMsg(response)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// pin of the test certificate's public key
+	parsed, _ := x509.ParseCertificate(cert.Certificate[0])
+	hash := sha256.Sum256(parsed.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(hash[:])
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	data := []struct {
+		source   string
+		tls      *config.GudgeonSourceTLS
+		resolves bool
+	}{
+		// not trusted without the ca
+		{"127.0.0.1:" + port + "/tcp-tls", nil, false},
+		{"127.0.0.1:" + port + "/tcp-tls#dns.gudgeon.test", nil, false},
+		// trusted by ip or by name
+		{"127.0.0.1:" + port + "/tcp-tls", &config.GudgeonSourceTLS{CA: certPath}, true},
+		{"127.0.0.1:" + port + "/tcp-tls#dns.gudgeon.test", &config.GudgeonSourceTLS{CA: certPath}, true},
+		// name does not match certificate
+		{"127.0.0.1:" + port + "/tcp-tls#other.gudgeon.test", &config.GudgeonSourceTLS{CA: certPath}, false},
+		// name looked up through bootstrap resolver
+		{"dns.gudgeon.test:" + port + "/tcp-tls", &config.GudgeonSourceTLS{CA: certPath}, true},
+		// pins
+		{"127.0.0.1:" + port + "/tcp-tls#dns.gudgeon.test", &config.GudgeonSourceTLS{CA: certPath, Pins: []string{otherPin, pin}}, true},
+		{"127.0.0.1:" + port + "/tcp-tls#dns.gudgeon.test", &config.GudgeonSourceTLS{CA: certPath, Pins: []string{otherPin}}, false},
+	}
+
+	cacheEnabled := false
+	conf := &config.GudgeonConfig{Storage: &config.GudgeonStorage{CacheEnabled: &cacheEnabled}}
+
+	for _, d := range data {
+		resolvers := NewResolverMap(conf, []*config.GudgeonResolver{
+			{Name: "bootstrap", Hosts: []string{"127.0.0.1 dns.gudgeon.test"}},
+			{Name: "dot", Sources: []string{d.source}, Bootstrap: "bootstrap", TLS: d.tls},
+		})
+
+		request := new(dns.Msg)
+		request.SetQuestion("google.com.", dns.TypeA)
+		response, _, err := resolvers.Answer(nil, "dot", request)
+		if d.resolves && (err != nil || response == nil || len(response.Answer) < 1) {
+			t.Errorf("Expected source %s to resolve but it did not: %s", d.source, err)
+		} else if !d.resolves && response != nil && len(response.Answer) > 0 {
+			t.Errorf("Expected source %s to fail verification but it resolved", d.source)
+		}
+	}
+
+	// names are only allowed for tls sources
+	if source := newDNSSource("dns.gudgeon.test/tcp"); source != nil {
+		t.Errorf("Expected a non-tls source with a name to be rejected")
+	}
+}
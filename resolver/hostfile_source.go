@@ -253,7 +253,7 @@ func (hostFileSource *hostFileSource) respondToCNAME(name string, response *dns.
 }
 
 func (hostFileSource *hostFileSource) Name() string {
-	return "hostfile:" + hostFileSource.filePath
+	return hostFilePrefix + hostFileSource.filePath
 }
 
 func (hostFileSource *hostFileSource) Answer(rCon *RequestContext, context *ResolutionContext, request *dns.Msg) (*dns.Msg, error) {
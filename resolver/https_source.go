@@ -0,0 +1,227 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+const (
+	httpsPrefix         = "https://"
+	defaultHTTPSPort    = "443"
+	dohContentType      = "application/dns-message"
+	dohQueryParameter   = "dns"
+	maxGetQueryLength   = 2048 // longer encoded queries are sent with POST to keep urls reasonable
+	httpsRequestTimeout = 4 * time.Second
+)
+
+// forwards queries to a dns-over-https (rfc8484) server
+type httpsSource struct {
+	bootstrapper
+
+	endpoint string
+	port     string
+
+	transport *http.Transport
+	client    *http.Client
+
+	backoffTime *time.Time
+}
+
+func newHTTPSSource(sourceSpecification string) Source {
+	endpoint, err := url.Parse(sourceSpecification)
+	if err != nil || "https" != strings.ToLower(endpoint.Scheme) || "" == endpoint.Hostname() {
+		log.Errorf("Invalid DNS-over-HTTPS source '%s'", sourceSpecification)
+		return nil
+	}
+
+	source := new(httpsSource)
+	source.endpoint = endpoint.String()
+	source.host = endpoint.Hostname()
+	source.port = endpoint.Port()
+	if "" == source.port {
+		source.port = defaultHTTPSPort
+	}
+	source.bootstrap = defaultBootstrap
+
+	// a single transport keeps connections to the upstream alive between queries
+	source.transport = &http.Transport{
+		DialContext:         source.dial,
+		MaxIdleConnsPerHost: 8,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 2 * defaultTimeout,
+	}
+	// a custom dialer turns off http/2 unless the transport is configured for it explicitly
+	if err := http2.ConfigureTransport(source.transport); err != nil {
+		log.Warnf("Could not enable HTTP/2 for DNS-over-HTTPS source '%s': %s", source.endpoint, err)
+	}
+	source.client = &http.Client{
+		Transport: source.transport,
+		Timeout:   httpsRequestTimeout,
+	}
+
+	return source
+}
+
+func (source *httpsSource) Name() string {
+	return source.endpoint
+}
+
+// verify the server with the configured certificate authorities and pins
+func (source *httpsSource) setTLS(sourceTLS *config.GudgeonSourceTLS) error {
+	tlsConfig, err := sourceTLS.ClientConfig(source.host)
+	if err != nil {
+		return err
+	}
+	// keep the rest of the configuration (like the http/2 protocols) from the transport
+	if source.transport.TLSClientConfig == nil {
+		source.transport.TLSClientConfig = tlsConfig
+	} else {
+		source.transport.TLSClientConfig.RootCAs = tlsConfig.RootCAs
+		source.transport.TLSClientConfig.VerifyPeerCertificate = tlsConfig.VerifyPeerCertificate
+	}
+	return nil
+}
+
+// dial the bootstrapped addresses for the endpoint host instead of using the system resolver
+func (source *httpsSource) dial(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   defaultTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host != source.host {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	addresses := source.hostAddresses()
+	if len(addresses) < 1 {
+		return nil, fmt.Errorf("No addresses found for DNS-over-HTTPS host '%s'", host)
+	}
+
+	var conn net.Conn
+	for _, ip := range addresses {
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// build the http request for the message, GET is preferred because it is cache friendly
+func (source *httpsSource) httpRequest(packed []byte) (*http.Request, error) {
+	encoded := base64.RawURLEncoding.EncodeToString(packed)
+	if len(encoded) <= maxGetQueryLength {
+		separator := "?"
+		if strings.Contains(source.endpoint, "?") {
+			separator = "&"
+		}
+		request, err := http.NewRequest(http.MethodGet, source.endpoint+separator+dohQueryParameter+"="+encoded, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Accept", dohContentType)
+		return request, nil
+	}
+
+	request, err := http.NewRequest(http.MethodPost, source.endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", dohContentType)
+	request.Header.Set("Accept", dohContentType)
+	return request, nil
+}
+
+func (source *httpsSource) query(request *dns.Msg) (*dns.Msg, error) {
+	// the rfc recommends an id of zero so that responses can be cached by http caches
+	query := request.Copy()
+	query.Id = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest, err := source.httpRequest(packed)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResponse, err := source.client.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS source '%s' responded with status %d", source.endpoint, httpResponse.StatusCode)
+	}
+	if contentType := httpResponse.Header.Get("Content-Type"); !strings.HasPrefix(contentType, dohContentType) {
+		return nil, fmt.Errorf("DNS-over-HTTPS source '%s' responded with unexpected content type '%s'", source.endpoint, contentType)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(httpResponse.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	response := new(dns.Msg)
+	if err := response.Unpack(body); err != nil {
+		return nil, err
+	}
+
+	// restore the id of the original request
+	response.Id = request.Id
+
+	return response, nil
+}
+
+func (source *httpsSource) Answer(rCon *RequestContext, context *ResolutionContext, request *dns.Msg) (*dns.Msg, error) {
+	now := time.Now()
+	if source.backoffTime != nil && now.Before(*source.backoffTime) {
+		// "asleep" during backoff interval
+		return nil, nil
+	}
+	// the backoff time is irrelevant now
+	source.backoffTime = nil
+
+	// this is considered a recursive query so don't if recursion was not requested
+	if request == nil || !request.MsgHdr.RecursionDesired {
+		return nil, nil
+	}
+
+	if err := source.lookupHost(rCon, context); err != nil {
+		return nil, err
+	}
+
+	response, err := source.query(request)
+	if err != nil {
+		backoff := time.Now().Add(backoffInterval)
+		source.backoffTime = &backoff
+		return nil, err
+	}
+
+	// set source as answering source
+	if context != nil && !util.IsEmptyResponse(response) && context.SourceUsed == "" {
+		context.SourceUsed = source.Name()
+	}
+
+	return response, nil
+}
@@ -0,0 +1,118 @@
+package resolver
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+// a stand-in for a dns-over-https server that answers every A question with 10.0.0.1
+func dohTestHandler(requests *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+
+		var msgBytes []byte
+		var err error
+		if r.Method == http.MethodGet {
+			msgBytes, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		} else if r.Header.Get("Content-Type") == dohContentType {
+			msgBytes, err = ioutil.ReadAll(r.Body)
+		} else {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		request := new(dns.Msg)
+		if err := request.Unpack(msgBytes); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		response := new(dns.Msg)
+		response.SetReply(request)
+		response.Answer = append(response.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: request.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("10.0.0.1"),
+		})
+		packed, _ := response.Pack()
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(packed)
+	}
+}
+
+func TestHTTPSSourceResolution(t *testing.T) {
+	requests := int32(0)
+	server := httptest.NewTLSServer(dohTestHandler(&requests))
+	defer server.Close()
+
+	// the test certificate is valid for example.com so use the bootstrap resolver to point it at the test server
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "https://"))
+	endpoint := "https://example.com:" + port + "/dns-query"
+
+	cacheEnabled := false
+	conf := &config.GudgeonConfig{Storage: &config.GudgeonStorage{CacheEnabled: &cacheEnabled}}
+	resolvers := NewResolverMap(conf, []*config.GudgeonResolver{
+		{Name: "bootstrap", Hosts: []string{"127.0.0.1 example.com"}},
+		{Name: "doh", Sources: []string{endpoint}, Bootstrap: "bootstrap"},
+	})
+
+	// trust the test server
+	source := resolvers.(*resolverMap).resolvers["doh"].(*resolver).sources[0].(*httpsSource)
+	source.transport.TLSClientConfig.RootCAs = server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	for _, domain := range []string{"google.com.", "cloudflare.com.", strings.Repeat("a", 60) + "." + strings.Repeat("b", 60) + ".com."} {
+		request := new(dns.Msg)
+		request.SetQuestion(domain, dns.TypeA)
+		request.Id = 1234
+
+		response, result, err := resolvers.Answer(nil, "doh", request)
+		if err != nil {
+			t.Errorf("Could not resolve %s: %s", domain, err)
+			continue
+		}
+		if response == nil || len(response.Answer) < 1 {
+			t.Errorf("No answers for question: %s", domain)
+			continue
+		}
+		if response.Id != request.Id {
+			t.Errorf("Expected response id %d but got %d", request.Id, response.Id)
+		}
+		if result.Source != endpoint {
+			t.Errorf("Expected source '%s' but got '%s'", endpoint, result.Source)
+		}
+	}
+
+	if requests != 3 {
+		t.Errorf("Expected 3 requests to the DNS-over-HTTPS server but got %d", requests)
+	}
+
+	// large queries are sent with POST
+	source.backoffTime = nil
+	packed := make([]byte, maxGetQueryLength)
+	httpRequest, _ := source.httpRequest(packed)
+	if httpRequest.Method != http.MethodPost {
+		t.Errorf("Expected large queries to use POST but got %s", httpRequest.Method)
+	}
+}
+
+func TestHTTPSSourceSpecification(t *testing.T) {
+	if _, ok := NewSource("https://dns.example.com/dns-query").(*httpsSource); !ok {
+		t.Errorf("Expected an https url to create a DNS-over-HTTPS source")
+	}
+	if source := newHTTPSSource("https:///dns-query"); source != nil {
+		t.Errorf("Expected an https url without a host to be rejected")
+	}
+}
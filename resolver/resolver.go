@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"strings"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/ryanuber/go-glob"
@@ -12,8 +13,11 @@ import (
 )
 
 type RequestContext struct {
-	Protocol string   // the protocol that the request came in with
-	Groups   []string // the groups that belong to the original requester
+	Protocol string    // the protocol that the request came in with
+	Consumer string    // the name of the consumer that made the request (if known)
+	Groups   []string  // the groups that belong to the original requester
+	Rewrites int       // the number of rewrites applied while answering the request
+	Time     time.Time // the time used to evaluate schedules, the current time is used if not set
 }
 
 func DefaultRequestContext() *RequestContext {
@@ -105,8 +109,14 @@ func newSharedSourceResolver(configuredResolver *config.GudgeonResolver, sharedR
 		} else {
 			var source Source
 
+			// sources that bootstrap through a different resolver or verify tls differently can't be shared with other resolvers
+			sharedKey := configuredSource
+			if "" != configuredResolver.Bootstrap || configuredResolver.TLS != nil {
+				sharedKey = configuredSource + "@" + configuredResolver.Name
+			}
+
 			if sharedResolvers != nil {
-				if sharedSource, found := sharedResolvers[configuredSource]; found {
+				if sharedSource, found := sharedResolvers[sharedKey]; found {
 					resolver.sources = append(resolver.sources, sharedSource)
 					source = sharedSource
 				}
@@ -115,10 +125,21 @@ func newSharedSourceResolver(configuredResolver *config.GudgeonResolver, sharedR
 			if source == nil {
 				source := NewSource(configuredSource)
 				if source != nil {
+					// sources that need to look up their own host use the configured bootstrap resolver
+					if bootstrapped, ok := source.(bootstrapSource); ok {
+						bootstrapped.setBootstrap(configuredResolver.Bootstrap)
+					}
+					// and tls sources verify with the resolver's tls settings
+					if secured, ok := source.(tlsSource); ok && configuredResolver.TLS != nil {
+						if err := secured.setTLS(configuredResolver.TLS); err != nil {
+							log.Errorf("Could not configure TLS for source '%s': %s", source.Name(), err)
+							continue
+						}
+					}
 					log.Infof("Loaded source: %s", source.Name())
 					resolver.sources = append(resolver.sources, source)
 					if sharedResolvers != nil {
-						sharedResolvers[configuredSource] = source
+						sharedResolvers[sharedKey] = source
 					}
 				}
 			}
@@ -37,9 +37,22 @@ type ResolutionResult struct {
 	Blocked bool
 
 	// reporting on matches
-	Match     rule.Match          // allowed or blocked
-	MatchList *config.GudgeonList // name of blocked list
-	MatchRule string              // name of actual rule
+	Match      rule.Match          // allowed or blocked
+	MatchList  *config.GudgeonList // name of blocked list
+	MatchRule  string              // name of actual rule
+	MatchCname string              // cname target in the answer that matched (instead of the question)
+
+	// a block match was ignored because blocking was paused
+	Paused bool
+
+	// reporting on rebind protection
+	Rebind       bool // the answer was rejected because it had private addresses for a public name
+	RebindExempt bool // the answer had private addresses but the domain or resolver is exempt
+
+	// reporting on rewrites
+	Rewritten   bool                // the answer was rewritten
+	RewriteList *config.GudgeonList // list that the rewrite came from
+	RewriteRule string              // text of the rewrite rule
 }
 
 func result(context *ResolutionContext) *ResolutionResult {
@@ -9,10 +9,16 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
 )
 
 const (
 	ttl = 60 // default to a small ttl because some things (fire tv/kodi I'm looking at you) will hammer the DNS
+
+	// prefixes of the names of sources that answer from local files
+	hostFilePrefix = "hostfile:"
+	zoneFilePrefix = "zonefile:"
 )
 
 type Source interface {
@@ -20,6 +26,16 @@ type Source interface {
 	Answer(rCon *RequestContext, context *ResolutionContext, request *dns.Msg) (*dns.Msg, error)
 }
 
+// sources that connect with tls can be configured to verify the upstream certificate
+type tlsSource interface {
+	setTLS(sourceTLS *config.GudgeonSourceTLS) error
+}
+
+// true if the named source answers from local data (hosts or zone files) instead of asking an upstream server
+func IsLocalSource(sourceName string) bool {
+	return strings.HasPrefix(sourceName, hostFilePrefix) || strings.HasPrefix(sourceName, zoneFilePrefix)
+}
+
 func NewSource(sourceSpecification string) Source {
 	// a source that exists as a file is a hostfile source
 	if _, err := os.Stat(sourceSpecification); !os.IsNotExist(err) {
@@ -34,6 +50,11 @@ func NewSource(sourceSpecification string) Source {
 		return newHostFileSource(sourceSpecification)
 	}
 
+	// a source that is an https url is a dns-over-https source
+	if strings.HasPrefix(strings.ToLower(sourceSpecification), httpsPrefix) {
+		return newHTTPSSource(sourceSpecification)
+	}
+
 	// a source that is an IP or that has other hallmarks of an address is a dns source
 	if ip := net.ParseIP(sourceSpecification); ip != nil || strings.Contains(sourceSpecification, ":") || strings.Contains(sourceSpecification, "/") {
 		return newDNSSource(sourceSpecification)
@@ -113,7 +113,7 @@ func (zoneSource *zoneSource) addRecord(rr dns.RR) {
 }
 
 func (zoneSource *zoneSource) Name() string {
-	return "zonefile:" + zoneSource.filePath
+	return zoneFilePrefix + zoneSource.filePath
 }
 
 func (zoneSource *zoneSource) resolveName(name string, qClass uint16, qType uint16, intoResponse *dns.Msg) {
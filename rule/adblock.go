@@ -0,0 +1,136 @@
+package rule
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	adblockException   = "@@"
+	adblockDomainStart = "||"
+	adblockStart       = "|"
+	adblockSeparator   = "^"
+	adblockOptions     = "$"
+
+	adblockImportant = "important"
+	adblockBadFilter = "badfilter"
+)
+
+// markers of cosmetic (element hiding, css, and scriptlet) rules that only apply inside of a browser
+var adblockCosmeticMarkers = []string{"##", "#@#", "#?#", "#@?#", "#$#", "#@$#", "#%#", "#@%#", "$$", "$@$"}
+
+// the characters that can be in the domain part of an adblock rule that is used as a dns rule
+var adblockDomainRegex = regexp.MustCompile("^[a-z0-9_*.-]+$")
+
+// a rule read from a line of a list, adblock style rules can be exceptions, can be important, or can disable another rule
+type ListRule struct {
+	// the rule that is loaded into the store
+	Text string
+	// the rule allows the domain even inside of a block list
+	Exception bool
+	// the rule blocks the domain even when an exception or an allow list matches it
+	Important bool
+	// the rule disables the same rule (without $badfilter) in every list
+	BadFilter bool
+	// the line is an adblock rule that can't be used for dns (cosmetic, path, or unsupported option) and is skipped
+	Unsupported bool
+}
+
+// a key that is the same for a rule and the $badfilter rule that disables it
+func (listRule *ListRule) key() string {
+	key := listRule.Text
+	if listRule.Exception {
+		key = adblockException + key
+	}
+	if listRule.Important {
+		key = key + adblockOptions + adblockImportant
+	}
+	return key
+}
+
+// true if the line uses adblock syntax instead of the hosts or plain domain syntax
+func isAdblockLine(line string) bool {
+	return strings.HasPrefix(line, adblockException) || strings.HasPrefix(line, adblockStart) || strings.Contains(line, adblockSeparator) || strings.Contains(line, adblockOptions)
+}
+
+// parse a line from a list in either the hosts, plain domain, or adblock syntax, nil is returned for empty lines and comments
+func ParseListLine(line string) *ListRule {
+	line = strings.TrimSpace(line)
+
+	// adblock comments and headers are skipped along with the usual comments
+	if "" == line || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	for _, marker := range adblockCosmeticMarkers {
+		if strings.Contains(line, marker) {
+			return &ListRule{Unsupported: true}
+		}
+	}
+
+	if !isAdblockLine(line) {
+		text := ParseLine(line)
+		if "" == text {
+			return nil
+		}
+		return &ListRule{Text: text}
+	}
+
+	return parseAdblockRule(line)
+}
+
+// parse a network rule in adblock syntax into a dns rule
+func parseAdblockRule(line string) *ListRule {
+	listRule := &ListRule{}
+
+	if strings.HasPrefix(line, adblockException) {
+		listRule.Exception = true
+		line = line[len(adblockException):]
+	}
+
+	// split off and check the options, a rule with any option other than important or badfilter is not a dns rule
+	pattern := line
+	if idx := strings.LastIndex(line, adblockOptions); idx >= 0 && !(strings.HasPrefix(line, ruleRegex) && strings.HasSuffix(line, ruleRegex)) {
+		pattern = line[:idx]
+		for _, option := range strings.Split(line[idx+1:], ",") {
+			switch strings.ToLower(strings.TrimSpace(option)) {
+			case adblockImportant:
+				listRule.Important = true
+			case adblockBadFilter:
+				listRule.BadFilter = true
+			default:
+				return &ListRule{Unsupported: true}
+			}
+		}
+	}
+
+	// regex rules are kept as they are
+	if strings.HasPrefix(pattern, ruleRegex) && strings.HasSuffix(pattern, ruleRegex) && len(pattern) > 1 {
+		listRule.Text = pattern
+		return listRule
+	}
+
+	// a rule that starts with a single | only matches the exact domain and not the subdomains
+	exact := false
+	if strings.HasPrefix(pattern, adblockDomainStart) {
+		pattern = pattern[len(adblockDomainStart):]
+	} else if strings.HasPrefix(pattern, adblockStart) {
+		pattern = pattern[len(adblockStart):]
+		exact = true
+	}
+	pattern = strings.TrimSuffix(pattern, adblockStart)
+	pattern = strings.TrimSuffix(pattern, adblockSeparator)
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+
+	// anything left that isn't a domain (like a path or a url scheme) can't be used for dns
+	if "" == pattern || !adblockDomainRegex.MatchString(pattern) {
+		return &ListRule{Unsupported: true}
+	}
+
+	if exact {
+		pattern = ruleRegex + "^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$" + ruleRegex
+	}
+
+	listRule.Text = pattern
+	return listRule
+}
@@ -0,0 +1,151 @@
+package rule
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestParseListLine(t *testing.T) {
+	data := []struct {
+		input    string
+		expected *ListRule
+	}{
+		{"", nil},
+		{"! adblock comment", nil},
+		{"[Adblock Plus 2.0]", nil},
+		{"# comment", nil},
+		{"ads.com", &ListRule{Text: "ads.com"}},
+		{"0.0.0.0 ads.com", &ListRule{Text: "ads.com"}},
+		{"||ads.com^", &ListRule{Text: "ads.com"}},
+		{"||Ads.Com^|", &ListRule{Text: "ads.com"}},
+		{"||*.ads.com^", &ListRule{Text: "*.ads.com"}},
+		{"|ads.com^", &ListRule{Text: "/^ads\\.com$/"}},
+		{"@@||ads.com^", &ListRule{Text: "ads.com", Exception: true}},
+		{"||ads.com^$important", &ListRule{Text: "ads.com", Important: true}},
+		{"||ads.com^$badfilter", &ListRule{Text: "ads.com", BadFilter: true}},
+		{"@@||ads.com^$important,badfilter", &ListRule{Text: "ads.com", Exception: true, Important: true, BadFilter: true}},
+		{"/^ad[0-9]+\\./", &ListRule{Text: "/^ad[0-9]+\\./"}},
+		{"/ads$/$important", &ListRule{Text: "/ads$/", Important: true}},
+		{"||ads.com^$third-party", &ListRule{Unsupported: true}},
+		{"||ads.com/banner.gif", &ListRule{Unsupported: true}},
+		{"example.com##.banner", &ListRule{Unsupported: true}},
+		{"example.com#@#.banner", &ListRule{Unsupported: true}},
+		{"||^", &ListRule{Unsupported: true}},
+	}
+
+	for _, d := range data {
+		result := ParseListLine(d.input)
+		if d.expected == nil || result == nil {
+			if d.expected != result {
+				t.Errorf("Input '%s' should parse to %v but got %v", d.input, d.expected, result)
+			}
+			continue
+		}
+		if *d.expected != *result {
+			t.Errorf("Input '%s' should parse to %+v but got %+v", d.input, *d.expected, *result)
+		}
+	}
+}
+
+func TestAdblockStore(t *testing.T) {
+	tmpDir := testutil.TempDir()
+	defer os.RemoveAll(tmpDir)
+
+	lists := map[string][]string{
+		"ads": {
+			"! ads list",
+			"||ads.com^",
+			"@@||good.ads.com^",
+			"||tracker.com^$important",
+			"||removed.com^",
+			"||shop.com/ads",
+			"shop.com##.banner",
+		},
+		"allowed": {
+			"tracker.com",
+			"ads.com",
+		},
+		"fixes": {
+			"||removed.com^$badfilter",
+		},
+	}
+
+	conf := &config.GudgeonConfig{Home: tmpDir, Storage: &config.GudgeonStorage{}}
+	for _, name := range []string{"ads", "allowed", "fixes"} {
+		source := path.Join(tmpDir, name+".list")
+		if err := ioutil.WriteFile(source, []byte(strings.Join(lists[name], "\n")), 0644); err != nil {
+			t.Fatalf("Could not write list: %s", err)
+		}
+		listType := "block"
+		if "allowed" == name {
+			listType = ALLOWSTRING
+		}
+		conf.Lists = append(conf.Lists, &config.GudgeonList{Name: name, Type: listType, Source: source})
+	}
+
+	store, loaded, skipped := CreateStore(tmpDir, conf)
+	defer store.Close()
+
+	if loaded[0] != 3 || skipped[0] != 2 {
+		t.Errorf("List 'ads' should load 3 rules and skip 2 but loaded %d and skipped %d", loaded[0], skipped[0])
+	}
+
+	data := []struct {
+		lists    []string
+		domain   string
+		match    Match
+		list     string
+		ruleText string
+	}{
+		{[]string{"ads"}, "ads.com", MatchBlock, "ads", "ads.com"},
+		{[]string{"ads"}, "www.ads.com", MatchBlock, "ads", "ads.com"},
+		{[]string{"ads"}, "good.ads.com", MatchAllow, "ads", "@@good.ads.com"},
+		{[]string{"ads"}, "tracker.com", MatchBlock, "ads", "tracker.com$important"},
+		{[]string{"ads", "allowed"}, "tracker.com", MatchBlock, "ads", "tracker.com$important"},
+		{[]string{"ads", "allowed"}, "ads.com", MatchAllow, "allowed", "ads.com"},
+		{[]string{"ads", "fixes"}, "removed.com", MatchNone, "", ""},
+		{[]string{"ads"}, "shop.com", MatchNone, "", ""},
+		{[]string{"fixes"}, "good.ads.com", MatchNone, "", ""},
+	}
+
+	for _, d := range data {
+		findLists := make([]*config.GudgeonList, 0)
+		for _, name := range d.lists {
+			for _, list := range conf.Lists {
+				if name == list.CanonicalName() {
+					findLists = append(findLists, list)
+				}
+			}
+		}
+		match, list, ruleText := store.FindMatch(findLists, d.domain)
+		listName := ""
+		if list != nil {
+			listName = list.CanonicalName()
+		}
+		if match != d.match || listName != d.list || ruleText != d.ruleText {
+			t.Errorf("Domain '%s' should match %d with '%s' in list '%s' but got %d with '%s' in list '%s'", d.domain, d.match, d.ruleText, d.list, match, ruleText, listName)
+		}
+	}
+
+	// every matching rule is found, including the exception and important rules of the block list
+	expected := []string{"ads @@good.ads.com", "ads ads.com", "allowed ads.com"}
+	matches := store.FindAllMatches(conf.Lists, "www.good.ads.com")
+	if len(matches) != len(expected) {
+		t.Errorf("Expected %d matches but found %d", len(expected), len(matches))
+		return
+	}
+	for idx, match := range matches {
+		if found := match.List.CanonicalName() + " " + match.Rule; found != expected[idx] {
+			t.Errorf("Expected match '%s' but found '%s'", expected[idx], found)
+		}
+	}
+	if matches := store.FindAllMatches(conf.Lists, "tracker.com"); len(matches) != 2 || matches[0].Rule != "tracker.com$important" || matches[0].Match != MatchBlock || matches[1].Match != MatchAllow {
+		t.Errorf("Expected the important rule and the allow rule to match 'tracker.com'")
+	}
+}
@@ -0,0 +1,91 @@
+package rule
+
+// finds every one of a set of literal patterns in a text with one pass over the text
+type ahoCorasick struct {
+	// the state reached from a state with a byte, keyed by state<<8 | byte, the root is state 0
+	transitions map[uint64]uint32
+	// the state for the longest proper suffix of each state that is also in the trie
+	fail []uint32
+	// the patterns found when a state is reached, including the patterns of the states along its failure links
+	outputs [][]int
+}
+
+func transitionKey(state uint32, b byte) uint64 {
+	return uint64(state)<<8 | uint64(b)
+}
+
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{
+		transitions: make(map[uint64]uint32),
+		fail:        []uint32{0},
+		outputs:     [][]int{nil},
+	}
+
+	// the trie of patterns, the children of each state are only needed to set the failure links
+	type edge struct {
+		b     byte
+		state uint32
+	}
+	children := [][]edge{nil}
+	for idx, pattern := range patterns {
+		state := uint32(0)
+		for i := 0; i < len(pattern); i++ {
+			next, found := ac.transitions[transitionKey(state, pattern[i])]
+			if !found {
+				next = uint32(len(ac.fail))
+				ac.fail = append(ac.fail, 0)
+				ac.outputs = append(ac.outputs, nil)
+				children = append(children, nil)
+				children[state] = append(children[state], edge{b: pattern[i], state: next})
+				ac.transitions[transitionKey(state, pattern[i])] = next
+			}
+			state = next
+		}
+		ac.outputs[state] = append(ac.outputs[state], idx)
+	}
+
+	// failure links are set breadth first so that the links of shallower states are ready
+	queue := []uint32{0}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for _, child := range children[state] {
+			if state != 0 {
+				fail := ac.fail[state]
+				for {
+					if next, found := ac.transitions[transitionKey(fail, child.b)]; found {
+						ac.fail[child.state] = next
+						break
+					}
+					if fail == 0 {
+						break
+					}
+					fail = ac.fail[fail]
+				}
+			}
+			ac.outputs[child.state] = append(ac.outputs[child.state], ac.outputs[ac.fail[child.state]]...)
+			queue = append(queue, child.state)
+		}
+	}
+
+	return ac
+}
+
+// append the index of each pattern found in the text to found, a pattern is given once for each time it is found
+func (ac *ahoCorasick) find(text string, found []int) []int {
+	state := uint32(0)
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := ac.transitions[transitionKey(state, text[i])]; ok {
+				state = next
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = ac.fail[state]
+		}
+		found = append(found, ac.outputs[state]...)
+	}
+	return found
+}
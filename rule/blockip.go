@@ -0,0 +1,199 @@
+package rule
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// a node in a binary prefix trie, each level of the trie is one bit of the address
+type ipNode struct {
+	children [2]*ipNode
+	// the text of the rule that ends at this node, empty if no rule ends here
+	rule string
+}
+
+// the prefixes of a single block-ip list, ipv4 and ipv6 addresses are kept apart
+type ipTrie struct {
+	v4 *ipNode
+	v6 *ipNode
+}
+
+// stores the addresses and networks of each block-ip list in prefix tries
+type IPStore struct {
+	lists map[string]*ipTrie
+}
+
+// true if the list is a block-ip list that is checked against the addresses in answers
+func IsIPList(list *config.GudgeonList) bool {
+	return list != nil && ParseType(list.Type) == BLOCKIP
+}
+
+// parse a block-ip line that is either a single address or a network in CIDR notation, the
+// text of the rule is returned with the network
+func ParseIPRule(line string) (*net.IPNet, string) {
+	line = strings.TrimSpace(util.TrimComments(line))
+	if "" == line || len(strings.Fields(line)) != 1 {
+		return nil, ""
+	}
+
+	if strings.Contains(line, "/") {
+		_, network, err := net.ParseCIDR(line)
+		if err != nil {
+			return nil, ""
+		}
+		return network, line
+	}
+
+	ip := net.ParseIP(line)
+	if ip == nil {
+		return nil, ""
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return &net.IPNet{IP: ipv4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}, line
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}, line
+}
+
+// read all of the block-ip lists in the configuration into an ip store, the counts
+// are given in the same order as the configured lists (with zero for other lists)
+func CreateIPStore(config *config.GudgeonConfig) (*IPStore, []uint64) {
+	store := &IPStore{
+		lists: make(map[string]*ipTrie),
+	}
+
+	outputCount := make([]uint64, 0, len(config.Lists))
+	for _, list := range config.Lists {
+		if !IsIPList(list) {
+			outputCount = append(outputCount, 0)
+			continue
+		}
+
+		data, err := os.Open(config.PathToList(list))
+		if err != nil {
+			log.Errorf("Could not open block-ip list file: %s", err)
+			outputCount = append(outputCount, 0)
+			continue
+		}
+
+		listCounter := uint64(0)
+		scanner := bufio.NewScanner(data)
+		for scanner.Scan() {
+			line := scanner.Text()
+			network, text := ParseIPRule(line)
+			if network == nil {
+				if "" != strings.TrimSpace(util.TrimComments(line)) {
+					log.Warnf("Could not parse address or network '%s' in list '%s'", strings.TrimSpace(line), list.CanonicalName())
+				}
+				continue
+			}
+			store.Load(list, network, text)
+			listCounter++
+		}
+		data.Close()
+
+		outputCount = append(outputCount, listCounter)
+	}
+
+	return store, outputCount
+}
+
+// the bit of the address at the given index, counting from the most significant bit
+func ipBit(ip net.IP, index int) int {
+	return int(ip[index/8]>>uint(7-index%8)) & 1
+}
+
+// add the prefix of the given length (out of the given number of bits) to the trie
+func (trie *ipTrie) insert(ip net.IP, ones int, bits int, text string) {
+	root := &trie.v6
+	if ipv4 := ip.To4(); ipv4 != nil {
+		// ipv4-mapped ipv6 networks are stored as ipv4 networks
+		if bits == 8*net.IPv6len {
+			ones -= 8 * (net.IPv6len - net.IPv4len)
+		}
+		if ones < 0 {
+			ones = 0
+		}
+		ip = ipv4
+		root = &trie.v4
+	} else {
+		ip = ip.To16()
+	}
+	if *root == nil {
+		*root = &ipNode{}
+	}
+
+	node := *root
+	for index := 0; index < ones; index++ {
+		bit := ipBit(ip, index)
+		if node.children[bit] == nil {
+			node.children[bit] = &ipNode{}
+		}
+		node = node.children[bit]
+	}
+
+	// the first rule for a prefix wins
+	if "" == node.rule {
+		node.rule = text
+	}
+}
+
+// the rule of the longest prefix in the trie that contains the address, empty if there is none
+func (trie *ipTrie) find(ip net.IP) string {
+	node := trie.v6
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+		node = trie.v4
+	} else {
+		ip = ip.To16()
+	}
+
+	matched := ""
+	for index := 0; node != nil; index++ {
+		if "" != node.rule {
+			matched = node.rule
+		}
+		if index >= 8*len(ip) {
+			break
+		}
+		node = node.children[ipBit(ip, index)]
+	}
+	return matched
+}
+
+// add a network to the given list
+func (store *IPStore) Load(list *config.GudgeonList, network *net.IPNet, text string) {
+	name := list.CanonicalName()
+	if _, found := store.lists[name]; !found {
+		store.lists[name] = &ipTrie{}
+	}
+	ones, bits := network.Mask.Size()
+	store.lists[name].insert(network.IP, ones, bits, text)
+}
+
+// find the first list (in order) with a network that contains the address, the most specific matching
+// rule of that list is returned
+func (store *IPStore) FindIP(lists []*config.GudgeonList, ip net.IP) (*config.GudgeonList, string) {
+	if store == nil || ip == nil {
+		return nil, ""
+	}
+
+	for _, list := range lists {
+		if !IsIPList(list) {
+			continue
+		}
+		if trie, found := store.lists[list.CanonicalName()]; found {
+			if matched := trie.find(ip); "" != matched {
+				return list, matched
+			}
+		}
+	}
+
+	return nil, ""
+}
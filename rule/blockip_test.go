@@ -0,0 +1,91 @@
+package rule
+
+import (
+	"net"
+	"testing"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+func TestParseIPRule(t *testing.T) {
+	data := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"# comment", ""},
+		{"blocked.com", ""},
+		{"10.0.0.0/8 10.0.0.1", ""},
+		{"10.0.0.0/33", ""},
+		{"10.0.0.1", "10.0.0.1/32"},
+		{"10.0.0.0/8 # private", "10.0.0.0/8"},
+		{"10.1.2.3/8", "10.0.0.0/8"},
+		{"fd00::1", "fd00::1/128"},
+		{"fc00::/7", "fc00::/7"},
+	}
+
+	for _, d := range data {
+		network, _ := ParseIPRule(d.input)
+		if "" == d.expected {
+			if network != nil {
+				t.Errorf("Input '%s' should not be an address or network", d.input)
+			}
+			continue
+		}
+		if network == nil {
+			t.Errorf("Input '%s' should be an address or network", d.input)
+			continue
+		}
+		if network.String() != d.expected {
+			t.Errorf("Input '%s' should have network '%s' but got '%s'", d.input, d.expected, network.String())
+		}
+	}
+}
+
+func TestIPStore(t *testing.T) {
+	private := &config.GudgeonList{Name: "private", Type: BLOCKIPSTRING}
+	malware := &config.GudgeonList{Name: "malware", Type: BLOCKIPSTRING}
+	domains := &config.GudgeonList{Name: "domains"}
+
+	store := &IPStore{lists: make(map[string]*ipTrie)}
+	for _, line := range []string{"10.0.0.0/8", "10.10.0.0/16", "192.168.0.0/16", "fc00::/7", "::ffff:172.16.0.0/108"} {
+		network, text := ParseIPRule(line)
+		store.Load(private, network, text)
+	}
+	for _, line := range []string{"10.10.10.10", "0.0.0.0/0", "2001:db8::/32"} {
+		network, text := ParseIPRule(line)
+		store.Load(malware, network, text)
+	}
+
+	data := []struct {
+		lists    []*config.GudgeonList
+		address  string
+		list     string
+		expected string
+	}{
+		{[]*config.GudgeonList{private}, "10.1.2.3", "private", "10.0.0.0/8"},
+		{[]*config.GudgeonList{private}, "10.10.10.10", "private", "10.10.0.0/16"},
+		{[]*config.GudgeonList{private}, "192.168.1.1", "private", "192.168.0.0/16"},
+		{[]*config.GudgeonList{private}, "172.16.0.1", "private", "::ffff:172.16.0.0/108"},
+		{[]*config.GudgeonList{private}, "172.32.0.1", "", ""},
+		{[]*config.GudgeonList{private}, "11.0.0.1", "", ""},
+		{[]*config.GudgeonList{private}, "fd00::1", "private", "fc00::/7"},
+		{[]*config.GudgeonList{private}, "fe80::1", "", ""},
+		{[]*config.GudgeonList{malware, private}, "10.10.10.10", "malware", "10.10.10.10"},
+		{[]*config.GudgeonList{malware}, "8.8.8.8", "malware", "0.0.0.0/0"},
+		{[]*config.GudgeonList{malware}, "2001:db8::1", "malware", "2001:db8::/32"},
+		{[]*config.GudgeonList{malware}, "2001:db9::1", "", ""},
+		{[]*config.GudgeonList{domains}, "10.1.2.3", "", ""},
+	}
+
+	for _, d := range data {
+		list, ruleText := store.FindIP(d.lists, net.ParseIP(d.address))
+		listName := ""
+		if list != nil {
+			listName = list.CanonicalName()
+		}
+		if listName != d.list || ruleText != d.expected {
+			t.Errorf("Address %s should match '%s' in list '%s' but got '%s' in list '%s'", d.address, d.expected, d.list, ruleText, listName)
+		}
+	}
+}
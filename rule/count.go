@@ -0,0 +1,46 @@
+package rule
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+// count the rules in a list file (as the list type reads them) without loading them into a store
+func CountRules(list *config.GudgeonList, path string) (uint64, error) {
+	// zones are read as a whole with the zone parser
+	if IsRPZList(list) {
+		store := &RPZStore{zones: make(map[string]*rpzZone)}
+		count, _, err := store.loadZone(list, path)
+		return count, err
+	}
+
+	data, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer data.Close()
+
+	count := uint64(0)
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case IsRewriteList(list):
+			if ParseRewrite(line) != nil {
+				count++
+			}
+		case IsIPList(list):
+			if network, _ := ParseIPRule(line); network != nil {
+				count++
+			}
+		default:
+			if listRule := ParseListLine(line); listRule != nil && !listRule.Unsupported && !listRule.BadFilter {
+				count++
+			}
+		}
+	}
+
+	return count, scanner.Err()
+}
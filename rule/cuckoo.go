@@ -0,0 +1,225 @@
+package rule
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/twmb/murmur3"
+)
+
+const (
+	cuckooBucketSize = 4
+	// how full the filter is allowed to get when it is sized, buckets of four can be filled to about 95%
+	cuckooLoadFactor = 0.9
+	// how many fingerprints are moved to make room before giving up
+	cuckooMaxKicks = 500
+)
+
+// a cuckoo filter with buckets of four 16 bit fingerprints, with a chance of a false positive of about 0.012% when it is
+// full, unlike a bloom filter a fingerprint can be taken out of the filter (but only rules that were put in can be taken
+// out, otherwise a rule with the same fingerprint is taken out in its place)
+type cuckooFilter struct {
+	// the fingerprints of each bucket in order, zero is an empty slot
+	slots []uint16
+	// the number of buckets is a power of two so that an index is found with the mask and the alternate of the alternate
+	// bucket is the first bucket
+	mask  uint64
+	count uint64
+
+	// the fingerprint that was left without a place when an insert gave up moving fingerprints, the filter takes no more
+	// rules while it is set
+	victim *cuckooVictim
+
+	// state for choosing the fingerprint to move
+	seed uint64
+}
+
+type cuckooVictim struct {
+	index       uint64
+	fingerprint uint16
+}
+
+// a filter with room for the given number of rules
+func newCuckooFilter(capacity uint) *cuckooFilter {
+	buckets := uint64(1)
+	for float64(buckets*cuckooBucketSize)*cuckooLoadFactor < float64(capacity) {
+		buckets <<= 1
+	}
+	return &cuckooFilter{
+		slots: make([]uint16, buckets*cuckooBucketSize),
+		mask:  buckets - 1,
+		seed:  1,
+	}
+}
+
+// the hash of the rule, the fingerprint is the top 16 bits and the first bucket in each filter is from the rest
+type cuckooHash uint64
+
+func hashCuckoo(rule string) cuckooHash {
+	return cuckooHash(murmur3.StringSum64(strings.ToLower(rule)))
+}
+
+// the first bucket and the fingerprint of the hash
+func (filter *cuckooFilter) index(hash cuckooHash) (uint64, uint16) {
+	fingerprint := uint16(hash >> 48)
+	if fingerprint == 0 {
+		fingerprint = 1
+	}
+	return uint64(hash) & filter.mask, fingerprint
+}
+
+// the other bucket that the fingerprint can be in
+func (filter *cuckooFilter) alternate(index uint64, fingerprint uint16) uint64 {
+	return (index ^ (uint64(fingerprint) * 0x5bd1e995)) & filter.mask
+}
+
+func (filter *cuckooFilter) bucket(index uint64) []uint16 {
+	return filter.slots[index*cuckooBucketSize : (index+1)*cuckooBucketSize]
+}
+
+func (filter *cuckooFilter) inBucket(index uint64, fingerprint uint16) bool {
+	for _, slot := range filter.bucket(index) {
+		if slot == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter *cuckooFilter) isVictim(first uint64, second uint64, fingerprint uint16) bool {
+	return filter.victim != nil && filter.victim.fingerprint == fingerprint && (filter.victim.index == first || filter.victim.index == second)
+}
+
+// put the fingerprint in an empty slot of the bucket, false if the bucket is full
+func (filter *cuckooFilter) place(index uint64, fingerprint uint16) bool {
+	bucket := filter.bucket(index)
+	for idx, slot := range bucket {
+		if slot == 0 {
+			bucket[idx] = fingerprint
+			return true
+		}
+	}
+	return false
+}
+
+// xorshift, the choice only needs to change between kicks
+func (filter *cuckooFilter) next() uint64 {
+	filter.seed ^= filter.seed << 13
+	filter.seed ^= filter.seed >> 7
+	filter.seed ^= filter.seed << 17
+	return filter.seed
+}
+
+// put the fingerprint in one of its buckets, moving other fingerprints to their alternate bucket to make room
+func (filter *cuckooFilter) insertFingerprint(index uint64, fingerprint uint16) {
+	if filter.place(index, fingerprint) || filter.place(filter.alternate(index, fingerprint), fingerprint) {
+		return
+	}
+	for kick := 0; kick < cuckooMaxKicks; kick++ {
+		bucket := filter.bucket(index)
+		slot := filter.next() % cuckooBucketSize
+		fingerprint, bucket[slot] = bucket[slot], fingerprint
+		index = filter.alternate(index, fingerprint)
+		if filter.place(index, fingerprint) {
+			return
+		}
+	}
+	filter.victim = &cuckooVictim{index: index, fingerprint: fingerprint}
+}
+
+func (filter *cuckooFilter) contains(hash cuckooHash) bool {
+	first, fingerprint := filter.index(hash)
+	second := filter.alternate(first, fingerprint)
+	return filter.inBucket(first, fingerprint) || filter.inBucket(second, fingerprint) || filter.isVictim(first, second, fingerprint)
+}
+
+// add the rule to the filter, false if the filter is full and the rule was not added
+func (filter *cuckooFilter) insert(hash cuckooHash) bool {
+	if filter.victim != nil {
+		return false
+	}
+	index, fingerprint := filter.index(hash)
+	filter.count++
+	filter.insertFingerprint(index, fingerprint)
+	return true
+}
+
+// take the rule out of the filter, false if it was not found
+func (filter *cuckooFilter) remove(hash cuckooHash) bool {
+	first, fingerprint := filter.index(hash)
+	second := filter.alternate(first, fingerprint)
+	if filter.isVictim(first, second, fingerprint) {
+		filter.victim = nil
+		filter.count--
+		return true
+	}
+
+	removed := false
+	for _, index := range []uint64{first, second} {
+		bucket := filter.bucket(index)
+		for idx, slot := range bucket {
+			if slot == fingerprint {
+				bucket[idx] = 0
+				removed = true
+				break
+			}
+		}
+		if removed {
+			break
+		}
+	}
+	if !removed {
+		return false
+	}
+	filter.count--
+
+	// there is room for the victim now
+	if victim := filter.victim; victim != nil {
+		filter.victim = nil
+		filter.insertFingerprint(victim.index, victim.fingerprint)
+	}
+	return true
+}
+
+// the bytes used by the fingerprints
+func (filter *cuckooFilter) memoryBytes() uint64 {
+	return uint64(len(filter.slots)) * 2
+}
+
+// the filter header is the mask, the count, and the victim (with a fingerprint of zero when there is no victim)
+func (filter *cuckooFilter) writeTo(writer io.Writer) error {
+	header := []uint64{filter.mask, filter.count, 0, 0}
+	if filter.victim != nil {
+		header[2], header[3] = filter.victim.index, uint64(filter.victim.fingerprint)
+	}
+	if err := binary.Write(writer, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	return binary.Write(writer, binary.LittleEndian, filter.slots)
+}
+
+func readCuckooFilter(reader io.Reader) (*cuckooFilter, error) {
+	header := make([]uint64, 4)
+	if err := binary.Read(reader, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	// the number of buckets is a power of two
+	if header[0] >= 1<<32 || header[0]&(header[0]+1) != 0 {
+		return nil, fmt.Errorf("Invalid cuckoo filter mask %d", header[0])
+	}
+	filter := &cuckooFilter{
+		slots: make([]uint16, (header[0]+1)*cuckooBucketSize),
+		mask:  header[0],
+		count: header[1],
+		seed:  1,
+	}
+	if header[3] != 0 {
+		filter.victim = &cuckooVictim{index: header[2], fingerprint: uint16(header[3])}
+	}
+	if err := binary.Read(reader, binary.LittleEndian, filter.slots); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
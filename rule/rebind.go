@@ -0,0 +1,37 @@
+package rule
+
+import (
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+const rebindListName = "rebind-protection"
+
+// the private (rfc1918), loopback, link-local, cgnat, and ula networks that public names should not resolve to
+var rebindNetworks = []string{
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+	"127.0.0.0/8", "::1/128",
+	"169.254.0.0/16", "fe80::/10",
+	"100.64.0.0/10",
+	"fc00::/7",
+}
+
+// the (generated) block-ip list that holds the networks used by rebind protection
+func RebindList() *config.GudgeonList {
+	return &config.GudgeonList{
+		Name: rebindListName,
+		Type: BLOCKIPSTRING,
+		Tags: &[]string{},
+	}
+}
+
+// load the rebind protection networks into the store (once) and return the list that holds them
+func (store *IPStore) LoadRebind() *config.GudgeonList {
+	list := RebindList()
+	if _, found := store.lists[list.CanonicalName()]; !found {
+		for _, line := range rebindNetworks {
+			network, text := ParseIPRule(line)
+			store.Load(list, network, text)
+		}
+	}
+	return list
+}
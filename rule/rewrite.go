@@ -0,0 +1,178 @@
+package rule
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// a rewrite replaces the answer for a domain (or a wildcard/regex match of a domain) with
+// either a CNAME to a target domain or with fixed A/AAAA answers
+type Rewrite struct {
+	// the domain (or complex rule) that is rewritten
+	Domain string
+	// the CNAME target, empty when the rewrite has fixed addresses
+	Target string
+	// the fixed addresses to answer with, empty when the rewrite has a target
+	Addresses []net.IP
+	// the text of the rule as it was read
+	Text string
+
+	// the complex rule used when the domain is a wildcard or regex
+	complexRule ComplexRule
+}
+
+// stores rewrites for each rewrite list
+type RewriteStore struct {
+	exact   map[string]map[string]*Rewrite
+	complex map[string][]*Rewrite
+}
+
+// true if the list is a rewrite list and not an allow/block list
+func IsRewriteList(list *config.GudgeonList) bool {
+	return list != nil && ParseType(list.Type) == REWRITE
+}
+
+// parse a rewrite line in the format "<domain> <target>" where the target is either a single domain
+// name (to create a CNAME) or one or more IP addresses separated by spaces or commas
+func ParseRewrite(line string) *Rewrite {
+	line = strings.TrimSpace(util.TrimComments(line))
+	if "" == line {
+		return nil
+	}
+
+	split := strings.Fields(strings.Replace(line, ",", " ", -1))
+	if len(split) < 2 {
+		return nil
+	}
+
+	rewrite := &Rewrite{
+		Domain: strings.ToLower(strings.TrimSuffix(split[0], ".")),
+		Text:   strings.Join(strings.Fields(line), " "),
+	}
+
+	if IsComplex(rewrite.Domain) {
+		rewrite.complexRule = CreateComplexRule(rewrite.Domain)
+		if rewrite.complexRule == nil {
+			return nil
+		}
+	}
+
+	// collect addresses, a target that isn't an address is a cname
+	for _, target := range split[1:] {
+		if ip := net.ParseIP(target); ip != nil {
+			rewrite.Addresses = append(rewrite.Addresses, ip)
+		} else if "" == rewrite.Target && len(split) == 2 {
+			rewrite.Target = dns.Fqdn(strings.ToLower(target))
+		} else {
+			return nil
+		}
+	}
+
+	return rewrite
+}
+
+// true if the rewrite applies to the given domain
+func (rewrite *Rewrite) IsMatch(domain string) bool {
+	if rewrite.complexRule != nil {
+		return rewrite.complexRule.IsMatch(domain)
+	}
+	return rewrite.Domain == domain
+}
+
+// true if the rewrite answers with a CNAME instead of fixed addresses
+func (rewrite *Rewrite) IsCNAME() bool {
+	return "" != rewrite.Target
+}
+
+// read all of the rewrite lists in the configuration into a rewrite store, the counts
+// are given in the same order as the configured lists (with zero for non-rewrite lists)
+func CreateRewriteStore(config *config.GudgeonConfig) (*RewriteStore, []uint64) {
+	store := &RewriteStore{
+		exact:   make(map[string]map[string]*Rewrite),
+		complex: make(map[string][]*Rewrite),
+	}
+
+	outputCount := make([]uint64, 0, len(config.Lists))
+	for _, list := range config.Lists {
+		if !IsRewriteList(list) {
+			outputCount = append(outputCount, 0)
+			continue
+		}
+
+		data, err := os.Open(config.PathToList(list))
+		if err != nil {
+			log.Errorf("Could not open rewrite list file: %s", err)
+			outputCount = append(outputCount, 0)
+			continue
+		}
+
+		listCounter := uint64(0)
+		scanner := bufio.NewScanner(data)
+		for scanner.Scan() {
+			line := scanner.Text()
+			rewrite := ParseRewrite(line)
+			if rewrite == nil {
+				if "" != strings.TrimSpace(util.TrimComments(line)) {
+					log.Warnf("Could not parse rewrite '%s' in list '%s'", strings.TrimSpace(line), list.CanonicalName())
+				}
+				continue
+			}
+			store.Load(list, rewrite)
+			listCounter++
+		}
+		data.Close()
+
+		outputCount = append(outputCount, listCounter)
+	}
+
+	return store, outputCount
+}
+
+// add a rewrite to the given list
+func (store *RewriteStore) Load(list *config.GudgeonList, rewrite *Rewrite) {
+	name := list.CanonicalName()
+	if rewrite.complexRule != nil {
+		store.complex[name] = append(store.complex[name], rewrite)
+		return
+	}
+	if _, found := store.exact[name]; !found {
+		store.exact[name] = make(map[string]*Rewrite)
+	}
+	// the first rewrite for a domain in a list wins
+	if _, found := store.exact[name][rewrite.Domain]; !found {
+		store.exact[name][rewrite.Domain] = rewrite
+	}
+}
+
+// find the first rewrite for the domain in the given lists (in order), exact domains are checked before complex rules in each list
+func (store *RewriteStore) FindRewrite(lists []*config.GudgeonList, domain string) (*Rewrite, *config.GudgeonList) {
+	if store == nil {
+		return nil, nil
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	for _, list := range lists {
+		if !IsRewriteList(list) {
+			continue
+		}
+		if rewrite, found := store.exact[list.CanonicalName()][domain]; found {
+			return rewrite, list
+		}
+		for _, rewrite := range store.complex[list.CanonicalName()] {
+			if rewrite.IsMatch(domain) {
+				return rewrite, list
+			}
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,356 @@
+package rule
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+const (
+	// answer with NXDOMAIN
+	RPZNXDOMAIN = uint8(0)
+	// answer with an empty (nodata) response
+	RPZNODATA = uint8(1)
+	// answer normally and skip any other policy
+	RPZPASSTHRU = uint8(2)
+	// do not answer at all
+	RPZDROP = uint8(3)
+	// answer with the records in the zone (a CNAME or A/AAAA addresses)
+	RPZLOCALDATA = uint8(4)
+
+	// the origin given to zones that don't set one, relative owner names are under it
+	rpzDefaultOrigin = "rpz.gudgeon."
+
+	// the cname targets that mean an action instead of local data
+	rpzTargetNXDomain = "."
+	rpzTargetNoData   = "*."
+	rpzTargetPassthru = "rpz-passthru."
+	rpzTargetDrop     = "rpz-drop."
+
+	// the labels that mark triggers other than the query name
+	rpzIPTrigger = "rpz-ip"
+	rpzWildcard  = "*."
+	rpzIPv6Zeros = "zz"
+)
+
+// triggers that are not supported and are skipped
+var rpzUnsupportedTriggers = []string{"rpz-nsdname", "rpz-nsip", "rpz-client-ip"}
+
+// the names of the actions for rule text and logging
+var rpzActionNames = map[uint8]string{
+	RPZNXDOMAIN: "NXDOMAIN",
+	RPZNODATA:   "NODATA",
+	RPZPASSTHRU: "PASSTHRU",
+	RPZDROP:     "DROP",
+}
+
+// a policy read from a response policy zone
+type RPZRule struct {
+	// the action taken when the rule is triggered
+	Action uint8
+	// the answer for local data rules
+	Rewrite *Rewrite
+	// the trigger and the action as text
+	Text string
+}
+
+// the triggers of a single rpz list
+type rpzZone struct {
+	// query names
+	names map[string]*RPZRule
+	// wildcard query names ("*.example.com") by the domain under the wildcard
+	wildcards map[string]*RPZRule
+	// rpz-ip triggers by the text of the network
+	ips     *ipTrie
+	ipRules map[string]*RPZRule
+}
+
+// stores the query name and ip triggers of each rpz list
+type RPZStore struct {
+	zones map[string]*rpzZone
+}
+
+// true if the list is a response policy zone
+func IsRPZList(list *config.GudgeonList) bool {
+	return list != nil && ParseType(list.Type) == RPZ
+}
+
+// the action that a cname target stands for
+func rpzCnameAction(target string) (uint8, bool) {
+	switch strings.ToLower(target) {
+	case rpzTargetNXDomain:
+		return RPZNXDOMAIN, true
+	case rpzTargetNoData:
+		return RPZNODATA, true
+	case rpzTargetPassthru:
+		return RPZPASSTHRU, true
+	case rpzTargetDrop:
+		return RPZDROP, true
+	}
+	return RPZLOCALDATA, false
+}
+
+// parse the network of an rpz-ip trigger from its labels (without the rpz-ip label), the labels are the prefix
+// length and then the address in reverse order, ipv6 addresses use "zz" for the longest run of zeros
+func ParseRPZIP(trigger string) *net.IPNet {
+	labels := strings.Split(trigger, ".")
+	if len(labels) < 2 {
+		return nil
+	}
+
+	address := make([]string, 0, len(labels)-1)
+	for idx := len(labels) - 1; idx > 0; idx-- {
+		address = append(address, labels[idx])
+	}
+
+	if len(address) == net.IPv4len {
+		if _, network, err := net.ParseCIDR(strings.Join(address, ".") + "/" + labels[0]); err == nil {
+			return network
+		}
+	}
+
+	text := strings.Join(address, ":")
+	if strings.HasPrefix(text, rpzIPv6Zeros) {
+		text = ":" + text
+	}
+	if strings.HasSuffix(text, rpzIPv6Zeros) {
+		text = text + ":"
+	}
+	text = strings.Replace(text, rpzIPv6Zeros, "", 1)
+
+	_, network, err := net.ParseCIDR(text + "/" + labels[0])
+	if err != nil {
+		return nil
+	}
+	return network
+}
+
+// read all of the rpz lists in the configuration into an rpz store, the counts of loaded and skipped (unsupported) rules
+// are given in the same order as the configured lists (with zero for other lists)
+func CreateRPZStore(config *config.GudgeonConfig) (*RPZStore, []uint64, []uint64) {
+	store := &RPZStore{
+		zones: make(map[string]*rpzZone),
+	}
+
+	outputCount := make([]uint64, 0, len(config.Lists))
+	skippedCount := make([]uint64, 0, len(config.Lists))
+	for _, list := range config.Lists {
+		if !IsRPZList(list) {
+			outputCount = append(outputCount, 0)
+			skippedCount = append(skippedCount, 0)
+			continue
+		}
+
+		loaded, skipped, err := store.loadZone(list, config.PathToList(list))
+		if err != nil {
+			log.Errorf("Could not read rpz list '%s': %s", list.CanonicalName(), err)
+		}
+		if skipped > 0 {
+			log.Infof("List '%s' skipped %d unsupported rpz rules", list.CanonicalName(), skipped)
+		}
+
+		outputCount = append(outputCount, loaded)
+		skippedCount = append(skippedCount, skipped)
+	}
+
+	return store, outputCount, skippedCount
+}
+
+// read the records of a zone file, the records for each owner name are collected and then turned into rules
+func (store *RPZStore) loadZone(list *config.GudgeonList, zoneFile string) (uint64, uint64, error) {
+	file, err := os.Open(zoneFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	origin := rpzDefaultOrigin
+	owners := make([]string, 0)
+	records := make(map[string][]dns.RR)
+
+	zp := dns.NewZoneParser(file, rpzDefaultOrigin, file.Name())
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		name := strings.ToLower(rr.Header().Name)
+		if soa, isSoa := rr.(*dns.SOA); isSoa {
+			origin = strings.ToLower(soa.Hdr.Name)
+			continue
+		}
+		if _, found := records[name]; !found {
+			owners = append(owners, name)
+		}
+		records[name] = append(records[name], rr)
+	}
+
+	loaded, skipped := uint64(0), uint64(0)
+	for _, owner := range owners {
+		// records at the zone origin (like NS) describe the zone and are not triggers
+		if owner == origin || !strings.HasSuffix(owner, "."+origin) {
+			continue
+		}
+		trigger := strings.TrimSuffix(owner, "."+origin)
+		if store.Load(list, trigger, records[owner]) {
+			loaded++
+		} else {
+			log.Debugf("Skipped rpz trigger '%s' in list '%s'", trigger, list.CanonicalName())
+			skipped++
+		}
+	}
+
+	return loaded, skipped, zp.Err()
+}
+
+// create the rule for the records of a trigger, nil if the records don't make a supported action
+func createRPZRule(trigger string, records []dns.RR) *RPZRule {
+	rpzRule := &RPZRule{Action: RPZLOCALDATA}
+	rewrite := &Rewrite{Domain: trigger}
+
+	for _, record := range records {
+		switch rr := record.(type) {
+		case *dns.CNAME:
+			if action, found := rpzCnameAction(rr.Target); found {
+				if len(records) > 1 {
+					return nil
+				}
+				rpzRule.Action = action
+				rpzRule.Text = trigger + " " + rpzActionNames[action]
+				return rpzRule
+			}
+			// special targets (like rpz-tcp-only.) and wildcard targets (like *.garden.) are not supported
+			if "" != rewrite.Target || len(rewrite.Addresses) > 0 || strings.HasPrefix(rr.Target, rpzWildcard) || strings.HasPrefix(strings.ToLower(rr.Target), "rpz-") {
+				return nil
+			}
+			rewrite.Target = strings.ToLower(rr.Target)
+		case *dns.A:
+			rewrite.Addresses = append(rewrite.Addresses, rr.A)
+		case *dns.AAAA:
+			rewrite.Addresses = append(rewrite.Addresses, rr.AAAA)
+		default:
+			return nil
+		}
+	}
+
+	if "" != rewrite.Target && len(rewrite.Addresses) > 0 {
+		return nil
+	}
+
+	rewrite.Text = trigger + " " + rewrite.Target
+	if !rewrite.IsCNAME() {
+		addresses := make([]string, 0, len(rewrite.Addresses))
+		for _, address := range rewrite.Addresses {
+			addresses = append(addresses, address.String())
+		}
+		rewrite.Text = trigger + " " + strings.Join(addresses, ",")
+	}
+	rpzRule.Rewrite = rewrite
+	rpzRule.Text = rewrite.Text
+	return rpzRule
+}
+
+// add the records of a trigger (the owner name without the zone origin) to the given list, false if the
+// trigger or action is not supported
+func (store *RPZStore) Load(list *config.GudgeonList, trigger string, records []dns.RR) bool {
+	trigger = strings.ToLower(strings.TrimSuffix(trigger, "."))
+	for _, unsupported := range rpzUnsupportedTriggers {
+		if trigger == unsupported || strings.HasSuffix(trigger, "."+unsupported) {
+			return false
+		}
+	}
+
+	name := list.CanonicalName()
+	if _, found := store.zones[name]; !found {
+		store.zones[name] = &rpzZone{
+			names:     make(map[string]*RPZRule),
+			wildcards: make(map[string]*RPZRule),
+			ips:       &ipTrie{},
+			ipRules:   make(map[string]*RPZRule),
+		}
+	}
+	zone := store.zones[name]
+
+	if strings.HasSuffix(trigger, "."+rpzIPTrigger) {
+		network := ParseRPZIP(strings.TrimSuffix(trigger, "."+rpzIPTrigger))
+		if network == nil {
+			return false
+		}
+		rpzRule := createRPZRule(network.String(), records)
+		if rpzRule == nil {
+			return false
+		}
+		// local data for an address is answered for the question and has no domain of its own
+		if rpzRule.Rewrite != nil {
+			rpzRule.Rewrite.Domain = ""
+		}
+		ones, bits := network.Mask.Size()
+		zone.ips.insert(network.IP, ones, bits, network.String())
+		if _, found := zone.ipRules[network.String()]; !found {
+			zone.ipRules[network.String()] = rpzRule
+		}
+		return true
+	}
+
+	rpzRule := createRPZRule(trigger, records)
+	if rpzRule == nil {
+		return false
+	}
+	if strings.HasPrefix(trigger, rpzWildcard) {
+		if _, found := zone.wildcards[trigger[len(rpzWildcard):]]; !found {
+			zone.wildcards[trigger[len(rpzWildcard):]] = rpzRule
+		}
+	} else if _, found := zone.names[trigger]; !found {
+		zone.names[trigger] = rpzRule
+	}
+	return true
+}
+
+// find the first rule for the query name in the given lists (in order), an exact name is used before
+// the wildcard of the closest parent domain in each list
+func (store *RPZStore) FindRPZ(lists []*config.GudgeonList, domain string) (*RPZRule, *config.GudgeonList) {
+	if store == nil {
+		return nil, nil
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	for _, list := range lists {
+		zone, found := store.zones[list.CanonicalName()]
+		if !IsRPZList(list) || !found {
+			continue
+		}
+		if rpzRule, found := zone.names[domain]; found {
+			return rpzRule, list
+		}
+		for parent := domain; strings.Contains(parent, "."); {
+			parent = parent[strings.Index(parent, ".")+1:]
+			if rpzRule, found := zone.wildcards[parent]; found {
+				return rpzRule, list
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// find the first rpz-ip rule in the given lists (in order) with a network that contains the address, the most
+// specific network of that list is used
+func (store *RPZStore) FindRPZIP(lists []*config.GudgeonList, ip net.IP) (*RPZRule, *config.GudgeonList) {
+	if store == nil || ip == nil {
+		return nil, nil
+	}
+
+	for _, list := range lists {
+		zone, found := store.zones[list.CanonicalName()]
+		if !IsRPZList(list) || !found {
+			continue
+		}
+		if network := zone.ips.find(ip); "" != network {
+			return zone.ipRules[network], list
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,129 @@
+package rule
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+func TestParseRPZIP(t *testing.T) {
+	data := []struct {
+		input    string
+		expected string
+	}{
+		{"32.1.2.0.192", "192.0.2.1/32"},
+		{"24.0.2.0.192", "192.0.2.0/24"},
+		{"8.0.0.0.10", "10.0.0.0/8"},
+		{"128.1.zz.db8.2001", "2001:db8::1/128"},
+		{"48.zz.db8.2001", "2001:db8::/48"},
+		{"128.1.zz", "::1/128"},
+		{"128.1.0.0.0.0.0.db8.2001", "2001:db8::1/128"},
+		{"33.1.2.0.192", ""},
+		{"32.1.2.192", ""},
+		{"192", ""},
+		{"", ""},
+	}
+
+	for _, d := range data {
+		network := ParseRPZIP(d.input)
+		result := ""
+		if network != nil {
+			result = network.String()
+		}
+		if d.expected != result {
+			t.Errorf("Input '%s' should have network '%s' but got '%s'", d.input, d.expected, result)
+		}
+	}
+}
+
+func TestRPZStore(t *testing.T) {
+	zone := &config.GudgeonList{Name: "zone", Type: RPZSTRING}
+	other := &config.GudgeonList{Name: "other", Type: RPZSTRING}
+	domains := &config.GudgeonList{Name: "domains"}
+
+	store := &RPZStore{zones: make(map[string]*rpzZone)}
+	records := []struct {
+		list    *config.GudgeonList
+		trigger string
+		records []string
+		loaded  bool
+	}{
+		{zone, "blocked.com", []string{"blocked.com. CNAME ."}, true},
+		{zone, "*.blocked.com", []string{"*.blocked.com. CNAME *."}, true},
+		{zone, "ok.blocked.com", []string{"ok.blocked.com. CNAME rpz-passthru."}, true},
+		{zone, "garden.com", []string{"garden.com. A 192.0.2.1", "garden.com. AAAA 2001:db8::1"}, true},
+		{zone, "alias.com", []string{"alias.com. CNAME target.com."}, true},
+		{zone, "24.0.2.0.192.rpz-ip", []string{"24.0.2.0.192.rpz-ip. CNAME rpz-drop."}, true},
+		{zone, "ns.bad.com.rpz-nsdname", []string{"ns.bad.com.rpz-nsdname. CNAME ."}, false},
+		{zone, "tcp.com", []string{"tcp.com. CNAME rpz-tcp-only."}, false},
+		{zone, "txt.com", []string{"txt.com. TXT \"text\""}, false},
+		{zone, "mixed.com", []string{"mixed.com. CNAME target.com.", "mixed.com. A 192.0.2.1"}, false},
+		{other, "blocked.com", []string{"blocked.com. CNAME rpz-drop."}, true},
+		{other, "24.0.2.0.192.rpz-ip", []string{"24.0.2.0.192.rpz-ip. CNAME ."}, true},
+	}
+	for _, r := range records {
+		rrs := make([]dns.RR, 0, len(r.records))
+		for _, text := range r.records {
+			rr, err := dns.NewRR(text)
+			if err != nil {
+				t.Fatalf("Could not parse record '%s': %s", text, err)
+			}
+			rrs = append(rrs, rr)
+		}
+		if loaded := store.Load(r.list, r.trigger, rrs); loaded != r.loaded {
+			t.Errorf("Trigger '%s' should be loaded (%t) but was (%t)", r.trigger, r.loaded, loaded)
+		}
+	}
+
+	names := []struct {
+		lists    []*config.GudgeonList
+		domain   string
+		list     string
+		expected string
+	}{
+		{[]*config.GudgeonList{zone}, "blocked.com.", "zone", "blocked.com NXDOMAIN"},
+		{[]*config.GudgeonList{zone}, "www.blocked.com", "zone", "*.blocked.com NODATA"},
+		{[]*config.GudgeonList{zone}, "ok.blocked.com", "zone", "ok.blocked.com PASSTHRU"},
+		{[]*config.GudgeonList{zone}, "www.ok.blocked.com", "zone", "*.blocked.com NODATA"},
+		{[]*config.GudgeonList{zone}, "garden.com", "zone", "garden.com 192.0.2.1,2001:db8::1"},
+		{[]*config.GudgeonList{zone}, "alias.com", "zone", "alias.com target.com."},
+		{[]*config.GudgeonList{zone}, "www.garden.com", "", ""},
+		{[]*config.GudgeonList{zone}, "tcp.com", "", ""},
+		{[]*config.GudgeonList{other, zone}, "blocked.com", "other", "blocked.com DROP"},
+		{[]*config.GudgeonList{domains}, "blocked.com", "", ""},
+	}
+	for _, d := range names {
+		rpzRule, list := store.FindRPZ(d.lists, d.domain)
+		listName, ruleText := "", ""
+		if rpzRule != nil {
+			listName, ruleText = list.CanonicalName(), rpzRule.Text
+		}
+		if listName != d.list || ruleText != d.expected {
+			t.Errorf("Domain %s should match '%s' in list '%s' but got '%s' in list '%s'", d.domain, d.expected, d.list, ruleText, listName)
+		}
+	}
+
+	addresses := []struct {
+		lists    []*config.GudgeonList
+		address  string
+		list     string
+		expected string
+	}{
+		{[]*config.GudgeonList{zone}, "192.0.2.200", "zone", "192.0.2.0/24 DROP"},
+		{[]*config.GudgeonList{other, zone}, "192.0.2.200", "other", "192.0.2.0/24 NXDOMAIN"},
+		{[]*config.GudgeonList{zone}, "192.0.3.1", "", ""},
+	}
+	for _, d := range addresses {
+		rpzRule, list := store.FindRPZIP(d.lists, net.ParseIP(d.address))
+		listName, ruleText := "", ""
+		if rpzRule != nil {
+			listName, ruleText = list.CanonicalName(), rpzRule.Text
+		}
+		if listName != d.list || ruleText != d.expected {
+			t.Errorf("Address %s should match '%s' in list '%s' but got '%s' in list '%s'", d.address, d.expected, d.list, ruleText, listName)
+		}
+	}
+}
@@ -11,8 +11,20 @@ const (
 	ALLOW = uint8(1)
 	// the constant that means BLOCK after pasring "allow" or "block"
 	BLOCK = uint8(0)
+	// the constant that means REWRITE after parsing "rewrite"
+	REWRITE = uint8(2)
+	// the constant that means BLOCKIP after parsing "block-ip"
+	BLOCKIP = uint8(3)
+	// the constant that means RPZ after parsing "rpz"
+	RPZ = uint8(4)
 	// the string that represents "allow", all other results are treated as "block"
 	ALLOWSTRING = "allow"
+	// the string that represents "rewrite"
+	REWRITESTRING = "rewrite"
+	// the string that represents "block-ip"
+	BLOCKIPSTRING = "block-ip"
+	// the string that represents "rpz"
+	RPZSTRING = "rpz"
 
 	ruleRegex = "/"
 	ruleGlob  = "*"
@@ -21,6 +33,12 @@ const (
 func ParseType(listType string) uint8 {
 	if strings.EqualFold(ALLOWSTRING, listType) {
 		return ALLOW
+	} else if strings.EqualFold(REWRITESTRING, listType) {
+		return REWRITE
+	} else if strings.EqualFold(BLOCKIPSTRING, listType) {
+		return BLOCKIP
+	} else if strings.EqualFold(RPZSTRING, listType) {
+		return RPZ
 	}
 	return BLOCK
 }
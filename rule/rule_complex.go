@@ -2,6 +2,8 @@ package rule
 
 import (
 	"regexp"
+	"regexp/syntax"
+	"sort"
 	"strings"
 
 	"github.com/ryanuber/go-glob"
@@ -23,6 +25,8 @@ type wildcardMatchRule struct {
 type regexMatchRule struct {
 	complexRule
 	regexp *regexp.Regexp
+	// literal text that every match contains, empty if there is none
+	literal string
 }
 
 func CreateComplexRule(rule string) ComplexRule {
@@ -55,9 +59,38 @@ func createRegexMatchRule(rule string) ComplexRule {
 	if err != nil {
 		return nil
 	}
+	if parsed, err := syntax.Parse(rule[1:len(rule)-1], syntax.Perl); err == nil {
+		newRule.literal = requiredLiteral(parsed.Simplify())
+	}
 	return newRule
 }
 
+// the longest literal text that every match of the expression contains, empty if there is none
+func requiredLiteral(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		// case insensitive literals can't be found by their exact text
+		if re.Flags&syntax.FoldCase == 0 {
+			return string(re.Rune)
+		}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredLiteral(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		longest := ""
+		for _, sub := range re.Sub {
+			if literal := requiredLiteral(sub); len(literal) > len(longest) {
+				longest = literal
+			}
+		}
+		return longest
+	}
+	return ""
+}
+
 // =================================================================
 // Base operations for Rule identification (mainly for backing stores)
 // =================================================================
@@ -75,3 +108,107 @@ func (rule *wildcardMatchRule) IsMatch(sample string) bool {
 func (rule *regexMatchRule) IsMatch(sample string) bool {
 	return rule.regexp.MatchString(sample)
 }
+
+// the longest literal text that every match of the rule contains, empty if there is none
+func (rule *wildcardMatchRule) requiredLiteral() string {
+	longest := ""
+	for _, part := range strings.Split(rule.text, ruleGlob) {
+		if len(part) > len(longest) {
+			longest = part
+		}
+	}
+	return longest
+}
+
+func (rule *regexMatchRule) requiredLiteral() string {
+	return rule.literal
+}
+
+// =================================================================
+// Compiled Matching
+// =================================================================
+
+// the complex rules of a list compiled together, a rule is only checked when the domain contains the literal text
+// that the rule requires so that most rules are never checked for a given domain
+type complexMatcher struct {
+	rules []ComplexRule
+	// finds the literals in the domain
+	literals *ahoCorasick
+	// the rules (by index) that require each literal
+	literalRules [][]int
+	// the rules (by index) that don't require any literal and are always checked
+	always []int
+}
+
+func newComplexMatcher(rules []ComplexRule) *complexMatcher {
+	matcher := &complexMatcher{
+		rules:        rules,
+		literalRules: make([][]int, 0),
+		always:       make([]int, 0),
+	}
+
+	literals := make([]string, 0)
+	literalIndex := make(map[string]int)
+	for idx, rule := range rules {
+		literal := ""
+		if literalRule, ok := rule.(interface{ requiredLiteral() string }); ok {
+			literal = literalRule.requiredLiteral()
+		}
+		if "" == literal {
+			matcher.always = append(matcher.always, idx)
+			continue
+		}
+		literalIdx, found := literalIndex[literal]
+		if !found {
+			literalIdx = len(literals)
+			literals = append(literals, literal)
+			literalIndex[literal] = literalIdx
+			matcher.literalRules = append(matcher.literalRules, make([]int, 0, 1))
+		}
+		matcher.literalRules[literalIdx] = append(matcher.literalRules[literalIdx], idx)
+	}
+	matcher.literals = newAhoCorasick(literals)
+
+	return matcher
+}
+
+// the rules (by index, in order and without repeats) that can match the domain
+func (matcher *complexMatcher) candidates(domain string) []int {
+	candidates := append(make([]int, 0, len(matcher.always)+8), matcher.always...)
+	for _, literalIdx := range matcher.literals.find(domain, nil) {
+		candidates = append(candidates, matcher.literalRules[literalIdx]...)
+	}
+	sort.Ints(candidates)
+
+	unique := candidates[:0]
+	for idx, candidate := range candidates {
+		if idx == 0 || candidate != candidates[idx-1] {
+			unique = append(unique, candidate)
+		}
+	}
+	return unique
+}
+
+// the first rule (in the order the rules were given) that matches the domain, nil if none match
+func (matcher *complexMatcher) match(domain string) ComplexRule {
+	if len(matcher.rules) == 0 {
+		return nil
+	}
+	for _, candidate := range matcher.candidates(domain) {
+		if matcher.rules[candidate].IsMatch(domain) {
+			return matcher.rules[candidate]
+		}
+	}
+	return nil
+}
+
+// every rule that matches the domain in the order the rules were given
+func (matcher *complexMatcher) matchAll(domain string) []ComplexRule {
+	matched := make([]ComplexRule, 0)
+	for _, candidate := range matcher.candidates(domain) {
+		if matcher.rules[candidate].IsMatch(domain) {
+			matched = append(matched, matcher.rules[candidate])
+		}
+	}
+	return matched
+}
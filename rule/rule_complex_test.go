@@ -1,7 +1,10 @@
 package rule
 
 import (
+	"fmt"
 	"testing"
+
+	"github.com/chrisruffalo/gudgeon/testutil"
 )
 
 type domainData struct {
@@ -39,3 +42,80 @@ func TestRegexRuleMatching(t *testing.T) {
 	}
 	testRuleMatching("regex", "/^r.*\\.com$/", data, t)
 }
+
+func TestComplexMatcher(t *testing.T) {
+	texts := []string{
+		"/^ads?[0-9]+\\./",
+		"*.tracker.*",
+		"/(?i)PIXEL/",
+		"/^[a-z]\\.cdn$/",
+		"/^(banner|popup)\\./",
+		"*tracker.com",
+		"/metrics?\\./",
+	}
+	rules := make([]ComplexRule, 0, len(texts))
+	for _, text := range texts {
+		rules = append(rules, CreateComplexRule(text))
+	}
+	matcher := newComplexMatcher(rules)
+
+	// the first rule in order is reported even when a later rule also matches
+	data := map[string]string{
+		"ad1.example.com":        "/^ads?[0-9]+\\./",
+		"ads22.tracker.com":      "/^ads?[0-9]+\\./",
+		"www.tracker.com":        "*.tracker.*",
+		"eviltracker.com":        "*tracker.com",
+		"Pixel.example.com":      "/(?i)PIXEL/",
+		"x.cdn":                  "/^[a-z]\\.cdn$/",
+		"popup.example.com":      "/^(banner|popup)\\./",
+		"app.metric.example.com": "/metrics?\\./",
+		"example.com":            "",
+		"xy.cdn":                 "",
+		"adx.example.com":        "",
+	}
+	for domain, expected := range data {
+		text := ""
+		if rule := matcher.match(domain); rule != nil {
+			text = rule.Text()
+		}
+		if text != expected {
+			t.Errorf("Expected '%s' to match rule '%s' but got '%s'", domain, expected, text)
+		}
+	}
+}
+
+func TestAhoCorasick(t *testing.T) {
+	ac := newAhoCorasick([]string{"he", "she", "his", "hers", "s"})
+	found := ac.find("ushers", nil)
+	counts := make(map[int]int)
+	for _, pattern := range found {
+		counts[pattern]++
+	}
+	expected := map[int]int{0: 1, 1: 1, 3: 1, 4: 2}
+	if len(counts) != len(expected) {
+		t.Errorf("Expected patterns %v but found %v", expected, counts)
+	}
+	for pattern, count := range expected {
+		if counts[pattern] != count {
+			t.Errorf("Expected pattern %d to be found %d times but was found %d times", pattern, count, counts[pattern])
+		}
+	}
+}
+
+func BenchmarkComplexMatcher(b *testing.B) {
+	rules := make([]ComplexRule, 0, 5000)
+	for idx := 0; idx < 5000; idx++ {
+		rules = append(rules, CreateComplexRule(fmt.Sprintf("/^ads%d[0-9]*\\.%s$/", idx, testutil.RandomDomain())))
+	}
+	matcher := newComplexMatcher(rules)
+	domains := make([]string, 100)
+	for idx := range domains {
+		domains[idx] = testutil.RandomDomain()
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		matcher.match(domains[i%len(domains)])
+	}
+}
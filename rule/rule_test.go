@@ -31,3 +31,41 @@ func TestParseLine(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRewrite(t *testing.T) {
+	data := []struct {
+		input     string
+		domain    string
+		target    string
+		addresses int
+	}{
+		{"", "", "", 0},
+		{"# comment", "", "", 0},
+		{"alias.com", "", "", 0},
+		{"alias.com target.com", "alias.com", "target.com.", 0},
+		{"Alias.com. Target.com # comment", "alias.com", "target.com.", 0},
+		{"*.alias.com target.com", "*.alias.com", "target.com.", 0},
+		{"fixed.com 10.0.0.1", "fixed.com", "", 1},
+		{"fixed.com 10.0.0.1,fd00::1", "fixed.com", "", 2},
+		{"fixed.com 10.0.0.1 fd00::1", "fixed.com", "", 2},
+		{"fixed.com target.com 10.0.0.1", "", "", 0},
+		{"fixed.com target.com other.com", "", "", 0},
+	}
+
+	for _, d := range data {
+		rewrite := ParseRewrite(d.input)
+		if "" == d.domain {
+			if rewrite != nil {
+				t.Errorf("Input '%s' should not be a rewrite", d.input)
+			}
+			continue
+		}
+		if rewrite == nil {
+			t.Errorf("Input '%s' should be a rewrite", d.input)
+			continue
+		}
+		if d.domain != rewrite.Domain || d.target != rewrite.Target || d.addresses != len(rewrite.Addresses) {
+			t.Errorf("Input '%s' should have domain '%s', target '%s', and %d addresses but got '%s', '%s', and %d", d.input, d.domain, d.target, d.addresses, rewrite.Domain, rewrite.Target, len(rewrite.Addresses))
+		}
+	}
+}
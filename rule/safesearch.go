@@ -0,0 +1,87 @@
+package rule
+
+import (
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+const (
+	safeSearchListName = "safesearch"
+
+	googleSafeSearch     = "forcesafesearch.google.com"
+	bingSafeSearch       = "strict.bing.com"
+	duckDuckGoSafeSearch = "safe.duckduckgo.com"
+	pixabaySafeSearch    = "safesearch.pixabay.com"
+	youTubeStrict        = "restrict.youtube.com"
+	youTubeModerate      = "restrictmoderate.youtube.com"
+)
+
+// the top level domains that google search is served from (https://www.google.com/supported_domains)
+var googleDomains = []string{
+	"com", "ad", "ae", "com.af", "com.ag", "com.ai", "al", "am", "co.ao", "com.ar", "as", "at", "com.au", "az", "ba", "com.bd",
+	"be", "bf", "bg", "com.bh", "bi", "bj", "com.bn", "com.bo", "com.br", "bs", "bt", "co.bw", "by", "com.bz", "ca", "cd", "cf",
+	"cg", "ch", "ci", "co.ck", "cl", "cm", "cn", "com.co", "co.cr", "com.cu", "cv", "com.cy", "cz", "de", "dj", "dk", "dm",
+	"com.do", "dz", "com.ec", "ee", "com.eg", "es", "com.et", "fi", "com.fj", "fm", "fr", "ga", "ge", "gg", "com.gh", "com.gi",
+	"gl", "gm", "gr", "com.gt", "gy", "com.hk", "hn", "hr", "ht", "hu", "co.id", "ie", "co.il", "im", "co.in", "iq", "is", "it",
+	"je", "com.jm", "jo", "co.jp", "co.ke", "com.kh", "ki", "kg", "co.kr", "com.kw", "kz", "la", "com.lb", "li", "lk", "co.ls",
+	"lt", "lu", "lv", "com.ly", "co.ma", "md", "me", "mg", "mk", "ml", "com.mm", "mn", "com.mt", "mu", "mv", "mw", "com.mx",
+	"com.my", "co.mz", "com.na", "com.ng", "com.ni", "ne", "nl", "no", "com.np", "nr", "nu", "co.nz", "com.om", "com.pa",
+	"com.pe", "com.pg", "com.ph", "com.pk", "pl", "pn", "com.pr", "ps", "pt", "com.py", "com.qa", "ro", "ru", "rw", "com.sa",
+	"com.sb", "sc", "se", "com.sg", "sh", "si", "sk", "com.sl", "sn", "so", "sm", "sr", "st", "com.sv", "td", "tg", "co.th",
+	"com.tj", "tl", "tm", "tn", "to", "com.tr", "tt", "com.tw", "co.tz", "com.ua", "co.ug", "co.uk", "com.uy", "co.uz",
+	"com.vc", "co.ve", "co.vi", "com.vn", "vu", "ws", "rs", "co.za", "co.zm", "co.zw", "cat",
+}
+
+// domains that are rewritten to the youtube restricted mode targets
+var youTubeDomains = []string{"www.youtube.com", "m.youtube.com", "youtubei.googleapis.com", "youtube.googleapis.com", "www.youtube-nocookie.com"}
+
+// the search engines (other than google and youtube) with safe search targets
+var safeSearchDomains = map[string][]string{
+	bingSafeSearch:       {"bing.com", "www.bing.com"},
+	duckDuckGoSafeSearch: {"duckduckgo.com", "www.duckduckgo.com", "start.duckduckgo.com"},
+	pixabaySafeSearch:    {"pixabay.com", "www.pixabay.com"},
+}
+
+// the (generated) rewrite list that holds the safe search rewrites for the given youtube restriction
+func SafeSearchList(youTube string) *config.GudgeonList {
+	return &config.GudgeonList{
+		Name: safeSearchListName + "-" + youTube,
+		Type: REWRITESTRING,
+		Tags: &[]string{},
+	}
+}
+
+// the curated safe search rewrites for google, bing, duckduckgo, pixabay, and youtube with the given youtube restriction
+func SafeSearchRewrites(youTube string) []*Rewrite {
+	rewrites := make([]*Rewrite, 0, 2*len(googleDomains)+len(youTubeDomains)+8)
+
+	for _, tld := range googleDomains {
+		rewrites = append(rewrites, ParseRewrite("google."+tld+" "+googleSafeSearch), ParseRewrite("www.google."+tld+" "+googleSafeSearch))
+	}
+
+	youTubeTarget := youTubeStrict
+	if config.SafeSearchYouTubeModerate == youTube {
+		youTubeTarget = youTubeModerate
+	}
+	for _, domain := range youTubeDomains {
+		rewrites = append(rewrites, ParseRewrite(domain+" "+youTubeTarget))
+	}
+
+	for target, domains := range safeSearchDomains {
+		for _, domain := range domains {
+			rewrites = append(rewrites, ParseRewrite(domain+" "+target))
+		}
+	}
+
+	return rewrites
+}
+
+// load the safe search rewrites for the given youtube restriction into the store (once) and return the list that holds them
+func (store *RewriteStore) LoadSafeSearch(youTube string) *config.GudgeonList {
+	list := SafeSearchList(youTube)
+	if _, found := store.exact[list.CanonicalName()]; !found {
+		for _, rewrite := range SafeSearchRewrites(youTube) {
+			store.Load(list, rewrite)
+		}
+	}
+	return list
+}
@@ -0,0 +1,155 @@
+package rule
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+// changes when the format of the snapshot files changes so that old snapshots are not used
+const snapshotVersion = "1"
+
+// stores that can save the finalized rules of a list and load them on the next start instead of reading the list again,
+// each snapshot is in files that start with the given prefix and the store adds its own extension
+type snapshotStore interface {
+	// read the rules of the list from the snapshot without changing the store, nil if there is no snapshot to use
+	readSnapshot(prefix string, list *config.GudgeonList) snapshotCommit
+	// save the finalized rules of the list as a snapshot
+	saveSnapshot(prefix string, list *config.GudgeonList) error
+}
+
+// loads the rules read from a snapshot into the store when called with true or drops them (and anything held to read
+// them) when called with false, a store made of more than one snapshot only loads them once all of them were read
+type snapshotCommit func(load bool)
+
+// load the rules of the list from the snapshot, false (without loading anything) if there is no snapshot to use
+func loadSnapshot(store snapshotStore, prefix string, list *config.GudgeonList) bool {
+	commit := store.readSnapshot(prefix, list)
+	if commit == nil {
+		return false
+	}
+	commit(true)
+	return true
+}
+
+// the key of the snapshot of a list from the contents of the list and the rules disabled in every list, empty if the list can't be read
+func snapshotKey(listPath string, disabled map[string]bool) string {
+	data, err := os.Open(listPath)
+	if err != nil {
+		return ""
+	}
+	defer data.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, data); err != nil {
+		return ""
+	}
+
+	// rules disabled by $badfilter rules in other lists change what is loaded from this list
+	keys := make([]string, 0, len(disabled))
+	for key := range disabled {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash.Write([]byte(snapshotVersion + "\n" + strings.Join(keys, "\n")))
+
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// the prefix of the snapshot files for the list with the given key
+func snapshotPrefix(dir string, list *config.GudgeonList, key string) string {
+	return path.Join(dir, list.ShortName()+"-"+key)
+}
+
+// remove the snapshot files of the list that were saved with other keys (or all of them when no key is given)
+func removeSnapshots(dir string, list *config.GudgeonList, key string) {
+	// short names only have letters, numbers, and underscores so they can't match the snapshots of another list
+	matches, _ := filepath.Glob(path.Join(dir, list.ShortName()+"-*"))
+	for _, match := range matches {
+		if "" == key || !strings.HasPrefix(path.Base(match), list.ShortName()+"-"+key) {
+			os.Remove(match)
+		}
+	}
+}
+
+// read the number of rules loaded and skipped from the list when the snapshot was saved
+func readSnapshotCounts(prefix string) (uint64, uint64, bool) {
+	data, err := os.Open(prefix + ".counts")
+	if err != nil {
+		return 0, 0, false
+	}
+	defer data.Close()
+
+	var loaded, skipped uint64
+	if _, err := fmt.Fscan(data, &loaded, &skipped); err != nil {
+		return 0, 0, false
+	}
+	return loaded, skipped, true
+}
+
+// write a snapshot file by writing to a temporary file and moving it into place once it is complete
+func writeSnapshotFile(filePath string, write func(writer io.Writer) error) error {
+	tmpPath := filePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	err = write(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, filePath)
+}
+
+// save the snapshot of the list and the number of rules that were loaded and skipped, the counts are written last so
+// that a snapshot without them is never used
+func saveSnapshot(store snapshotStore, dir string, list *config.GudgeonList, key string, loaded uint64, skipped uint64) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		os.MkdirAll(dir, os.ModePerm)
+	}
+	removeSnapshots(dir, list, key)
+
+	prefix := snapshotPrefix(dir, list, key)
+	err := store.saveSnapshot(prefix, list)
+	if err == nil {
+		err = writeSnapshotFile(prefix+".counts", func(writer io.Writer) error {
+			_, err := fmt.Fprintf(writer, "%d %d\n", loaded, skipped)
+			return err
+		})
+	}
+	if err != nil {
+		log.Warnf("Could not save snapshot of list '%s': %s", list.CanonicalName(), err)
+		removeSnapshots(dir, list, "")
+	}
+}
+
+// true if all of the files exist
+func snapshotFilesExist(files ...string) bool {
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package rule
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestStoreSnapshots(t *testing.T) {
+	for _, storeType := range []string{"hash", "hash32", "bloom", "sqlite", "hash+sqlite", "hash32+sqlite", "bloom+sqlite", "cuckoo", "cuckoo+sqlite", "mmap", "mmap+sqlite"} {
+		testStoreSnapshots(storeType, t)
+	}
+}
+
+func testStoreSnapshots(storeType string, t *testing.T) {
+	tmpDir := testutil.TempDir()
+	defer os.RemoveAll(tmpDir)
+
+	snapshots := true
+	conf := &config.GudgeonConfig{Home: tmpDir, Storage: &config.GudgeonStorage{RuleStorage: storeType, Snapshots: &snapshots}}
+	writeList := func(name string, rules ...string) {
+		if err := ioutil.WriteFile(path.Join(tmpDir, name+".list"), []byte(strings.Join(rules, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("Could not write list: %s", err)
+		}
+	}
+	writeList("ads", "||ads.com^", "@@||good.ads.com^", "/^ad[0-9]+\\./", "||shop.com/ads")
+	writeList("other", "other.com")
+	for _, name := range []string{"ads", "other"} {
+		conf.Lists = append(conf.Lists, &config.GudgeonList{Name: name, Source: path.Join(tmpDir, name+".list")})
+	}
+
+	// the snapshot files of each list, by file name
+	snapshotFiles := func(name string) map[string]os.FileInfo {
+		files := make(map[string]os.FileInfo)
+		matches, _ := filepath.Glob(path.Join(conf.DataRoot(), "snapshots", "*", name+"-*"))
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil {
+				files[path.Base(match)] = info
+			}
+		}
+		return files
+	}
+
+	check := func(build string, store RuleStore, listIdx int, domain string, expected Match) {
+		if match, _, _ := store.FindMatch(conf.Lists[listIdx:listIdx+1], domain); match != expected {
+			t.Errorf("Store '%s' (%s build) should match '%s' in list '%s' with %d but got %d", storeType, build, domain, conf.Lists[listIdx].CanonicalName(), expected, match)
+		}
+	}
+
+	store, loaded, skipped := CreateStore(path.Join(tmpDir, "first"), conf)
+	check("first", store, 0, "ads.com", MatchBlock)
+	check("first", store, 0, "good.ads.com", MatchAllow)
+	check("first", store, 0, "ad1.example.com", MatchBlock)
+	check("first", store, 1, "other.com", MatchBlock)
+	store.Close()
+
+	adsFiles := snapshotFiles("ads")
+	otherFiles := snapshotFiles("other")
+	if len(adsFiles) == 0 || len(otherFiles) == 0 {
+		t.Errorf("Store '%s' should save snapshots of both lists", storeType)
+		return
+	}
+
+	// only the changed list is read again
+	writeList("other", "other.com", "new.com")
+	store, secondLoaded, secondSkipped := CreateStore(path.Join(tmpDir, "second"), conf)
+	defer store.Close()
+	check("second", store, 0, "ads.com", MatchBlock)
+	check("second", store, 0, "good.ads.com", MatchAllow)
+	check("second", store, 0, "ad1.example.com", MatchBlock)
+	check("second", store, 0, "other.com", MatchNone)
+	check("second", store, 1, "new.com", MatchBlock)
+
+	if secondLoaded[0] != loaded[0] || secondSkipped[0] != skipped[0] {
+		t.Errorf("Store '%s' should report the same counts from the snapshot but got %d/%d instead of %d/%d", storeType, secondLoaded[0], secondSkipped[0], loaded[0], skipped[0])
+	}
+	if secondLoaded[1] != 2 {
+		t.Errorf("Store '%s' should load 2 rules from the changed list but loaded %d", storeType, secondLoaded[1])
+	}
+
+	for name, info := range snapshotFiles("ads") {
+		if before, found := adsFiles[name]; !found || !before.ModTime().Equal(info.ModTime()) {
+			t.Errorf("Store '%s' should not save the snapshot '%s' of the unchanged list again", storeType, name)
+		}
+	}
+	for name := range snapshotFiles("other") {
+		if _, found := otherFiles[name]; found {
+			t.Errorf("Store '%s' should replace the snapshot '%s' of the changed list", storeType, name)
+		}
+	}
+}
+
+func TestStoreSnapshotMissingPart(t *testing.T) {
+	tmpDir := testutil.TempDir()
+	defer os.RemoveAll(tmpDir)
+
+	snapshots := true
+	conf := &config.GudgeonConfig{Home: tmpDir, Storage: &config.GudgeonStorage{RuleStorage: "cuckoo", Snapshots: &snapshots}}
+	if err := ioutil.WriteFile(path.Join(tmpDir, "ads.list"), []byte("||ads.com^\n@@||good.ads.com^\n"), 0644); err != nil {
+		t.Fatalf("Could not write list: %s", err)
+	}
+	conf.Lists = append(conf.Lists, &config.GudgeonList{Name: "ads", Source: path.Join(tmpDir, "ads.list")})
+
+	store, _, _ := CreateStore(path.Join(tmpDir, "first"), conf)
+	store.Close()
+
+	// without the filter of the exceptions the list is read again and none of its snapshots are loaded
+	exceptions, _ := filepath.Glob(path.Join(conf.DataRoot(), "snapshots", "*", "ads-*-exceptions.cuckoo"))
+	if len(exceptions) == 0 {
+		t.Fatalf("Expected a snapshot of the exceptions of the list")
+	}
+	for _, exception := range exceptions {
+		os.Remove(exception)
+	}
+	store, _, _ = CreateStore(path.Join(tmpDir, "second"), conf)
+	defer store.Close()
+
+	// a rule that was loaded from the snapshot and from the list would still match after it is removed
+	store.Remove(conf.Lists[0], "ads.com")
+	if match, _, _ := store.FindMatch(conf.Lists, "ads.com"); match != MatchNone {
+		t.Errorf("Expected the removed rule to not match but got %d", match)
+	}
+	if match, _, _ := store.FindMatch(conf.Lists, "good.ads.com"); match != MatchAllow {
+		t.Errorf("Expected the exception to be read from the list but got %d", match)
+	}
+}
@@ -0,0 +1,28 @@
+package rule
+
+// the size and accuracy of a store that can report them
+type StoreStats struct {
+	// the bytes used by the rules of the store, not counting a backing store
+	MemoryBytes uint64
+	// the number of times a domain was looked for in a list and the number of those that were matched by the store but
+	// then not found in the backing store
+	Lookups        uint64
+	FalsePositives uint64
+	// the rate of false positives seen by lookups when there is a backing store to check matches with (Measured) and the
+	// rate expected from how full the store is otherwise
+	FalsePositiveRate float64
+	Measured          bool
+}
+
+// stores that can report their size and accuracy
+type statsStore interface {
+	stats() *StoreStats
+}
+
+// the stats of the store, nil if the store doesn't report them
+func GetStoreStats(store RuleStore) *StoreStats {
+	if store, ok := store.(statsStore); ok {
+		return store.stats()
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package rule
 import (
 	"bufio"
 	"os"
+	"path"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -29,13 +30,53 @@ type RuleStore interface {
 
 	Finalize(sessionRoot string, lists []*config.GudgeonList)
 
+	// add or remove a single rule after the store is finalized, the list does not need to be one the store was created with
+	Add(list *config.GudgeonList, rule string)
+	Remove(list *config.GudgeonList, rule string)
+
 	FindMatch(lists []*config.GudgeonList, domain string) (Match, *config.GudgeonList, string)
 
+	// every rule in the lists that matches the domain or one of its parent domains, in the order of the lists with the
+	// most specific rule of a list first, stores that keep hashes of rules report the domain that was found as the rule
+	FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch
+
 	Close()
 }
 
-// stores are created from lists of files inside a configuration
-func CreateStore(storeRoot string, config *config.GudgeonConfig) (RuleStore, []uint64) {
+// a rule found by FindAllMatches, the match is allow or block from the type of the list
+type RuleMatch struct {
+	Match Match
+	List  *config.GudgeonList
+	Rule  string
+}
+
+func newRuleMatch(list *config.GudgeonList, rule string) *RuleMatch {
+	match := MatchBlock
+	if ParseType(list.Type) == ALLOW {
+		match = MatchAllow
+	}
+	return &RuleMatch{Match: match, List: list, Rule: rule}
+}
+
+// true if the list holds allow/block rules for domains and not rewrites, addresses, or response policies
+func IsDomainList(list *config.GudgeonList) bool {
+	return !IsRewriteList(list) && !IsIPList(list) && !IsRPZList(list)
+}
+
+// the lists that hold allow/block rules for domains
+func domainLists(lists []*config.GudgeonList) []*config.GudgeonList {
+	ruleLists := make([]*config.GudgeonList, 0, len(lists))
+	for _, list := range lists {
+		if IsDomainList(list) {
+			ruleLists = append(ruleLists, list)
+		}
+	}
+	return ruleLists
+}
+
+// stores are created from lists of files inside a configuration, the number of rules loaded and the number of
+// rules skipped (because they can't be used for dns) are given in the same order as the configured lists
+func CreateStore(storeRoot string, config *config.GudgeonConfig) (RuleStore, []uint64, []uint64) {
 	// first create the complex rule store wrapper
 	store := new(complexStore)
 
@@ -60,12 +101,28 @@ func CreateStore(storeRoot string, config *config.GudgeonConfig) (RuleStore, []u
 	} else if "sqlite" == backingStoreType || "sql" == backingStoreType {
 		delegate = new(sqlStore)
 		backingStoreType = "sqlite"
+	} else if "trie" == backingStoreType {
+		delegate = new(trieStore)
 	} else if "bloom" == backingStoreType {
 		delegate = new(bloomStore)
 	} else if "bloom+sqlite" == backingStoreType || "bloom+sql" == backingStoreType {
 		bloomStore := new(bloomStore)
 		bloomStore.backingStore = new(sqlStore)
 		delegate = bloomStore
+	} else if "cuckoo" == backingStoreType {
+		delegate = new(cuckooStore)
+	} else if "cuckoo+sqlite" == backingStoreType || "cuckoo+sql" == backingStoreType {
+		cuckooStore := new(cuckooStore)
+		cuckooStore.backingStore = new(sqlStore)
+		delegate = cuckooStore
+		backingStoreType = "cuckoo+sqlite"
+	} else if "mmap" == backingStoreType {
+		delegate = new(mmapStore)
+	} else if "mmap+sqlite" == backingStoreType || "mmap+sql" == backingStoreType {
+		mmapStore := new(mmapStore)
+		mmapStore.delegate = new(sqlStore)
+		delegate = mmapStore
+		backingStoreType = "mmap+sqlite"
 	} else {
 		if backingStoreType != "memory" && backingStoreType != "mem" && backingStoreType != "" {
 			log.Warnf("Could not find backing store type '%s', using default memory store instead", backingStoreType)
@@ -78,46 +135,158 @@ func CreateStore(storeRoot string, config *config.GudgeonConfig) (RuleStore, []u
 	// set backing store
 	store.backingStore = delegate
 
+	// rewrite, block-ip, and rpz lists are not allow/block rules for domains and are kept out of the store
+	ruleLists := domainLists(config.Lists)
+
+	// find the rules disabled by $badfilter and the block lists with exception or important rules before loading
+	disabled, exceptionLists, importantLists := scanListRules(config, ruleLists)
+	storeLists := store.addAdblockLists(ruleLists, exceptionLists, importantLists)
+
 	// initialize stores
-	store.Init(storeRoot, config, config.Lists)
+	store.Init(storeRoot, config, storeLists)
+
+	// lists that have not changed since they were last loaded are loaded from snapshots of the store (if it can save them)
+	snapshotDir := ""
+	if _, canSnapshot := store.backingStore.(snapshotStore); canSnapshot && config.Storage.Snapshots != nil && *config.Storage.Snapshots {
+		snapshotDir = path.Join(config.DataRoot(), "snapshots", backingStoreType)
+	}
+	snapshotKeys := make(map[string]string)
 
 	// load files into stores based on complexity
 	outputCount := make([]uint64, 0, len(config.Lists))
+	skippedCount := make([]uint64, 0, len(config.Lists))
 
 	for _, list := range config.Lists {
+		// rewrite, block-ip, and rpz lists are counted when their own stores are created
+		if !IsDomainList(list) {
+			outputCount = append(outputCount, 0)
+			skippedCount = append(skippedCount, 0)
+			continue
+		}
+
+		if "" != snapshotDir {
+			key := snapshotKey(config.PathToList(list), disabled)
+			prefix := snapshotPrefix(snapshotDir, list, key)
+			if loaded, skipped, found := readSnapshotCounts(prefix); "" != key && found && loadSnapshot(store, prefix, list) {
+				log.Debugf("List '%s' loaded from snapshot", list.CanonicalName())
+				outputCount = append(outputCount, loaded)
+				skippedCount = append(skippedCount, skipped)
+				continue
+			}
+			if "" != key {
+				snapshotKeys[list.CanonicalName()] = key
+			}
+		}
+
 		// open file and scan
 		data, err := os.Open(config.PathToList(list))
 		if err != nil {
 			data.Close()
 			log.Errorf("Could not open list file: %s", err)
 			outputCount = append(outputCount, 0)
+			skippedCount = append(skippedCount, 0)
 			continue
 		}
 
 		listCounter := uint64(0)
+		skipCounter := uint64(0)
+		isBlockList := ParseType(list.Type) == BLOCK
 
 		// scan through file
 		scanner := bufio.NewScanner(data)
 		for scanner.Scan() {
-			text := ParseLine(scanner.Text())
-			if "" != text {
-				// load the text into the store which will load it into the next delegate
-				// if it doesn't match the parameters of that store
-				store.Load(list, text)
-				listCounter++
+			listRule := ParseListLine(scanner.Text())
+			if listRule == nil || listRule.BadFilter || disabled[listRule.key()] {
+				continue
+			}
+			if listRule.Unsupported {
+				skipCounter++
+				continue
+			}
+
+			// exception and important rules of a block list are loaded into the lists made for them
+			loadList := list
+			if isBlockList && listRule.Exception {
+				loadList = store.exceptionLists[list.CanonicalName()]
+			} else if isBlockList && listRule.Important {
+				loadList = store.importantLists[list.CanonicalName()]
 			}
+
+			// load the text into the store which will load it into the next delegate
+			// if it doesn't match the parameters of that store
+			store.Load(loadList, listRule.Text)
+			listCounter++
 		}
 
 		// close file
 		data.Close()
 
-		// append counter to output count
+		if skipCounter > 0 {
+			log.Infof("List '%s' skipped %d rules that can't be used for DNS", list.CanonicalName(), skipCounter)
+		}
+
+		// append counters to output counts
 		outputCount = append(outputCount, listCounter)
+		skippedCount = append(skippedCount, skipCounter)
 	}
 
 	// finalize both stores (store finalizes delegate)
-	store.Finalize(storeRoot, config.Lists)
+	store.Finalize(storeRoot, storeLists)
+
+	// save snapshots of the lists that were read
+	for idx, list := range config.Lists {
+		if key, found := snapshotKeys[list.CanonicalName()]; found {
+			saveSnapshot(store, snapshotDir, list, key, outputCount[idx], skippedCount[idx])
+		}
+	}
 
 	// finalize and return store
-	return store, outputCount
+	return store, outputCount, skippedCount
+}
+
+// read the lists for rules that are disabled by $badfilter rules (in any list) and for the block lists that have
+// exception or important rules
+func scanListRules(conf *config.GudgeonConfig, lists []*config.GudgeonList) (map[string]bool, []*config.GudgeonList, []*config.GudgeonList) {
+	disabled := make(map[string]bool)
+	exceptionLists := make([]*config.GudgeonList, 0)
+	importantLists := make([]*config.GudgeonList, 0)
+
+	for _, list := range lists {
+		data, err := os.Open(conf.PathToList(list))
+		if err != nil {
+			continue
+		}
+
+		hasExceptions, hasImportant := false, false
+		scanner := bufio.NewScanner(data)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !isAdblockLine(line) {
+				continue
+			}
+			listRule := ParseListLine(line)
+			if listRule == nil || listRule.Unsupported {
+				continue
+			}
+			if listRule.BadFilter {
+				disabled[listRule.key()] = true
+			} else if listRule.Exception {
+				hasExceptions = true
+			} else if listRule.Important {
+				hasImportant = true
+			}
+		}
+		data.Close()
+
+		if ParseType(list.Type) == BLOCK {
+			if hasExceptions {
+				exceptionLists = append(exceptionLists, list)
+			}
+			if hasImportant {
+				importantLists = append(importantLists, list)
+			}
+		}
+	}
+
+	return disabled, exceptionLists, importantLists
 }
@@ -1,6 +1,10 @@
 package rule
 
 import (
+	"bufio"
+	"io"
+	"os"
+
 	"github.com/willf/bloom"
 
 	"github.com/chrisruffalo/gudgeon/config"
@@ -16,6 +20,9 @@ type bloomStore struct {
 	blooms           map[string]*bloom.BloomFilter
 	backingStore     RuleStore
 	defaultRuleCount uint
+
+	// rules can't be taken out of a filter so removed rules are kept (by list) and skipped
+	removed map[string]map[string]bool
 }
 
 func (store *bloomStore) Init(sessionRoot string, config *config.GudgeonConfig, lists []*config.GudgeonList) {
@@ -31,7 +38,8 @@ func (store *bloomStore) Init(sessionRoot string, config *config.GudgeonConfig,
 			linesInFile := store.defaultRuleCount
 			if config != nil {
 				linesInFile, err = util.LineCount(config.PathToList(list))
-				if err != nil {
+				// an empty filter can't be estimated
+				if err != nil || linesInFile == 0 {
 					linesInFile = store.defaultRuleCount
 				}
 			}
@@ -62,6 +70,89 @@ func (store *bloomStore) Finalize(sessionRoot string, lists []*config.GudgeonLis
 	}
 }
 
+func (store *bloomStore) Add(list *config.GudgeonList, rule string) {
+	filter, found := store.blooms[list.CanonicalName()]
+	if !found {
+		filter = bloom.NewWithEstimates(store.defaultRuleCount, bloomRate)
+		store.blooms[list.CanonicalName()] = filter
+	}
+	filter.AddString(rule)
+	if removed, found := store.removed[list.CanonicalName()]; found {
+		delete(removed, rule)
+	}
+
+	if store.backingStore != nil {
+		store.backingStore.Add(list, rule)
+	}
+}
+
+func (store *bloomStore) Remove(list *config.GudgeonList, rule string) {
+	if filter, found := store.blooms[list.CanonicalName()]; found && filter.TestString(rule) {
+		if store.removed == nil {
+			store.removed = make(map[string]map[string]bool)
+		}
+		if _, found := store.removed[list.CanonicalName()]; !found {
+			store.removed[list.CanonicalName()] = make(map[string]bool)
+		}
+		store.removed[list.CanonicalName()][rule] = true
+	}
+
+	if store.backingStore != nil {
+		store.backingStore.Remove(list, rule)
+	}
+}
+
+func (store *bloomStore) readSnapshot(prefix string, list *config.GudgeonList) snapshotCommit {
+	backingStore, ok := store.backingStore.(snapshotStore)
+	if store.backingStore != nil && !ok {
+		return nil
+	}
+
+	data, err := os.Open(prefix + ".bloom")
+	if err != nil {
+		return nil
+	}
+	defer data.Close()
+	filter := &bloom.BloomFilter{}
+	if _, err := filter.ReadFrom(bufio.NewReader(data)); err != nil {
+		return nil
+	}
+
+	var backingCommit snapshotCommit
+	if backingStore != nil {
+		if backingCommit = backingStore.readSnapshot(prefix, list); backingCommit == nil {
+			return nil
+		}
+	}
+	return func(load bool) {
+		if backingCommit != nil {
+			backingCommit(load)
+		}
+		if load {
+			store.blooms[list.CanonicalName()] = filter
+		}
+	}
+}
+
+func (store *bloomStore) saveSnapshot(prefix string, list *config.GudgeonList) error {
+	filter, found := store.blooms[list.CanonicalName()]
+	if !found {
+		return nil
+	}
+	err := writeSnapshotFile(prefix+".bloom", func(writer io.Writer) error {
+		_, err := filter.WriteTo(writer)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if backingStore, ok := store.backingStore.(snapshotStore); ok {
+		return backingStore.saveSnapshot(prefix, list)
+	}
+	return nil
+}
+
 func (store *bloomStore) foundInList(filter *bloom.BloomFilter, domain string) (bool, string) {
 	// otherwise return false
 	return filter.TestString(domain), ""
@@ -86,8 +177,9 @@ func (store *bloomStore) FindMatch(lists []*config.GudgeonList, domain string) (
 		if !found {
 			continue
 		}
+		removed := store.removed[list.CanonicalName()]
 		for _, d := range domains {
-			if found, ruleString := store.foundInList(filter, d); found {
+			if found, ruleString := store.foundInList(filter, d); found && !removed[d] {
 				if store.backingStore != nil {
 					return store.backingStore.FindMatch([]*config.GudgeonList{list}, domain)
 				}
@@ -101,8 +193,9 @@ func (store *bloomStore) FindMatch(lists []*config.GudgeonList, domain string) (
 		if !found {
 			continue
 		}
+		removed := store.removed[list.CanonicalName()]
 		for _, d := range domains {
-			if found, ruleString := store.foundInList(filter, d); found {
+			if found, ruleString := store.foundInList(filter, d); found && !removed[d] {
 				if store.backingStore != nil {
 					return store.backingStore.FindMatch([]*config.GudgeonList{list}, domain)
 				}
@@ -114,6 +207,29 @@ func (store *bloomStore) FindMatch(lists []*config.GudgeonList, domain string) (
 	return MatchNone, nil, ""
 }
 
+func (store *bloomStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	// the backing store has the rule text and no false positives
+	if store.backingStore != nil {
+		return store.backingStore.FindAllMatches(lists, domain)
+	}
+
+	matches := make([]*RuleMatch, 0)
+	domains := util.DomainList(domain)
+	for _, list := range lists {
+		filter, found := store.blooms[list.CanonicalName()]
+		if !found {
+			continue
+		}
+		removed := store.removed[list.CanonicalName()]
+		for _, d := range domains {
+			if found, _ := store.foundInList(filter, d); found && !removed[d] {
+				matches = append(matches, newRuleMatch(list, d))
+			}
+		}
+	}
+	return matches
+}
+
 func (store *bloomStore) Close() {
 	// default no-op
 
@@ -6,6 +6,7 @@ import (
 
 func TestBloomRuleStore(t *testing.T) {
 	testStore(defaultRuleData, func() RuleStore { return &bloomStore{} }, t)
+	testStoreUpdates(updateRules, func() RuleStore { return &bloomStore{} }, t)
 }
 
 func BenchmarkBloomRuleStore(b *testing.B) {
@@ -19,6 +20,12 @@ func TestBloomSqlRuleStore(t *testing.T) {
 			defaultRuleCount: 1000000,
 		}
 	}, t)
+	testStoreUpdates(updateRules, func() RuleStore {
+		return &bloomStore{
+			backingStore:     &sqlStore{},
+			defaultRuleCount: 1000000,
+		}
+	}, t)
 }
 
 func BenchmarkBloomSqlRuleStore(b *testing.B) {
@@ -1,16 +1,53 @@
 package rule
 
 import (
+	"bufio"
+	"io"
+	"os"
+
 	"github.com/chrisruffalo/gudgeon/config"
 )
 
 type complexStore struct {
 	backingStore RuleStore
 	complexRules map[string][]ComplexRule
+	// the complex rules of each list compiled for matching when the store is finalized
+	matchers map[string]*complexMatcher
+
+	// the lists that hold the exception and important rules of block lists, by the name of the block list
+	exceptionLists map[string]*config.GudgeonList
+	importantLists map[string]*config.GudgeonList
+
+	// the block list that each exception or important list belongs to
+	parentLists map[string]*config.GudgeonList
+}
+
+// create the lists that hold the exception and important rules of the given block lists and return them with the other lists
+func (store *complexStore) addAdblockLists(lists []*config.GudgeonList, exceptionLists []*config.GudgeonList, importantLists []*config.GudgeonList) []*config.GudgeonList {
+	store.exceptionLists = make(map[string]*config.GudgeonList)
+	store.importantLists = make(map[string]*config.GudgeonList)
+	store.parentLists = make(map[string]*config.GudgeonList)
+
+	storeLists := append(make([]*config.GudgeonList, 0, len(lists)+len(exceptionLists)+len(importantLists)), lists...)
+	for _, list := range exceptionLists {
+		exceptions := &config.GudgeonList{Name: list.CanonicalName() + " exceptions", Type: ALLOWSTRING, Tags: &[]string{}}
+		store.exceptionLists[list.CanonicalName()] = exceptions
+		store.parentLists[exceptions.CanonicalName()] = list
+		storeLists = append(storeLists, exceptions)
+	}
+	for _, list := range importantLists {
+		important := &config.GudgeonList{Name: list.CanonicalName() + " important", Tags: &[]string{}}
+		store.importantLists[list.CanonicalName()] = important
+		store.parentLists[important.CanonicalName()] = list
+		storeLists = append(storeLists, important)
+	}
+
+	return storeLists
 }
 
 func (store *complexStore) Init(sessionRoot string, config *config.GudgeonConfig, lists []*config.GudgeonList) {
 	store.complexRules = make(map[string][]ComplexRule, 0)
+	store.matchers = make(map[string]*complexMatcher)
 
 	for _, list := range lists {
 		if _, found := store.complexRules[list.CanonicalName()]; !found {
@@ -36,8 +73,57 @@ func (store *complexStore) Load(list *config.GudgeonList, rule string) {
 	}
 }
 
+func (store *complexStore) Add(list *config.GudgeonList, rule string) {
+	if !IsComplex(rule) {
+		if store.backingStore != nil {
+			store.backingStore.Add(list, rule)
+		}
+		return
+	}
+
+	for _, complexRule := range store.complexRules[list.CanonicalName()] {
+		if complexRule.Text() == rule {
+			return
+		}
+	}
+	if complexRule := CreateComplexRule(rule); complexRule != nil {
+		store.complexRules[list.CanonicalName()] = append(store.complexRules[list.CanonicalName()], complexRule)
+		store.compile(list.CanonicalName())
+	}
+}
+
+func (store *complexStore) Remove(list *config.GudgeonList, rule string) {
+	if !IsComplex(rule) {
+		if store.backingStore != nil {
+			store.backingStore.Remove(list, rule)
+		}
+		return
+	}
+
+	rules := store.complexRules[list.CanonicalName()]
+	for idx, complexRule := range rules {
+		if complexRule.Text() == rule {
+			store.complexRules[list.CanonicalName()] = append(rules[:idx], rules[idx+1:]...)
+			store.compile(list.CanonicalName())
+			return
+		}
+	}
+}
+
+// compile the complex rules of the list into a new matcher so that a matcher in use is never changed
+func (store *complexStore) compile(listName string) {
+	rules := store.complexRules[listName]
+	if len(rules) == 0 {
+		delete(store.matchers, listName)
+		return
+	}
+	store.matchers[listName] = newComplexMatcher(append(make([]ComplexRule, 0, len(rules)), rules...))
+}
+
 func (store *complexStore) Finalize(sessionRoot string, lists []*config.GudgeonList) {
-	// no-op
+	for listName := range store.complexRules {
+		store.compile(listName)
+	}
 
 	if store.backingStore != nil {
 		store.backingStore.Finalize(sessionRoot, lists)
@@ -45,6 +131,39 @@ func (store *complexStore) Finalize(sessionRoot string, lists []*config.GudgeonL
 }
 
 func (store *complexStore) FindMatch(lists []*config.GudgeonList, domain string) (Match, *config.GudgeonList, string) {
+	if len(store.parentLists) == 0 {
+		return store.findMatch(lists, domain)
+	}
+
+	// important rules are checked before any allow list or exception
+	important := make([]*config.GudgeonList, 0)
+	withExceptions := make([]*config.GudgeonList, 0, len(lists))
+	for _, list := range lists {
+		if importantList, found := store.importantLists[list.CanonicalName()]; found {
+			important = append(important, importantList)
+		}
+		if exceptionList, found := store.exceptionLists[list.CanonicalName()]; found {
+			withExceptions = append(withExceptions, exceptionList)
+		}
+		withExceptions = append(withExceptions, list)
+	}
+	if len(important) > 0 {
+		if match, list, rule := store.findMatch(important, domain); match != MatchNone {
+			return match, store.parentLists[list.CanonicalName()], rule + adblockOptions + adblockImportant
+		}
+	}
+
+	// matches from exceptions are reported as coming from the block list they were in
+	match, list, rule := store.findMatch(withExceptions, domain)
+	if list != nil {
+		if parent, found := store.parentLists[list.CanonicalName()]; found {
+			return match, parent, adblockException + rule
+		}
+	}
+	return match, list, rule
+}
+
+func (store *complexStore) findMatch(lists []*config.GudgeonList, domain string) (Match, *config.GudgeonList, string) {
 	// allow and block split
 	allowLists := make([]*config.GudgeonList, 0)
 	blockLists := make([]*config.GudgeonList, 0)
@@ -57,28 +176,24 @@ func (store *complexStore) FindMatch(lists []*config.GudgeonList, domain string)
 	}
 
 	for _, list := range allowLists {
-		rules, found := store.complexRules[list.CanonicalName()]
+		matcher, found := store.matchers[list.CanonicalName()]
 		if !found {
 			continue
 		}
 
-		for _, rule := range rules {
-			if rule.IsMatch(domain) {
-				return MatchAllow, list, rule.Text()
-			}
+		if rule := matcher.match(domain); rule != nil {
+			return MatchAllow, list, rule.Text()
 		}
 	}
 
 	for _, list := range blockLists {
-		rules, found := store.complexRules[list.CanonicalName()]
+		matcher, found := store.matchers[list.CanonicalName()]
 		if !found {
 			continue
 		}
 
-		for _, rule := range rules {
-			if rule.IsMatch(domain) {
-				return MatchBlock, list, rule.Text()
-			}
+		if rule := matcher.match(domain); rule != nil {
+			return MatchBlock, list, rule.Text()
 		}
 	}
 
@@ -90,6 +205,148 @@ func (store *complexStore) FindMatch(lists []*config.GudgeonList, domain string)
 	return MatchNone, nil, ""
 }
 
+func (store *complexStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	matches := make([]*RuleMatch, 0)
+	for _, list := range lists {
+		// important and exception rules are reported as coming from the block list they were in
+		if important, found := store.importantLists[list.CanonicalName()]; found {
+			for _, match := range store.findAllMatches(important, domain) {
+				match.List = list
+				match.Rule = match.Rule + adblockOptions + adblockImportant
+				matches = append(matches, match)
+			}
+		}
+		if exceptions, found := store.exceptionLists[list.CanonicalName()]; found {
+			for _, match := range store.findAllMatches(exceptions, domain) {
+				match.List = list
+				match.Rule = adblockException + match.Rule
+				matches = append(matches, match)
+			}
+		}
+		matches = append(matches, store.findAllMatches(list, domain)...)
+	}
+	return matches
+}
+
+// the complex rules and then the rules of the backing store that match in the list
+func (store *complexStore) findAllMatches(list *config.GudgeonList, domain string) []*RuleMatch {
+	matches := make([]*RuleMatch, 0)
+	if matcher, found := store.matchers[list.CanonicalName()]; found {
+		for _, rule := range matcher.matchAll(domain) {
+			matches = append(matches, newRuleMatch(list, rule.Text()))
+		}
+	}
+	if store.backingStore != nil {
+		matches = append(matches, store.backingStore.FindAllMatches([]*config.GudgeonList{list}, domain)...)
+	}
+	return matches
+}
+
+// the list with the lists made for its exception and important rules, and the prefixes of their snapshots
+func (store *complexStore) snapshotLists(prefix string, list *config.GudgeonList) ([]*config.GudgeonList, []string) {
+	lists := []*config.GudgeonList{list}
+	prefixes := []string{prefix}
+	if exceptions, found := store.exceptionLists[list.CanonicalName()]; found {
+		lists = append(lists, exceptions)
+		prefixes = append(prefixes, prefix+"-exceptions")
+	}
+	if important, found := store.importantLists[list.CanonicalName()]; found {
+		lists = append(lists, important)
+		prefixes = append(prefixes, prefix+"-important")
+	}
+	return lists, prefixes
+}
+
+// the list and its exception and important lists are only loaded once the snapshots of all of them were read so that a
+// list is never loaded from a snapshot and then read again from the list
+func (store *complexStore) readSnapshot(prefix string, list *config.GudgeonList) snapshotCommit {
+	backing, ok := store.backingStore.(snapshotStore)
+	if !ok {
+		return nil
+	}
+
+	lists, prefixes := store.snapshotLists(prefix, list)
+	complexRules := make([][]ComplexRule, len(lists))
+	for idx, listPrefix := range prefixes {
+		data, err := os.Open(listPrefix + ".complex")
+		if err != nil {
+			return nil
+		}
+		complexRules[idx] = make([]ComplexRule, 0)
+		scanner := bufio.NewScanner(data)
+		for scanner.Scan() {
+			if complexRule := CreateComplexRule(scanner.Text()); complexRule != nil {
+				complexRules[idx] = append(complexRules[idx], complexRule)
+			}
+		}
+		data.Close()
+	}
+
+	commits := make([]snapshotCommit, 0, len(lists))
+	for idx, snapshotList := range lists {
+		commit := backing.readSnapshot(prefixes[idx], snapshotList)
+		if commit == nil {
+			for _, read := range commits {
+				read(false)
+			}
+			return nil
+		}
+		commits = append(commits, commit)
+	}
+	return func(load bool) {
+		for _, commit := range commits {
+			commit(load)
+		}
+		if load {
+			for idx, snapshotList := range lists {
+				store.complexRules[snapshotList.CanonicalName()] = complexRules[idx]
+			}
+		}
+	}
+}
+
+func (store *complexStore) saveSnapshot(prefix string, list *config.GudgeonList) error {
+	backing, ok := store.backingStore.(snapshotStore)
+	if !ok {
+		return nil
+	}
+
+	lists, prefixes := store.snapshotLists(prefix, list)
+	for idx, snapshotList := range lists {
+		err := writeSnapshotFile(prefixes[idx]+".complex", func(writer io.Writer) error {
+			for _, complexRule := range store.complexRules[snapshotList.CanonicalName()] {
+				if _, err := io.WriteString(writer, complexRule.Text()+"\n"); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := backing.saveSnapshot(prefixes[idx], snapshotList); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// complex rules are taken out by their text so only the backing store decides if the store updates in place
+func (store *complexStore) updatesInPlace() bool {
+	return UpdatesInPlace(store.backingStore)
+}
+
+// the complex rules are not counted, only the stats of the backing store are reported
+func (store *complexStore) stats() *StoreStats {
+	return GetStoreStats(store.backingStore)
+}
+
 func (store *complexStore) Close() {
-	// default no-op
+	store.complexRules = nil
+	store.matchers = nil
+
+	if store.backingStore != nil {
+		store.backingStore.Close()
+	}
 }
@@ -0,0 +1,301 @@
+package rule
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+type cuckooStore struct {
+	// lookups happen in parallel so the counts are kept with atomic operations (and first for alignment)
+	lookups        uint64
+	falsePositives uint64
+
+	// each list starts with one filter and another (twice as big) is added when the last one is full
+	filters map[string][]*cuckooFilter
+	// the hashes of the rules of each list while it is loaded, they are put in the filters when the store is finalized
+	loading map[string][]cuckooHash
+
+	backingStore     RuleStore
+	defaultRuleCount uint
+}
+
+func (store *cuckooStore) Init(sessionRoot string, config *config.GudgeonConfig, lists []*config.GudgeonList) {
+	store.filters = make(map[string][]*cuckooFilter)
+	store.loading = make(map[string][]cuckooHash)
+	if store.defaultRuleCount <= 0 {
+		store.defaultRuleCount = defaultRuleCount
+	}
+
+	for _, list := range lists {
+		if _, found := store.filters[list.CanonicalName()]; !found {
+			// get lines in file
+			var err error
+			linesInFile := store.defaultRuleCount
+			if config != nil {
+				linesInFile, err = util.LineCount(config.PathToList(list))
+				if err != nil || linesInFile == 0 {
+					linesInFile = store.defaultRuleCount
+				}
+			}
+			store.filters[list.CanonicalName()] = []*cuckooFilter{newCuckooFilter(linesInFile)}
+		}
+	}
+
+	if store.backingStore != nil {
+		store.backingStore.Init(sessionRoot, config, lists)
+	}
+}
+
+func (store *cuckooStore) contains(filters []*cuckooFilter, hash cuckooHash) bool {
+	for _, filter := range filters {
+		if filter.contains(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// every insert puts another fingerprint in the filter, even when a rule with the same fingerprint is there already, so
+// that each insert has a remove that takes it out without taking out another rule
+func (store *cuckooStore) insert(listName string, hash cuckooHash) {
+	filters := store.filters[listName]
+	if len(filters) == 0 || !filters[len(filters)-1].insert(hash) {
+		capacity := store.defaultRuleCount
+		if len(filters) > 0 {
+			capacity = uint(len(filters[len(filters)-1].slots)) * 2
+		}
+		filter := newCuckooFilter(capacity)
+		filter.insert(hash)
+		store.filters[listName] = append(filters, filter)
+	}
+}
+
+func (store *cuckooStore) Load(list *config.GudgeonList, rule string) {
+	store.loading[list.CanonicalName()] = append(store.loading[list.CanonicalName()], hashCuckoo(rule))
+
+	if store.backingStore != nil {
+		store.backingStore.Load(list, rule)
+	}
+}
+
+func (store *cuckooStore) Finalize(sessionRoot string, lists []*config.GudgeonList) {
+	// a rule that is in a list more than once is only put in the filter once, rules are told apart by their whole hash
+	// and not just by the fingerprint that is kept in the filter
+	for listName, hashes := range store.loading {
+		sort.Slice(hashes, func(i, j int) bool {
+			return hashes[i] < hashes[j]
+		})
+		for idx, hash := range hashes {
+			if idx == 0 || hash != hashes[idx-1] {
+				store.insert(listName, hash)
+			}
+		}
+	}
+	store.loading = make(map[string][]cuckooHash)
+
+	if store.backingStore != nil {
+		store.backingStore.Finalize(sessionRoot, lists)
+	}
+}
+
+func (store *cuckooStore) Add(list *config.GudgeonList, rule string) {
+	store.insert(list.CanonicalName(), hashCuckoo(rule))
+
+	if store.backingStore != nil {
+		store.backingStore.Add(list, rule)
+	}
+}
+
+func (store *cuckooStore) Remove(list *config.GudgeonList, rule string) {
+	hash := hashCuckoo(rule)
+	for _, filter := range store.filters[list.CanonicalName()] {
+		if filter.remove(hash) {
+			break
+		}
+	}
+
+	if store.backingStore != nil {
+		store.backingStore.Remove(list, rule)
+	}
+}
+
+func (store *cuckooStore) readSnapshot(prefix string, list *config.GudgeonList) snapshotCommit {
+	backingStore, ok := store.backingStore.(snapshotStore)
+	if store.backingStore != nil && !ok {
+		return nil
+	}
+
+	data, err := os.Open(prefix + ".cuckoo")
+	if err != nil {
+		return nil
+	}
+	defer data.Close()
+	reader := bufio.NewReader(data)
+	var count uint64
+	if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+		return nil
+	}
+	filters := make([]*cuckooFilter, 0, count)
+	for idx := uint64(0); idx < count; idx++ {
+		filter, err := readCuckooFilter(reader)
+		if err != nil {
+			return nil
+		}
+		filters = append(filters, filter)
+	}
+
+	var backingCommit snapshotCommit
+	if backingStore != nil {
+		if backingCommit = backingStore.readSnapshot(prefix, list); backingCommit == nil {
+			return nil
+		}
+	}
+	return func(load bool) {
+		if backingCommit != nil {
+			backingCommit(load)
+		}
+		if load {
+			delete(store.loading, list.CanonicalName())
+			store.filters[list.CanonicalName()] = filters
+		}
+	}
+}
+
+func (store *cuckooStore) saveSnapshot(prefix string, list *config.GudgeonList) error {
+	filters, found := store.filters[list.CanonicalName()]
+	if !found {
+		return nil
+	}
+	err := writeSnapshotFile(prefix+".cuckoo", func(writer io.Writer) error {
+		if err := binary.Write(writer, binary.LittleEndian, uint64(len(filters))); err != nil {
+			return err
+		}
+		for _, filter := range filters {
+			if err := filter.writeTo(writer); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if backingStore, ok := store.backingStore.(snapshotStore); ok {
+		return backingStore.saveSnapshot(prefix, list)
+	}
+	return nil
+}
+
+// the first match in the lists of the given type, matches in the filter are checked with the backing store (if there
+// is one) and counted as false positives when the backing store doesn't have them
+func (store *cuckooStore) findInLists(lists []*config.GudgeonList, listType uint8, domains []string) (Match, *config.GudgeonList, string) {
+	for _, list := range lists {
+		if (ParseType(list.Type) == ALLOW) != (listType == ALLOW) {
+			continue
+		}
+		filters, found := store.filters[list.CanonicalName()]
+		if !found {
+			continue
+		}
+		for _, d := range domains {
+			atomic.AddUint64(&store.lookups, 1)
+			if !store.contains(filters, hashCuckoo(d)) {
+				continue
+			}
+			if store.backingStore == nil {
+				return newRuleMatch(list, d).Match, list, d
+			}
+			if match, matchList, ruleText := store.backingStore.FindMatch([]*config.GudgeonList{list}, d); match != MatchNone {
+				return match, matchList, ruleText
+			}
+			atomic.AddUint64(&store.falsePositives, 1)
+		}
+	}
+	return MatchNone, nil, ""
+}
+
+func (store *cuckooStore) FindMatch(lists []*config.GudgeonList, domain string) (Match, *config.GudgeonList, string) {
+	domains := util.DomainList(domain)
+
+	if match, list, ruleText := store.findInLists(lists, ALLOW, domains); match != MatchNone {
+		return match, list, ruleText
+	}
+	return store.findInLists(lists, BLOCK, domains)
+}
+
+func (store *cuckooStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	// the backing store has the rule text and no false positives
+	if store.backingStore != nil {
+		return store.backingStore.FindAllMatches(lists, domain)
+	}
+
+	matches := make([]*RuleMatch, 0)
+	domains := util.DomainList(domain)
+	for _, list := range lists {
+		filters, found := store.filters[list.CanonicalName()]
+		if !found {
+			continue
+		}
+		for _, d := range domains {
+			if store.contains(filters, hashCuckoo(d)) {
+				matches = append(matches, newRuleMatch(list, d))
+			}
+		}
+	}
+	return matches
+}
+
+// each rule has its own fingerprint (and the sqlite store takes out rules by their text) so removing a rule never takes
+// out another one
+func (store *cuckooStore) updatesInPlace() bool {
+	if store.backingStore != nil {
+		return UpdatesInPlace(store.backingStore)
+	}
+	return true
+}
+
+func (store *cuckooStore) stats() *StoreStats {
+	stats := &StoreStats{
+		Lookups:        atomic.LoadUint64(&store.lookups),
+		FalsePositives: atomic.LoadUint64(&store.falsePositives),
+		Measured:       store.backingStore != nil,
+	}
+
+	rules, slots := uint64(0), uint64(0)
+	for _, filters := range store.filters {
+		for _, filter := range filters {
+			stats.MemoryBytes += filter.memoryBytes()
+			rules += filter.count
+			slots += uint64(len(filter.slots))
+		}
+	}
+
+	if stats.Measured {
+		if stats.Lookups > 0 {
+			stats.FalsePositiveRate = float64(stats.FalsePositives) / float64(stats.Lookups)
+		}
+	} else if slots > 0 {
+		// each lookup compares the fingerprint with the filled slots of two buckets
+		compared := 2 * cuckooBucketSize * float64(rules) / float64(slots)
+		stats.FalsePositiveRate = 1 - math.Pow(1-1/float64(math.MaxUint16), compared)
+	}
+
+	return stats
+}
+
+func (store *cuckooStore) Close() {
+	store.filters = nil
+
+	if store.backingStore != nil {
+		store.backingStore.Close()
+	}
+}
@@ -0,0 +1,178 @@
+package rule
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestCuckooRuleStore(t *testing.T) {
+	testStore(defaultRuleData, func() RuleStore { return &cuckooStore{} }, t)
+	testStoreUpdates(updateRules, func() RuleStore { return &cuckooStore{} }, t)
+}
+
+func TestCuckooSqlRuleStore(t *testing.T) {
+	testStore(defaultRuleData, func() RuleStore { return &cuckooStore{backingStore: &sqlStore{}} }, t)
+	testStoreUpdates(updateRules, func() RuleStore { return &cuckooStore{backingStore: &sqlStore{}} }, t)
+}
+
+func TestCuckooFilter(t *testing.T) {
+	filter := newCuckooFilter(10000)
+	for idx := 0; idx < 10000; idx++ {
+		if !filter.insert(hashCuckoo(fmt.Sprintf("rule-%d.com", idx))) {
+			t.Fatalf("Filter was full after %d of the 10000 rules it was sized for", idx)
+		}
+	}
+
+	falsePositives := 0
+	for idx := 0; idx < 100000; idx++ {
+		if filter.contains(hashCuckoo(fmt.Sprintf("other-%d.com", idx))) {
+			falsePositives++
+		}
+	}
+	// about 0.012% (12) when full, allow for some variance
+	if falsePositives > 50 {
+		t.Errorf("Expected a false positive rate under 0.05%% but found %d false positives in 100000 lookups", falsePositives)
+	}
+
+	// every rule can be taken out again
+	for idx := 0; idx < 10000; idx++ {
+		rule := fmt.Sprintf("rule-%d.com", idx)
+		if !filter.contains(hashCuckoo(rule)) {
+			t.Errorf("Rule '%s' was not found in the filter", rule)
+		}
+		if !filter.remove(hashCuckoo(rule)) {
+			t.Errorf("Rule '%s' could not be removed from the filter", rule)
+		}
+	}
+	if filter.count != 0 || filter.victim != nil {
+		t.Errorf("Expected an empty filter but it has %d rules", filter.count)
+	}
+	for _, slot := range filter.slots {
+		if slot != 0 {
+			t.Errorf("Expected every slot to be empty after removing every rule")
+			break
+		}
+	}
+}
+
+func TestCuckooRuleStoreSharedFingerprints(t *testing.T) {
+	// find two rules with the same fingerprint, with one bucket they are also in the same bucket
+	fingerprints := make(map[uint16]string)
+	var first, second string
+	for idx := 0; "" == second; idx++ {
+		rule := fmt.Sprintf("rule-%d.com", idx)
+		_, fingerprint := newCuckooFilter(1).index(hashCuckoo(rule))
+		if other, found := fingerprints[fingerprint]; found {
+			first, second = other, rule
+		}
+		fingerprints[fingerprint] = rule
+	}
+
+	list := &config.GudgeonList{Name: "Block", Type: "block"}
+	lists := []*config.GudgeonList{list}
+	store := &cuckooStore{defaultRuleCount: 1}
+	store.Init("", nil, lists)
+	store.Load(list, first)
+	store.Load(list, second)
+	store.Load(list, first)
+	store.Finalize("", lists)
+	defer store.Close()
+
+	expect := func(step string, domain string, match Match) {
+		if found, _, _ := store.FindMatch(lists, domain); found != match {
+			t.Errorf("After %s expected '%s' to have match %d but got %d", step, domain, match, found)
+		}
+	}
+
+	// removing one of the rules leaves the other, a rule loaded twice is only in the filter once
+	store.Remove(list, first)
+	expect("removing the first rule", second, MatchBlock)
+	store.Remove(list, second)
+	expect("removing both rules", second, MatchNone)
+	expect("removing both rules", first, MatchNone)
+
+	// the same for rules that are added
+	store.Add(list, first)
+	store.Add(list, second)
+	store.Remove(list, second)
+	expect("adding both rules and removing the second", first, MatchBlock)
+	store.Remove(list, first)
+	expect("removing the added rules", first, MatchNone)
+}
+
+func TestCuckooRuleStoreGrowsAndReportsStats(t *testing.T) {
+	list := &config.GudgeonList{Name: "Block", Type: "block"}
+	lists := []*config.GudgeonList{list}
+
+	store := &cuckooStore{defaultRuleCount: 100}
+	store.Init("", nil, lists)
+	for idx := 0; idx < 1000; idx++ {
+		store.Load(list, fmt.Sprintf("rule-%d.com", idx))
+	}
+	store.Finalize("", lists)
+	defer store.Close()
+
+	if len(store.filters[list.CanonicalName()]) < 2 {
+		t.Errorf("Expected more filters to be added when the first one is full")
+	}
+	for idx := 0; idx < 1000; idx++ {
+		if match, _, _ := store.FindMatch(lists, fmt.Sprintf("www.rule-%d.com", idx)); match != MatchBlock {
+			t.Errorf("Expected rule %d to match after more filters were added", idx)
+		}
+	}
+	store.Remove(list, "rule-10.com")
+	if match, _, _ := store.FindMatch(lists, "rule-10.com"); match != MatchNone {
+		t.Errorf("Expected removed rule to not match")
+	}
+
+	stats := GetStoreStats(store)
+	if stats == nil || stats.MemoryBytes == 0 || stats.Measured || stats.FalsePositiveRate <= 0 || stats.FalsePositiveRate > 0.001 {
+		t.Errorf("Expected the memory and estimated false positive rate in the stats but got %+v", stats)
+	}
+}
+
+func TestCuckooSqlRuleStoreMeasuresFalsePositives(t *testing.T) {
+	list := &config.GudgeonList{Name: "Block", Type: "block"}
+	lists := []*config.GudgeonList{list}
+
+	tmpDir := testutil.TempDir()
+	defer os.RemoveAll(tmpDir)
+
+	store := &cuckooStore{backingStore: &sqlStore{}}
+	store.Init(tmpDir, nil, lists)
+	store.Load(list, "ads.com")
+	store.Finalize(tmpDir, lists)
+	defer store.Close()
+
+	// make sure that a domain that isn't a rule is in the filter
+	store.filters[list.CanonicalName()][0].insert(hashCuckoo("false.com"))
+
+	if match, _, ruleText := store.FindMatch(lists, "false.com"); match != MatchNone {
+		t.Errorf("Expected the backing store to reject the match in the filter but got rule '%s'", ruleText)
+	}
+	if match, _, ruleText := store.FindMatch(lists, "www.ads.com"); match != MatchBlock || ruleText != "ads.com" {
+		t.Errorf("Expected a block by 'ads.com' but got rule '%s'", ruleText)
+	}
+
+	stats := (&complexStore{backingStore: store}).stats()
+	if stats == nil || !stats.Measured || stats.FalsePositives != 1 || stats.Lookups != 3 {
+		t.Errorf("Expected one false positive in three lookups but got %+v", stats)
+	}
+}
+
+func BenchmarkCuckooRuleStore(b *testing.B) {
+	benchNonComplexStore(func() RuleStore { return &cuckooStore{} }, b)
+}
+
+func BenchmarkCuckooSqlRuleStore(b *testing.B) {
+	benchNonComplexStore(func() RuleStore {
+		return &cuckooStore{
+			backingStore:     &sqlStore{},
+			defaultRuleCount: benchRules,
+		}
+	}, b)
+}
@@ -1,7 +1,10 @@
 package rule
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"sort"
 	"strings"
 
@@ -13,12 +16,15 @@ import (
 
 type hashStore struct {
 	hashes map[string][]uint64
+	// lists loaded from snapshots are already sorted
+	sorted map[string]bool
 
 	delegate RuleStore
 }
 
 func (store *hashStore) Init(sessionRoot string, config *config.GudgeonConfig, lists []*config.GudgeonList) {
 	store.hashes = make(map[string][]uint64)
+	store.sorted = make(map[string]bool)
 	for _, list := range lists {
 		if _, found := store.hashes[list.CanonicalName()]; !found {
 			startingArrayLength := uint(0)
@@ -35,6 +41,7 @@ func (store *hashStore) Init(sessionRoot string, config *config.GudgeonConfig, l
 }
 
 func (store *hashStore) Load(list *config.GudgeonList, rule string) {
+	delete(store.sorted, list.CanonicalName())
 	store.hashes[list.CanonicalName()] = append(store.hashes[list.CanonicalName()], murmur3.StringSum64(strings.ToLower(rule)))
 
 	if store.delegate != nil {
@@ -44,6 +51,9 @@ func (store *hashStore) Load(list *config.GudgeonList, rule string) {
 
 func (store *hashStore) Finalize(sessionRoot string, lists []*config.GudgeonList) {
 	for k := range store.hashes {
+		if store.sorted[k] {
+			continue
+		}
 		// sort
 		sort.Slice(store.hashes[k], func(i, j int) bool {
 			return store.hashes[k][i] < store.hashes[k][j]
@@ -55,11 +65,97 @@ func (store *hashStore) Finalize(sessionRoot string, lists []*config.GudgeonList
 	}
 }
 
+// the index the hash is (or would be) at in the sorted hashes
+func (store *hashStore) hashIndex(hashes []uint64, hash uint64) int {
+	return sort.Search(len(hashes), func(i int) bool {
+		return hashes[i] >= hash
+	})
+}
+
+func (store *hashStore) Add(list *config.GudgeonList, rule string) {
+	hash := murmur3.StringSum64(strings.ToLower(rule))
+	hashes := store.hashes[list.CanonicalName()]
+	if idx := store.hashIndex(hashes, hash); idx >= len(hashes) || hashes[idx] != hash {
+		hashes = append(hashes, 0)
+		copy(hashes[idx+1:], hashes[idx:])
+		hashes[idx] = hash
+		store.hashes[list.CanonicalName()] = hashes
+	}
+
+	if store.delegate != nil {
+		store.delegate.Add(list, rule)
+	}
+}
+
+func (store *hashStore) Remove(list *config.GudgeonList, rule string) {
+	hash := murmur3.StringSum64(strings.ToLower(rule))
+	hashes := store.hashes[list.CanonicalName()]
+	if idx := store.hashIndex(hashes, hash); idx < len(hashes) && hashes[idx] == hash {
+		store.hashes[list.CanonicalName()] = append(hashes[:idx], hashes[idx+1:]...)
+	}
+
+	if store.delegate != nil {
+		store.delegate.Remove(list, rule)
+	}
+}
+
+func (store *hashStore) readSnapshot(prefix string, list *config.GudgeonList) snapshotCommit {
+	delegate, ok := store.delegate.(snapshotStore)
+	if store.delegate != nil && !ok {
+		return nil
+	}
+
+	// the hashes are saved in order, 8 little-endian bytes each
+	data, err := ioutil.ReadFile(prefix + ".hash64")
+	if err != nil || len(data)%8 != 0 {
+		return nil
+	}
+	hashes := make([]uint64, len(data)/8)
+	for idx := range hashes {
+		hashes[idx] = binary.LittleEndian.Uint64(data[idx*8:])
+	}
+
+	var delegateCommit snapshotCommit
+	if delegate != nil {
+		if delegateCommit = delegate.readSnapshot(prefix, list); delegateCommit == nil {
+			return nil
+		}
+	}
+	return func(load bool) {
+		if delegateCommit != nil {
+			delegateCommit(load)
+		}
+		if load {
+			store.hashes[list.CanonicalName()] = hashes
+			store.sorted[list.CanonicalName()] = true
+		}
+	}
+}
+
+func (store *hashStore) saveSnapshot(prefix string, list *config.GudgeonList) error {
+	err := writeSnapshotFile(prefix+".hash64", func(writer io.Writer) error {
+		buffer := make([]byte, 8)
+		for _, hash := range store.hashes[list.CanonicalName()] {
+			binary.LittleEndian.PutUint64(buffer, hash)
+			if _, err := writer.Write(buffer); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if delegate, ok := store.delegate.(snapshotStore); ok {
+		return delegate.saveSnapshot(prefix, list)
+	}
+	return nil
+}
+
 func (store *hashStore) foundInList(rules []uint64, domainHash uint64) (bool, uint64) {
 	// search for the domain
-	idx := sort.Search(len(rules), func(i int) bool {
-		return rules[i] >= domainHash
-	})
+	idx := store.hashIndex(rules, domainHash)
 
 	// check that search found what we expected and return true if found
 	if idx < len(rules) && rules[idx] == domainHash {
@@ -123,6 +219,28 @@ func (store *hashStore) FindMatch(lists []*config.GudgeonList, domain string) (M
 	return MatchNone, nil, ""
 }
 
+func (store *hashStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	// the delegate has the rule text
+	if store.delegate != nil {
+		return store.delegate.FindAllMatches(lists, domain)
+	}
+
+	matches := make([]*RuleMatch, 0)
+	domains := util.DomainList(domain)
+	for _, list := range lists {
+		rules, found := store.hashes[list.CanonicalName()]
+		if !found {
+			continue
+		}
+		for _, d := range domains {
+			if found, _ := store.foundInList(rules, murmur3.StringSum64(strings.ToLower(d))); found {
+				matches = append(matches, newRuleMatch(list, d))
+			}
+		}
+	}
+	return matches
+}
+
 func (store *hashStore) Close() {
 
 	if store.delegate != nil {
@@ -6,6 +6,7 @@ import (
 
 func TestHash32RuleStore(t *testing.T) {
 	testStore(defaultRuleData, func() RuleStore { return &hashStore32{} }, t)
+	testStoreUpdates(updateRules, func() RuleStore { return &hashStore32{} }, t)
 }
 
 func BenchmarkHash32RuleStore(b *testing.B) {
@@ -18,6 +19,11 @@ func TestHash32SqlRuleStore(t *testing.T) {
 			delegate: &sqlStore{},
 		}
 	}, t)
+	testStoreUpdates(updateRules, func() RuleStore {
+		return &hashStore32{
+			delegate: &sqlStore{},
+		}
+	}, t)
 }
 
 func BenchmarkHash32SqlRuleStore(b *testing.B) {
@@ -6,6 +6,7 @@ import (
 
 func TestHashRuleStore(t *testing.T) {
 	testStore(defaultRuleData, func() RuleStore { return &hashStore{} }, t)
+	testStoreUpdates(updateRules, func() RuleStore { return &hashStore{} }, t)
 }
 
 func BenchmarkHashRuleStore(b *testing.B) {
@@ -18,6 +19,11 @@ func TestHashSqlRuleStore(t *testing.T) {
 			delegate: &sqlStore{},
 		}
 	}, t)
+	testStoreUpdates(updateRules, func() RuleStore {
+		return &hashStore{
+			delegate: &sqlStore{},
+		}
+	}, t)
 }
 
 func BenchmarkHashSqlRuleStore(b *testing.B) {
@@ -41,11 +41,36 @@ func (store *memoryStore) Finalize(sessionRoot string, lists []*config.GudgeonLi
 	}
 }
 
+// the index the rule is (or would be) at in the sorted rules
+func (store *memoryStore) ruleIndex(rules []string, rule string) int {
+	return sort.Search(len(rules), func(i int) bool {
+		return sortfold.CompareFold(rules[i], rule) >= 0
+	})
+}
+
+func (store *memoryStore) Add(list *config.GudgeonList, rule string) {
+	rule = strings.ToLower(rule)
+	rules := store.rules[list.CanonicalName()]
+	idx := store.ruleIndex(rules, rule)
+	if idx < len(rules) && rules[idx] == rule {
+		return
+	}
+	rules = append(rules, "")
+	copy(rules[idx+1:], rules[idx:])
+	rules[idx] = rule
+	store.rules[list.CanonicalName()] = rules
+}
+
+func (store *memoryStore) Remove(list *config.GudgeonList, rule string) {
+	rules := store.rules[list.CanonicalName()]
+	if idx := store.ruleIndex(rules, rule); idx < len(rules) && strings.EqualFold(rules[idx], rule) {
+		store.rules[list.CanonicalName()] = append(rules[:idx], rules[idx+1:]...)
+	}
+}
+
 func (store *memoryStore) foundInList(rules []string, domain string) (bool, string) {
 	// search for the domain
-	idx := sort.Search(len(rules), func(i int) bool {
-		return sortfold.CompareFold(rules[i], domain) >= 0
-	})
+	idx := store.ruleIndex(rules, domain)
 
 	// check that search found what we expected and return true if found
 	if idx < len(rules) && strings.EqualFold(rules[idx], domain) {
@@ -97,6 +122,23 @@ func (store *memoryStore) FindMatch(lists []*config.GudgeonList, domain string)
 	return MatchNone, nil, ""
 }
 
+func (store *memoryStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	matches := make([]*RuleMatch, 0)
+	domains := util.DomainList(domain)
+	for _, list := range lists {
+		rules, found := store.rules[list.CanonicalName()]
+		if !found {
+			continue
+		}
+		for _, d := range domains {
+			if found, ruleString := store.foundInList(rules, d); found {
+				matches = append(matches, newRuleMatch(list, ruleString))
+			}
+		}
+	}
+	return matches
+}
+
 func (store *memoryStore) Close() {
 	// default no-op
 }
@@ -6,6 +6,7 @@ import (
 
 func TestMemoryRuleStore(t *testing.T) {
 	testStore(defaultRuleData, func() RuleStore { return &memoryStore{} }, t)
+	testStoreUpdates(updateRules, func() RuleStore { return &memoryStore{} }, t)
 }
 
 func BenchmarkMemoryRuleStore(b *testing.B) {
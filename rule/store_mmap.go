@@ -0,0 +1,376 @@
+package rule
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/twmb/murmur3"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// the hash files are kept in this directory of the session root
+const mmapDirName = "mmap"
+
+// the sorted hashes of a list in a file that is mapped into memory so that (other than the pages read by recent
+// lookups) the hashes are on disk, each hash is 8 little-endian bytes (the same as the hash store's snapshots)
+type mappedHashes struct {
+	data []byte
+	// false when the hashes could not be mapped and are kept in memory instead
+	mapped bool
+}
+
+func (hashes *mappedHashes) len() int {
+	return len(hashes.data) / 8
+}
+
+func (hashes *mappedHashes) at(idx int) uint64 {
+	return binary.LittleEndian.Uint64(hashes.data[idx*8:])
+}
+
+func (hashes *mappedHashes) contains(hash uint64) bool {
+	count := hashes.len()
+	idx := sort.Search(count, func(i int) bool {
+		return hashes.at(i) >= hash
+	})
+	return idx < count && hashes.at(idx) == hash
+}
+
+func (hashes *mappedHashes) unmap() {
+	if hashes.mapped && len(hashes.data) > 0 {
+		syscall.Munmap(hashes.data)
+	}
+	hashes.data = nil
+}
+
+// map the hash file into memory, a file without any hashes doesn't need to be mapped
+func mapHashFile(filePath string) (*mappedHashes, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size()%8 != 0 {
+		return nil, fmt.Errorf("Hash file '%s' is not a list of hashes", filePath)
+	}
+	if info.Size() == 0 {
+		return &mappedHashes{}, nil
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	// lookups jump around the file so reading ahead only fills memory
+	syscall.Madvise(data, syscall.MADV_RANDOM)
+
+	return &mappedHashes{data: data, mapped: true}, nil
+}
+
+// write the sorted hashes in the hash file format
+func writeHashes(writer io.Writer, hashes []uint64) error {
+	buffer := make([]byte, 8)
+	for _, hash := range hashes {
+		binary.LittleEndian.PutUint64(buffer, hash)
+		if _, err := writer.Write(buffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type mmapStore struct {
+	// the hashes of each list while it is loaded, they are written to the hash files and dropped when the store is
+	// finalized
+	loading map[string][]uint64
+	// the hash files of each list once the store is finalized
+	hashes map[string]*mappedHashes
+
+	// the hash files are read only so rules that are added or removed after the store is finalized are kept (by list)
+	// in memory
+	added   map[string]map[uint64]bool
+	removed map[string]map[uint64]bool
+
+	delegate RuleStore
+}
+
+func (store *mmapStore) Init(sessionRoot string, config *config.GudgeonConfig, lists []*config.GudgeonList) {
+	store.loading = make(map[string][]uint64)
+	store.hashes = make(map[string]*mappedHashes)
+	store.added = make(map[string]map[uint64]bool)
+	store.removed = make(map[string]map[uint64]bool)
+	for _, list := range lists {
+		if _, found := store.loading[list.CanonicalName()]; !found {
+			startingArrayLength := uint(0)
+			if config != nil {
+				startingArrayLength, _ = util.LineCount(config.PathToList(list))
+			}
+			store.loading[list.CanonicalName()] = make([]uint64, 0, startingArrayLength)
+		}
+	}
+
+	if store.delegate != nil {
+		store.delegate.Init(sessionRoot, config, lists)
+	}
+}
+
+func (store *mmapStore) Load(list *config.GudgeonList, rule string) {
+	store.loading[list.CanonicalName()] = append(store.loading[list.CanonicalName()], murmur3.StringSum64(strings.ToLower(rule)))
+
+	if store.delegate != nil {
+		store.delegate.Load(list, rule)
+	}
+}
+
+func (store *mmapStore) Finalize(sessionRoot string, lists []*config.GudgeonList) {
+	hashDir := path.Join(sessionRoot, mmapDirName)
+	if _, err := os.Stat(hashDir); os.IsNotExist(err) {
+		os.MkdirAll(hashDir, os.ModePerm)
+	}
+
+	for _, list := range lists {
+		hashes, found := store.loading[list.CanonicalName()]
+		if !found {
+			continue
+		}
+		delete(store.loading, list.CanonicalName())
+
+		// sort and drop duplicates so that each hash is in the file once
+		sort.Slice(hashes, func(i, j int) bool {
+			return hashes[i] < hashes[j]
+		})
+		unique := hashes[:0]
+		for idx, hash := range hashes {
+			if idx == 0 || hash != hashes[idx-1] {
+				unique = append(unique, hash)
+			}
+		}
+
+		hashFile := path.Join(hashDir, list.ShortName()+".hash64")
+		err := writeSnapshotFile(hashFile, func(writer io.Writer) error {
+			return writeHashes(writer, unique)
+		})
+		var mapped *mappedHashes
+		if err == nil {
+			mapped, err = mapHashFile(hashFile)
+		}
+		if err != nil {
+			log.Warnf("Could not map the hashes of list '%s', keeping them in memory: %s", list.CanonicalName(), err)
+			mapped = &mappedHashes{data: make([]byte, 8*len(unique))}
+			for idx, hash := range unique {
+				binary.LittleEndian.PutUint64(mapped.data[idx*8:], hash)
+			}
+		}
+		store.hashes[list.CanonicalName()] = mapped
+	}
+
+	if store.delegate != nil {
+		store.delegate.Finalize(sessionRoot, lists)
+	}
+}
+
+// update the in-memory changes of the list so that the hash is (or isn't) in it
+func (store *mmapStore) update(list *config.GudgeonList, hash uint64, member bool) {
+	name := list.CanonicalName()
+	if store.added[name] == nil {
+		store.added[name] = make(map[uint64]bool)
+	}
+	if store.removed[name] == nil {
+		store.removed[name] = make(map[uint64]bool)
+	}
+
+	inFile := false
+	if hashes, found := store.hashes[name]; found {
+		inFile = hashes.contains(hash)
+	}
+	if member {
+		delete(store.removed[name], hash)
+		if !inFile {
+			store.added[name][hash] = true
+		}
+	} else {
+		delete(store.added[name], hash)
+		if inFile {
+			store.removed[name][hash] = true
+		}
+	}
+}
+
+func (store *mmapStore) Add(list *config.GudgeonList, rule string) {
+	store.update(list, murmur3.StringSum64(strings.ToLower(rule)), true)
+
+	if store.delegate != nil {
+		store.delegate.Add(list, rule)
+	}
+}
+
+func (store *mmapStore) Remove(list *config.GudgeonList, rule string) {
+	store.update(list, murmur3.StringSum64(strings.ToLower(rule)), false)
+
+	if store.delegate != nil {
+		store.delegate.Remove(list, rule)
+	}
+}
+
+func (store *mmapStore) readSnapshot(prefix string, list *config.GudgeonList) snapshotCommit {
+	delegate, ok := store.delegate.(snapshotStore)
+	if store.delegate != nil && !ok {
+		return nil
+	}
+
+	// the snapshot is in the hash file format so it is mapped in place, a snapshot that is replaced or removed while it
+	// is mapped stays readable until it is unmapped
+	mapped, err := mapHashFile(prefix + ".hash64")
+	if err != nil {
+		return nil
+	}
+
+	var delegateCommit snapshotCommit
+	if delegate != nil {
+		if delegateCommit = delegate.readSnapshot(prefix, list); delegateCommit == nil {
+			mapped.unmap()
+			return nil
+		}
+	}
+	return func(load bool) {
+		if delegateCommit != nil {
+			delegateCommit(load)
+		}
+		if !load {
+			mapped.unmap()
+			return
+		}
+		delete(store.loading, list.CanonicalName())
+		store.hashes[list.CanonicalName()] = mapped
+	}
+}
+
+func (store *mmapStore) saveSnapshot(prefix string, list *config.GudgeonList) error {
+	mapped, found := store.hashes[list.CanonicalName()]
+	if !found {
+		return nil
+	}
+	err := writeSnapshotFile(prefix+".hash64", func(writer io.Writer) error {
+		// the hash file is written as it is unless rules were added or removed since it was written
+		if len(store.added[list.CanonicalName()]) == 0 && len(store.removed[list.CanonicalName()]) == 0 {
+			_, err := writer.Write(mapped.data)
+			return err
+		}
+		hashes := make([]uint64, 0, mapped.len()+len(store.added[list.CanonicalName()]))
+		for idx := 0; idx < mapped.len(); idx++ {
+			if !store.removed[list.CanonicalName()][mapped.at(idx)] {
+				hashes = append(hashes, mapped.at(idx))
+			}
+		}
+		for hash := range store.added[list.CanonicalName()] {
+			hashes = append(hashes, hash)
+		}
+		sort.Slice(hashes, func(i, j int) bool {
+			return hashes[i] < hashes[j]
+		})
+		return writeHashes(writer, hashes)
+	})
+	if err != nil {
+		return err
+	}
+
+	if delegate, ok := store.delegate.(snapshotStore); ok {
+		return delegate.saveSnapshot(prefix, list)
+	}
+	return nil
+}
+
+func (store *mmapStore) foundInList(list *config.GudgeonList, hash uint64) bool {
+	if store.added[list.CanonicalName()][hash] {
+		return true
+	}
+	hashes, found := store.hashes[list.CanonicalName()]
+	return found && hashes.contains(hash) && !store.removed[list.CanonicalName()][hash]
+}
+
+func (store *mmapStore) FindMatch(lists []*config.GudgeonList, domain string) (Match, *config.GudgeonList, string) {
+
+	// allow and block split
+	allowLists := make([]*config.GudgeonList, 0)
+	blockLists := make([]*config.GudgeonList, 0)
+	for _, l := range lists {
+		if ParseType(l.Type) == ALLOW {
+			allowLists = append(allowLists, l)
+		} else {
+			blockLists = append(blockLists, l)
+		}
+	}
+
+	// get domain hashes
+	domains := util.DomainList(domain)
+	domainHashes := make([]uint64, len(domains))
+	for idx, d := range domains {
+		domainHashes[idx] = murmur3.StringSum64(strings.ToLower(d))
+	}
+
+	for _, list := range allowLists {
+		for _, d := range domainHashes {
+			if store.foundInList(list, d) {
+				if store.delegate != nil {
+					return store.delegate.FindMatch([]*config.GudgeonList{list}, domain)
+				}
+				return MatchAllow, list, fmt.Sprintf("%d", d)
+			}
+		}
+	}
+
+	for _, list := range blockLists {
+		for _, d := range domainHashes {
+			if store.foundInList(list, d) {
+				if store.delegate != nil {
+					return store.delegate.FindMatch([]*config.GudgeonList{list}, domain)
+				}
+				return MatchBlock, list, fmt.Sprintf("%d", d)
+			}
+		}
+	}
+
+	return MatchNone, nil, ""
+}
+
+func (store *mmapStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	// the delegate has the rule text
+	if store.delegate != nil {
+		return store.delegate.FindAllMatches(lists, domain)
+	}
+
+	matches := make([]*RuleMatch, 0)
+	domains := util.DomainList(domain)
+	for _, list := range lists {
+		for _, d := range domains {
+			if store.foundInList(list, murmur3.StringSum64(strings.ToLower(d))) {
+				matches = append(matches, newRuleMatch(list, d))
+			}
+		}
+	}
+	return matches
+}
+
+func (store *mmapStore) Close() {
+	for _, hashes := range store.hashes {
+		hashes.unmap()
+	}
+	store.hashes = nil
+
+	if store.delegate != nil {
+		store.delegate.Close()
+	}
+}
@@ -0,0 +1,114 @@
+package rule
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestMmapRuleStore(t *testing.T) {
+	testStore(defaultRuleData, func() RuleStore { return &mmapStore{} }, t)
+	testStoreUpdates(updateRules, func() RuleStore { return &mmapStore{} }, t)
+}
+
+func TestMmapSqlRuleStore(t *testing.T) {
+	testStore(defaultRuleData, func() RuleStore { return &mmapStore{delegate: &sqlStore{}} }, t)
+	testStoreUpdates(updateRules, func() RuleStore { return &mmapStore{delegate: &sqlStore{}} }, t)
+}
+
+func TestMmapRuleStoreMapsHashFiles(t *testing.T) {
+	tmpDir := testutil.TempDir()
+	defer os.RemoveAll(tmpDir)
+
+	list := &config.GudgeonList{Name: "Block", Type: "block"}
+	empty := &config.GudgeonList{Name: "Empty", Type: "block"}
+	lists := []*config.GudgeonList{list, empty}
+
+	store := &mmapStore{}
+	store.Init(tmpDir, nil, lists)
+	store.Load(list, "ads.com")
+	store.Load(list, "tracker.com")
+	store.Load(list, "ads.com")
+	store.Finalize(tmpDir, lists)
+	defer store.Close()
+
+	// the hashes are only in the file and each hash is in it once
+	if len(store.loading) != 0 {
+		t.Errorf("Expected the loaded hashes to be dropped once they are written")
+	}
+	info, err := os.Stat(path.Join(tmpDir, mmapDirName, list.ShortName()+".hash64"))
+	if err != nil || info.Size() != 16 {
+		t.Errorf("Expected a hash file with two hashes")
+	}
+	if !store.hashes[list.CanonicalName()].mapped {
+		t.Errorf("Expected the hash file to be mapped")
+	}
+
+	expect := func(domain string, match Match) {
+		if found, _, _ := store.FindMatch(lists, domain); found != match {
+			t.Errorf("Expected '%s' to have match %d but got %d", domain, match, found)
+		}
+	}
+	expect("www.ads.com", MatchBlock)
+	expect("tracker.com", MatchBlock)
+	expect("other.com", MatchNone)
+
+	// changes after the file is written are kept in memory
+	store.Remove(list, "ads.com")
+	store.Add(empty, "other.com")
+	expect("www.ads.com", MatchNone)
+	expect("other.com", MatchBlock)
+	store.Add(list, "ads.com")
+	expect("www.ads.com", MatchBlock)
+	if len(store.added[list.CanonicalName()]) != 0 || len(store.removed[list.CanonicalName()]) != 0 {
+		t.Errorf("Expected a rule that was removed and added again to only be in the hash file")
+	}
+}
+
+func TestMmapRuleStoreCloseUnmapsHashFiles(t *testing.T) {
+	tmpDir := testutil.TempDir()
+	defer os.RemoveAll(tmpDir)
+
+	conf := &config.GudgeonConfig{Home: tmpDir, Storage: &config.GudgeonStorage{RuleStorage: "mmap"}}
+	if err := ioutil.WriteFile(path.Join(tmpDir, "ads.list"), []byte("ads.com\ntracker.com\n"), 0644); err != nil {
+		t.Fatalf("Could not write list: %s", err)
+	}
+	conf.Lists = append(conf.Lists, &config.GudgeonList{Name: "ads", Source: path.Join(tmpDir, "ads.list")})
+
+	// the mappings of the hash files in the store root
+	storeRoot := path.Join(tmpDir, "store")
+	mappedFiles := func() int {
+		maps, err := ioutil.ReadFile("/proc/self/maps")
+		if err != nil {
+			t.Skipf("Could not read process mappings: %s", err)
+		}
+		return strings.Count(string(maps), path.Join(storeRoot, mmapDirName))
+	}
+
+	store, _, _ := CreateStore(storeRoot, conf)
+	if match, _, _ := store.FindMatch(conf.Lists, "ads.com"); match != MatchBlock {
+		t.Errorf("Expected the store to block ads.com")
+	}
+	mapped := store.(*complexStore).backingStore.(*mmapStore).hashes[conf.Lists[0].CanonicalName()]
+	if mapped == nil || !mapped.mapped || mappedFiles() == 0 {
+		t.Errorf("Expected the hash file to be mapped")
+	}
+
+	store.Close()
+	if mapped.data != nil || mappedFiles() != 0 {
+		t.Errorf("Expected closing the store to unmap the hash files")
+	}
+}
+
+func BenchmarkMmapRuleStore(b *testing.B) {
+	benchNonComplexStore(func() RuleStore { return &mmapStore{} }, b)
+}
+
+func BenchmarkMmapSqlRuleStore(b *testing.B) {
+	benchNonComplexStore(func() RuleStore { return &mmapStore{delegate: &sqlStore{}} }, b)
+}
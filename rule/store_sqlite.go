@@ -1,6 +1,7 @@
 package rule
 
 import (
+	"context"
 	"database/sql"
 	//"fmt"
 	"os"
@@ -22,6 +23,9 @@ type sqlStore struct {
 	db *sql.DB
 
 	tx *sql.Tx
+
+	// the snapshot files to copy rules from (by list short name), they are copied when the store is finalized
+	snapshots map[string]string
 }
 
 func (store *sqlStore) Init(sessionRoot string, config *config.GudgeonConfig, lists []*config.GudgeonList) {
@@ -84,6 +88,11 @@ func (store *sqlStore) Finalize(sessionRoot string, lists []*config.GudgeonList)
 		store.tx = nil
 	}
 
+	// copy the rules of lists from their snapshots
+	if len(store.snapshots) > 0 {
+		store.copySnapshots()
+	}
+
 	tx, err := store.db.Begin()
 	if err != nil {
 		log.Errorf("Could not start finalization transaction: %s", err)
@@ -107,10 +116,10 @@ func (store *sqlStore) Finalize(sessionRoot string, lists []*config.GudgeonList)
 		}
 	}
 
-	// close and re-open db
+	// close and re-open db (not read-only so that single rules can still be added and removed)
 	store.db.Close()
 	sessionDb := path.Join(sessionRoot, sqlDbName)
-	db, err := sql.Open("sqlite3", sessionDb+"?mode=ro&cache=shared")
+	db, err := sql.Open("sqlite3", sessionDb+"?cache=shared")
 	if err != nil {
 		log.Errorf("Rule storage: %s", err)
 	}
@@ -118,6 +127,102 @@ func (store *sqlStore) Finalize(sessionRoot string, lists []*config.GudgeonList)
 	store.db = db
 }
 
+func (store *sqlStore) Add(list *config.GudgeonList, rule string) {
+	if store.db == nil {
+		return
+	}
+
+	_, err := store.db.Exec("INSERT INTO lists (ShortName) SELECT ? WHERE NOT EXISTS (SELECT 1 FROM lists WHERE ShortName = ?)", list.ShortName(), list.ShortName())
+	if err != nil {
+		log.Errorf("Inserting list: %s", err)
+		return
+	}
+	_, err = store.db.Exec("INSERT OR IGNORE INTO rules (ListRowId, Rule) VALUES ((SELECT Id FROM lists WHERE ShortName = ? LIMIT 1), ?)", list.ShortName(), rule)
+	if err != nil {
+		log.Errorf("Could not add rule to rules store: %s", err)
+	}
+}
+
+func (store *sqlStore) Remove(list *config.GudgeonList, rule string) {
+	if store.db == nil {
+		return
+	}
+
+	_, err := store.db.Exec("DELETE FROM rules WHERE ListRowId = (SELECT Id FROM lists WHERE ShortName = ? LIMIT 1) AND Rule = ?", list.ShortName(), rule)
+	if err != nil {
+		log.Errorf("Could not remove rule from rules store: %s", err)
+	}
+}
+
+// a snapshot is a separate database with the rules of one list, it is attached to copy rules in and out
+func (store *sqlStore) readSnapshot(prefix string, list *config.GudgeonList) snapshotCommit {
+	if !snapshotFilesExist(prefix + ".db") {
+		return nil
+	}
+	return func(load bool) {
+		if !load {
+			return
+		}
+		if store.snapshots == nil {
+			store.snapshots = make(map[string]string)
+		}
+		store.snapshots[list.ShortName()] = prefix + ".db"
+	}
+}
+
+// copy the rules from each snapshot into the rules of the list
+func (store *sqlStore) copySnapshots() {
+	// attached databases belong to a single connection
+	conn, err := store.db.Conn(context.Background())
+	if err != nil {
+		log.Errorf("Could not copy rule snapshots: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	for shortName, snapshot := range store.snapshots {
+		if _, err := conn.ExecContext(context.Background(), "ATTACH DATABASE ? AS snapshot", snapshot); err != nil {
+			log.Errorf("Could not open rule snapshot: %s", err)
+			continue
+		}
+		_, err := conn.ExecContext(context.Background(), "INSERT OR IGNORE INTO rules_initial (ListRowId, Rule) SELECT (SELECT Id FROM lists WHERE ShortName = ? LIMIT 1), Rule FROM snapshot.rules", shortName)
+		if err != nil {
+			log.Errorf("Could not copy rules from snapshot: %s", err)
+		}
+		conn.ExecContext(context.Background(), "DETACH DATABASE snapshot")
+	}
+	store.snapshots = nil
+}
+
+func (store *sqlStore) saveSnapshot(prefix string, list *config.GudgeonList) error {
+	if store.db == nil {
+		return nil
+	}
+
+	conn, err := store.db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	snapshot := prefix + ".db"
+	os.Remove(snapshot + ".tmp")
+	if _, err := conn.ExecContext(context.Background(), "ATTACH DATABASE ? AS snapshot", snapshot+".tmp"); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(context.Background(), "CREATE TABLE snapshot.rules (Rule TEXT PRIMARY KEY) WITHOUT ROWID")
+	if err == nil {
+		_, err = conn.ExecContext(context.Background(), "INSERT INTO snapshot.rules (Rule) SELECT r.Rule FROM rules r LEFT JOIN lists l ON r.ListRowId = l.Id WHERE l.ShortName = ?", list.ShortName())
+	}
+	conn.ExecContext(context.Background(), "DETACH DATABASE snapshot")
+	if err != nil {
+		os.Remove(snapshot + ".tmp")
+		return err
+	}
+
+	return os.Rename(snapshot+".tmp", snapshot)
+}
+
 func (store *sqlStore) foundInLists(lists []*config.GudgeonList, domains []string) (bool, string, string) {
 	// with no lists and no domain we can't test found function
 	if len(lists) < 1 || len(domains) < 1 {
@@ -209,8 +314,60 @@ func (store *sqlStore) FindMatch(lists []*config.GudgeonList, domain string) (Ma
 	return MatchNone, nil, ""
 }
 
+func (store *sqlStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	matches := make([]*RuleMatch, 0)
+	domains := util.DomainList(domain)
+	if store.db == nil || len(lists) < 1 || len(domains) < 1 {
+		return matches
+	}
+
+	vars := make([]interface{}, 0, len(lists)+len(domains))
+	for _, list := range lists {
+		vars = append(vars, list.ShortName())
+	}
+	for _, dm := range domains {
+		vars = append(vars, dm)
+	}
+	stmt := "SELECT l.ShortName, r.Rule FROM rules R LEFT JOIN lists L ON R.ListRowId = L.rowid WHERE l.ShortName in (?" + strings.Repeat(", ?", len(lists)-1) + ") AND r.Rule in (?" + strings.Repeat(", ?", len(domains)-1) + ");"
+	rows, err := store.db.Query(stmt, vars...)
+	if err != nil {
+		log.Errorf("Executing rule storage query: %s", err)
+		return matches
+	}
+	defer rows.Close()
+
+	// the rules found for each list, put in list order below
+	found := make(map[string]bool)
+	var list string
+	var rule string
+	for rows.Next() {
+		if err := rows.Scan(&list, &rule); err != nil {
+			log.Errorf("Rule row scan: %s", err)
+			continue
+		}
+		found[list+"\n"+rule] = true
+	}
+
+	for _, l := range lists {
+		for _, d := range domains {
+			if found[l.ShortName()+"\n"+d] {
+				matches = append(matches, newRuleMatch(l, d))
+			}
+		}
+	}
+
+	return matches
+}
+
+// rules are added and removed by their text
+func (store *sqlStore) updatesInPlace() bool {
+	return true
+}
+
 func (store *sqlStore) Close() {
 	if store.db != nil {
 		store.db.Close()
+		// a closed store finds nothing instead of querying a closed db
+		store.db = nil
 	}
 }
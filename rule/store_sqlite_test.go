@@ -9,6 +9,7 @@ import (
 func TestSqliteRuleStore(t *testing.T) {
 	defer leaktest.Check(t)()
 	testStore(defaultRuleData, func() RuleStore { return &sqlStore{} }, t)
+	testStoreUpdates(updateRules, func() RuleStore { return &sqlStore{} }, t)
 }
 
 func BenchmarkSqliteRuleStore(b *testing.B) {
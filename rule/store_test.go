@@ -79,12 +79,65 @@ func testStore(ruleData []ruleList, createRuleStore ruleStoreCreator, t *testing
 			if MatchNone != result {
 				t.Errorf("Rules of type %d in list %s expected to not match '%s' but did", data.ruleType, lists[0].CanonicalName(), expectedNoMatch)
 			}
+			if matches := store.FindAllMatches(lists, expectedNoMatch); len(matches) != 0 {
+				t.Errorf("Rules of type %d in list %s expected to find no matches for '%s' but found %d", data.ruleType, lists[0].CanonicalName(), expectedNoMatch, len(matches))
+			}
+		}
+
+		// every match is found with the type of the list
+		for _, expectedMatch := range append(append([]string{}, data.blocked...), data.allowed...) {
+			matches := store.FindAllMatches(lists, expectedMatch)
+			if len(matches) != 1 || matches[0].List != lists[0] || (matches[0].Match == MatchAllow) != (data.ruleType == ALLOW) {
+				t.Errorf("Rules of type %d in list %s expected to find one match for '%s' but found %d", data.ruleType, lists[0].CanonicalName(), expectedMatch, len(matches))
+			}
 		}
 
 		store.Close()
 	}
 }
 
+// the rules used to check adding and removing rules, each matches the domain with the same index in updateDomains
+var (
+	updateRules        = []string{"loaded.com", "kept.com", "added.com", "other.com"}
+	complexUpdateRules = []string{"*loaded.com", "*kept.com", "/^added\\.com$/", "*other.com"}
+	updateDomains      = []string{"loaded.com", "kept.com", "added.com", "other.com"}
+)
+
+// rules added or removed after the store is finalized should be found (or not) right away
+func testStoreUpdates(rules []string, createRuleStore ruleStoreCreator, t *testing.T) {
+	tmpDir := testutil.TempDir()
+	defer os.RemoveAll(tmpDir)
+
+	store := createRuleStore()
+	defer store.Close()
+
+	lists := []*config.GudgeonList{&config.GudgeonList{Name: "Loaded", Type: "block"}}
+	added := &config.GudgeonList{Name: "Added", Type: "allow"}
+	store.Init(tmpDir, nil, lists)
+	store.Load(lists[0], rules[0])
+	store.Load(lists[0], rules[1])
+	store.Finalize(tmpDir, lists)
+
+	check := func(step string, checkLists []*config.GudgeonList, domain string, expected Match) {
+		if result, _, _ := store.FindMatch(checkLists, domain); result != expected {
+			t.Errorf("After %s expected '%s' to have match %d but got %d", step, domain, expected, result)
+		}
+	}
+
+	store.Add(lists[0], rules[2])
+	store.Add(added, rules[3])
+	store.Remove(lists[0], rules[0])
+	check("update", lists, updateDomains[0], MatchNone)
+	check("update", lists, updateDomains[1], MatchBlock)
+	check("update", lists, updateDomains[2], MatchBlock)
+	check("update", []*config.GudgeonList{added}, updateDomains[3], MatchAllow)
+
+	store.Add(lists[0], rules[0])
+	store.Remove(added, rules[3])
+	check("second update", lists, updateDomains[0], MatchBlock)
+	check("second update", []*config.GudgeonList{added}, updateDomains[3], MatchNone)
+}
+
 // for benchmarking non-complex implementations
 func benchNonComplexStore(createRuleStore ruleStoreCreator, b *testing.B) {
 	tmpDir := testutil.TempDir()
@@ -146,6 +199,7 @@ func TestComplexRuleStore(t *testing.T) {
 
 	// with creator function
 	testStore(ruleData, func() RuleStore { return &complexStore{} }, t)
+	testStoreUpdates(complexUpdateRules, func() RuleStore { return &complexStore{} }, t)
 }
 
 func printMemUsage(msg string, b *testing.B) {
@@ -0,0 +1,241 @@
+package rule
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/twmb/murmur3"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+// a suffix trie of domain labels (from the top level domain down) that is shared by every list, each node that ends a
+// rule has the set of lists the rule is in so that a domain is matched against all of the lists in one walk
+type trieStore struct {
+	// the child of a node for a label (see edgeKey), the root is node 0
+	edges map[uint64]uint32
+	// the list set of each node by node id
+	members []uint32
+
+	// the position of each list in the list sets
+	listIndex map[string]uint
+
+	// nodes with the same lists (usually just one) share a list set, set 0 is empty
+	sets     []trieSet
+	setIndex map[string]uint32
+}
+
+// edges are keyed by a hash of the label seeded with the parent node instead of the label itself, this keeps the
+// labels out of memory but (like the hash stores) leaves a very small chance of a false match
+func edgeKey(parent uint32, label string) uint64 {
+	return murmur3.SeedStringSum64(uint64(parent), label)
+}
+
+// a bitset of list positions
+type trieSet []uint64
+
+func (set trieSet) has(idx uint) bool {
+	word := idx / 64
+	return word < uint(len(set)) && set[word]&(1<<(idx%64)) != 0
+}
+
+// a copy of the set with the list added or removed, trailing empty words are trimmed so equal sets have the same key
+func (set trieSet) with(idx uint, member bool) trieSet {
+	word := idx / 64
+	length := uint(len(set))
+	if word >= length {
+		length = word + 1
+	}
+	updated := make(trieSet, length)
+	copy(updated, set)
+	if member {
+		updated[word] |= 1 << (idx % 64)
+	} else {
+		updated[word] &^= 1 << (idx % 64)
+	}
+	for len(updated) > 0 && updated[len(updated)-1] == 0 {
+		updated = updated[:len(updated)-1]
+	}
+	return updated
+}
+
+func (set trieSet) key() string {
+	buffer := make([]byte, 8*len(set))
+	for idx, word := range set {
+		binary.LittleEndian.PutUint64(buffer[idx*8:], word)
+	}
+	return string(buffer)
+}
+
+func (store *trieStore) Init(sessionRoot string, config *config.GudgeonConfig, lists []*config.GudgeonList) {
+	store.edges = make(map[uint64]uint32)
+	store.members = []uint32{0}
+	store.listIndex = make(map[string]uint)
+	store.sets = []trieSet{{}}
+	store.setIndex = map[string]uint32{"": 0}
+
+	for _, list := range lists {
+		store.listPosition(list)
+	}
+}
+
+// the position of the list in the list sets, lists that were not given to Init are added
+func (store *trieStore) listPosition(list *config.GudgeonList) uint {
+	idx, found := store.listIndex[list.CanonicalName()]
+	if !found {
+		idx = uint(len(store.listIndex))
+		store.listIndex[list.CanonicalName()] = idx
+	}
+	return idx
+}
+
+// the id of the shared copy of the list set
+func (store *trieStore) setID(set trieSet) uint32 {
+	key := set.key()
+	id, found := store.setIndex[key]
+	if !found {
+		id = uint32(len(store.sets))
+		store.sets = append(store.sets, set)
+		store.setIndex[key] = id
+	}
+	return id
+}
+
+// the node at the end of the rule's labels, when create is true the missing nodes are added
+func (store *trieStore) node(rule string, create bool) (uint32, bool) {
+	rule = strings.ToLower(strings.TrimSpace(rule))
+	if "" == rule {
+		return 0, false
+	}
+
+	node := uint32(0)
+	labels := strings.Split(rule, ".")
+	for idx := len(labels) - 1; idx >= 0; idx-- {
+		edge := edgeKey(node, labels[idx])
+		child, found := store.edges[edge]
+		if !found {
+			if !create {
+				return 0, false
+			}
+			child = uint32(len(store.members))
+			store.members = append(store.members, 0)
+			store.edges[edge] = child
+		}
+		node = child
+	}
+
+	return node, true
+}
+
+// put the rule in (or take it out of) the list
+func (store *trieStore) update(list *config.GudgeonList, rule string, member bool) {
+	node, found := store.node(rule, member)
+	if !found {
+		return
+	}
+	store.members[node] = store.setID(store.sets[store.members[node]].with(store.listPosition(list), member))
+}
+
+func (store *trieStore) Load(list *config.GudgeonList, rule string) {
+	store.update(list, rule, true)
+}
+
+func (store *trieStore) Finalize(sessionRoot string, lists []*config.GudgeonList) {
+	// the trie is ready as it is loaded
+}
+
+func (store *trieStore) Add(list *config.GudgeonList, rule string) {
+	store.update(list, rule, true)
+}
+
+func (store *trieStore) Remove(list *config.GudgeonList, rule string) {
+	// nodes are left in place, without any lists, for the next rule that uses them
+	store.update(list, rule, false)
+}
+
+// the first of the lists of the given type with a rule that matched, checking the most specific rule first
+func (store *trieStore) foundInLists(lists []*config.GudgeonList, listType uint8, labels []string, matched []uint32) (*config.GudgeonList, string) {
+	for _, list := range lists {
+		if (ParseType(list.Type) == ALLOW) != (listType == ALLOW) {
+			continue
+		}
+		idx, found := store.listIndex[list.CanonicalName()]
+		if !found {
+			continue
+		}
+		for depth := len(matched) - 1; depth >= 0; depth-- {
+			if store.sets[matched[depth]].has(idx) {
+				return list, strings.Join(labels[len(labels)-1-depth:], ".")
+			}
+		}
+	}
+	return nil, ""
+}
+
+// walk down the trie once to find the list sets of the rules that match the domain's labels at each depth
+func (store *trieStore) walk(labels []string, matched []uint32) []uint32 {
+	node := uint32(0)
+	for idx := len(labels) - 1; idx >= 0; idx-- {
+		child, found := store.edges[edgeKey(node, labels[idx])]
+		if !found {
+			break
+		}
+		node = child
+		// like the other stores a top level domain only matches itself
+		if idx == len(labels)-1 && len(labels) > 1 {
+			matched = append(matched, 0)
+		} else {
+			matched = append(matched, store.members[node])
+		}
+	}
+	return matched
+}
+
+func (store *trieStore) FindMatch(lists []*config.GudgeonList, domain string) (Match, *config.GudgeonList, string) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if "" == domain {
+		return MatchNone, nil, ""
+	}
+	labels := strings.Split(domain, ".")
+	var buffer [16]uint32
+	matched := store.walk(labels, buffer[:0])
+
+	if list, ruleText := store.foundInLists(lists, ALLOW, labels, matched); list != nil {
+		return MatchAllow, list, ruleText
+	}
+	if list, ruleText := store.foundInLists(lists, BLOCK, labels, matched); list != nil {
+		return MatchBlock, list, ruleText
+	}
+
+	return MatchNone, nil, ""
+}
+
+func (store *trieStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	matches := make([]*RuleMatch, 0)
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if "" == domain {
+		return matches
+	}
+	labels := strings.Split(domain, ".")
+	matched := store.walk(labels, nil)
+
+	for _, list := range lists {
+		idx, found := store.listIndex[list.CanonicalName()]
+		if !found {
+			continue
+		}
+		for depth := len(matched) - 1; depth >= 0; depth-- {
+			if store.sets[matched[depth]].has(idx) {
+				matches = append(matches, newRuleMatch(list, strings.Join(labels[len(labels)-1-depth:], ".")))
+			}
+		}
+	}
+	return matches
+}
+
+func (store *trieStore) Close() {
+	store.edges = nil
+	store.members = nil
+	store.sets = nil
+	store.setIndex = nil
+}
@@ -0,0 +1,60 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+func TestTrieRuleStore(t *testing.T) {
+	testStore(defaultRuleData, func() RuleStore { return &trieStore{} }, t)
+	testStoreUpdates(updateRules, func() RuleStore { return &trieStore{} }, t)
+}
+
+func TestTrieRuleStoreSharedNodes(t *testing.T) {
+	store := &trieStore{}
+	block := &config.GudgeonList{Name: "Block", Type: "block"}
+	other := &config.GudgeonList{Name: "Other", Type: "block"}
+	allow := &config.GudgeonList{Name: "Allow", Type: "allow"}
+	lists := []*config.GudgeonList{block, other, allow}
+
+	store.Init("", nil, lists)
+	store.Load(block, "ads.example.com")
+	store.Load(other, "ads.example.com")
+	store.Load(other, "example.com")
+	store.Load(allow, "good.ads.example.com")
+	store.Load(block, "com")
+	store.Finalize("", lists)
+	defer store.Close()
+
+	expect := func(checkLists []*config.GudgeonList, domain string, match Match, list *config.GudgeonList, ruleText string) {
+		foundMatch, foundList, foundRule := store.FindMatch(checkLists, domain)
+		if foundMatch != match || foundList != list || foundRule != ruleText {
+			t.Errorf("Expected '%s' to have match %d from rule '%s' but got %d from rule '%s'", domain, match, ruleText, foundMatch, foundRule)
+		}
+	}
+
+	// the most specific rule in the first list is reported
+	expect(lists, "x.ads.example.com", MatchBlock, block, "ads.example.com")
+	expect([]*config.GudgeonList{other}, "x.ads.example.com", MatchBlock, other, "ads.example.com")
+	expect([]*config.GudgeonList{other}, "www.example.com", MatchBlock, other, "example.com")
+	expect(lists, "www.example.com", MatchBlock, other, "example.com")
+	// allow lists come first
+	expect(lists, "a.good.ads.example.com", MatchAllow, allow, "good.ads.example.com")
+	// a top level domain rule only matches itself
+	expect(lists, "com", MatchBlock, block, "com")
+	expect([]*config.GudgeonList{block}, "else.com", MatchNone, nil, "")
+	expect(lists, "ads.example.org", MatchNone, nil, "")
+
+	// both lists share the node, removing the rule from one list keeps it in the other
+	store.Remove(block, "ads.example.com")
+	expect([]*config.GudgeonList{block}, "ads.example.com", MatchNone, nil, "")
+	expect([]*config.GudgeonList{other}, "ads.example.com", MatchBlock, other, "ads.example.com")
+	if len(store.sets) != 5 {
+		t.Errorf("Expected nodes with the same lists to share list sets but there are %d sets", len(store.sets))
+	}
+}
+
+func BenchmarkTrieRuleStore(b *testing.B) {
+	benchNonComplexStore(func() RuleStore { return &trieStore{} }, b)
+}
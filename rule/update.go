@@ -0,0 +1,113 @@
+package rule
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+// stores that take out exactly the rule that is removed (and never another rule) so that the changes to a list can be
+// applied to them in place instead of building a new store
+type inPlaceStore interface {
+	updatesInPlace() bool
+}
+
+// true if the changes to a list can be applied to the store with ApplyListChanges
+func UpdatesInPlace(store RuleStore) bool {
+	if store, ok := store.(inPlaceStore); ok {
+		return store.updatesInPlace()
+	}
+	return false
+}
+
+// the rules added to and removed from a list since a previous copy of it, with the number of rules loaded from and
+// skipped in the new copy (counted the same way as CreateStore)
+type ListChanges struct {
+	Added   []string
+	Removed []string
+	Loaded  uint64
+	Skipped uint64
+}
+
+// read the rules of a copy of the list (by their lowercase text, the stores don't tell rules apart by case), false if
+// the copy can't be read or has $badfilter, exception, or important rules (which change the rules of other lists or the
+// lists the store was made with)
+func readListCopy(listPath string, disabled map[string]bool) (map[string]string, uint64, uint64, bool) {
+	data, err := os.Open(listPath)
+	if err != nil {
+		return nil, 0, 0, false
+	}
+	defer data.Close()
+
+	rules := make(map[string]string)
+	loaded, skipped := uint64(0), uint64(0)
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		listRule := ParseListLine(scanner.Text())
+		if listRule == nil {
+			continue
+		}
+		if listRule.BadFilter || listRule.Exception || listRule.Important {
+			return nil, 0, 0, false
+		}
+		if disabled[listRule.key()] {
+			continue
+		}
+		if listRule.Unsupported {
+			skipped++
+			continue
+		}
+		rules[strings.ToLower(listRule.Text)] = listRule.Text
+		loaded++
+	}
+	if scanner.Err() != nil {
+		return nil, 0, 0, false
+	}
+
+	return rules, loaded, skipped, true
+}
+
+// the changes from the previous copy of the list to the list that is configured, false if the changes can't be applied
+// in place and the store has to be built again
+func ReadListChanges(conf *config.GudgeonConfig, list *config.GudgeonList, previousPath string) (*ListChanges, bool) {
+	if !IsDomainList(list) {
+		return nil, false
+	}
+
+	// rules disabled by $badfilter rules in the other lists are not loaded
+	disabled, _, _ := scanListRules(conf, domainLists(conf.Lists))
+
+	previous, _, _, ok := readListCopy(previousPath, disabled)
+	if !ok {
+		return nil, false
+	}
+	current, loaded, skipped, ok := readListCopy(conf.PathToList(list), disabled)
+	if !ok {
+		return nil, false
+	}
+
+	changes := &ListChanges{Loaded: loaded, Skipped: skipped}
+	for key, rule := range current {
+		if _, found := previous[key]; !found {
+			changes.Added = append(changes.Added, rule)
+		}
+	}
+	for key, rule := range previous {
+		if _, found := current[key]; !found {
+			changes.Removed = append(changes.Removed, rule)
+		}
+	}
+	return changes, true
+}
+
+// add and remove the changed rules of the list, the store must update in place (see UpdatesInPlace)
+func (changes *ListChanges) Apply(store RuleStore, list *config.GudgeonList) {
+	for _, rule := range changes.Removed {
+		store.Remove(list, rule)
+	}
+	for _, rule := range changes.Added {
+		store.Add(list, rule)
+	}
+}
@@ -3,7 +3,7 @@ import Axios from 'axios';
 import {
   GridItem,
 } from '@patternfly/react-core';
-import { ErrorCircleOIcon, VolumeIcon } from '@patternfly/react-icons';
+import { ErrorCircleOIcon, ExchangeAltIcon, VolumeIcon } from '@patternfly/react-icons';
 import MaterialTable from 'material-table';
 import { PrettyDate } from './helpers.js';
 
@@ -57,8 +57,16 @@ export class QueryLog extends React.Component {
             );
           } else if ( rowData.Match == 1 ) {
             return (
-              <div style={{ color: "red" }}><ErrorCircleOIcon alt="blocked" /> { rowData.MatchList }{ rowData.MatchRule ? ' (' + rowData.MatchRule + ")" : null }</div>
+              <div style={{ color: "red" }}><ErrorCircleOIcon alt="blocked" /> { rowData.MatchList }{ rowData.MatchRule ? ' (' + rowData.MatchRule + ")" : null }{ rowData.MatchCname ? ' via cname ' + rowData.MatchCname : null }</div>
             );          
+          } else if ( rowData.Paused ) {
+            return (
+              <div style={{ color: "orange" }}>{ responseText } (paused: { rowData.MatchList }{ rowData.MatchRule ? ' (' + rowData.MatchRule + ")" : null })</div>
+            );
+          } else if ( rowData.Rewritten ) {
+            return (
+              <div style={{ color: "blue" }}><ExchangeAltIcon alt="rewritten" /> { responseText }{ rowData.RewriteList ? ' (' + rowData.RewriteList + ")" : null }</div>
+            );
           } else if ( rowData.Cached ) {
             return (
               <div style={{ color: "green" }}><VolumeIcon alt="cached" /> { responseText }</div>
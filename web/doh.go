@@ -0,0 +1,117 @@
+package web
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// rfc8484 wire format media type
+	dnsMessageContentType = "application/dns-message"
+	// rfc8484 get parameter that holds the base64url encoded message
+	dnsQueryParameter = "dns"
+)
+
+// handles rfc8484 (dns-over-https) GET and POST requests by passing the decoded
+// message through the engine just like a request on any other dns interface
+func (web *web) HandleDNSQuery(c *gin.Context) {
+	var (
+		msgBytes []byte
+		err      error
+	)
+
+	switch c.Request.Method {
+	case http.MethodGet:
+		encoded := c.Query(dnsQueryParameter)
+		if "" == encoded {
+			c.String(http.StatusBadRequest, "Missing '%s' query parameter", dnsQueryParameter)
+			return
+		}
+		// the rfc says padding is not used but some clients send it anyway
+		msgBytes, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if err != nil {
+			c.String(http.StatusBadRequest, "Could not decode '%s' query parameter: %s", dnsQueryParameter, err)
+			return
+		}
+	case http.MethodPost:
+		if c.ContentType() != dnsMessageContentType {
+			c.String(http.StatusUnsupportedMediaType, "Content type must be '%s'", dnsMessageContentType)
+			return
+		}
+		// read no more than the largest possible dns message (plus one byte to detect larger messages)
+		msgBytes, err = ioutil.ReadAll(io.LimitReader(c.Request.Body, dns.MaxMsgSize+1))
+		if err != nil {
+			c.String(http.StatusBadRequest, "Could not read request body: %s", err)
+			return
+		}
+		if len(msgBytes) > dns.MaxMsgSize {
+			c.String(http.StatusRequestEntityTooLarge, "DNS message is larger than %d bytes", dns.MaxMsgSize)
+			return
+		}
+	default:
+		c.String(http.StatusMethodNotAllowed, "Method %s is not supported", c.Request.Method)
+		return
+	}
+
+	request := new(dns.Msg)
+	if err := request.Unpack(msgBytes); err != nil {
+		c.String(http.StatusBadRequest, "Could not unpack DNS message: %s", err)
+		return
+	}
+
+	// use the address of the connection and not a forwarded-for header because the
+	// address decides which consumer (and which block lists) the request belongs to
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		host = c.Request.RemoteAddr
+	}
+	address := net.ParseIP(host)
+	if address == nil {
+		address = net.IPv4zero
+	}
+
+	response, _, _ := web.engine.Handle(&address, "https", request)
+	if response == nil {
+		response = new(dns.Msg)
+		response.SetReply(request)
+		response.Rcode = dns.RcodeServerFailure
+	}
+
+	packed, err := response.Pack()
+	if err != nil {
+		log.Errorf("Packing DNS-over-HTTPS response: %s", err)
+		c.String(http.StatusInternalServerError, "Could not pack DNS response")
+		return
+	}
+
+	// the http cache lifetime should not outlive the smallest ttl in the response
+	c.Header("Cache-Control", fmt.Sprintf("max-age=%d", minimumTTL(response)))
+	c.Data(http.StatusOK, dnsMessageContentType, packed)
+}
+
+// the smallest ttl of all the records in the response, zero if there are no records
+func minimumTTL(response *dns.Msg) uint32 {
+	found := false
+	min := uint32(0)
+	for _, section := range [][]dns.RR{response.Answer, response.Ns, response.Extra} {
+		for _, rr := range section {
+			if rr == nil || rr.Header() == nil || rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			if !found || rr.Header().Ttl < min {
+				min = rr.Header().Ttl
+				found = true
+			}
+		}
+	}
+	return min
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/engine"
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestDNSOverHTTPS(t *testing.T) {
+	config := testutil.Conf(t, "./testdata/doh-test.yml")
+	defer os.RemoveAll(config.Home)
+
+	engine, err := engine.NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create engine: %s", err)
+		return
+	}
+	defer engine.Shutdown()
+
+	// only attach the dns-over-https handler to avoid the static asset box
+	web := &web{engine: engine, conf: config}
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.GET("/dns-query", web.HandleDNSQuery)
+	router.POST("/dns-query", web.HandleDNSQuery)
+	router.PUT("/dns-query", web.HandleDNSQuery)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	request := new(dns.Msg)
+	request.SetQuestion("google.com.", dns.TypeA)
+	// rfc8484 recommends a zero id for cache friendliness
+	request.Id = 0
+	packed, err := request.Pack()
+	if err != nil {
+		t.Errorf("Could not pack request: %s", err)
+		return
+	}
+
+	// get, with and without padding, and post should all be answered the same
+	responses := make([]*http.Response, 0)
+	for _, encoded := range []string{base64.RawURLEncoding.EncodeToString(packed), base64.URLEncoding.EncodeToString(packed)} {
+		response, err := http.Get(server.URL + "/dns-query?dns=" + encoded)
+		if err != nil {
+			t.Errorf("Could not make GET request: %s", err)
+			return
+		}
+		responses = append(responses, response)
+	}
+	response, err := http.Post(server.URL+"/dns-query", dnsMessageContentType, bytes.NewReader(packed))
+	if err != nil {
+		t.Errorf("Could not make POST request: %s", err)
+		return
+	}
+	responses = append(responses, response)
+
+	for _, response := range responses {
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200 but got %d: %s", response.StatusCode, string(body))
+			continue
+		}
+		if response.Header.Get("Content-Type") != dnsMessageContentType {
+			t.Errorf("Expected content type '%s' but got '%s'", dnsMessageContentType, response.Header.Get("Content-Type"))
+		}
+		answer := new(dns.Msg)
+		if err := answer.Unpack(body); err != nil {
+			t.Errorf("Could not unpack response: %s", err)
+			continue
+		}
+		if len(answer.Answer) < 1 {
+			t.Errorf("Expected an answer for google.com but got none")
+			continue
+		}
+		if a, ok := answer.Answer[0].(*dns.A); !ok || a.A.String() != "127.0.0.1" {
+			t.Errorf("Expected google.com to resolve to 127.0.0.1 but got %s", answer.Answer[0])
+		}
+	}
+
+	// error cases
+	data := []struct {
+		method      string
+		url         string
+		contentType string
+		body        []byte
+		status      int
+	}{
+		{http.MethodGet, "/dns-query", "", nil, http.StatusBadRequest},
+		{http.MethodGet, "/dns-query?dns=not*base64", "", nil, http.StatusBadRequest},
+		{http.MethodGet, "/dns-query?dns=AAAA", "", nil, http.StatusBadRequest},
+		{http.MethodPost, "/dns-query", "text/plain", packed, http.StatusUnsupportedMediaType},
+		{http.MethodPost, "/dns-query", dnsMessageContentType, make([]byte, dns.MaxMsgSize+10), http.StatusRequestEntityTooLarge},
+		{http.MethodPut, "/dns-query", dnsMessageContentType, packed, http.StatusMethodNotAllowed},
+	}
+	for _, d := range data {
+		httpRequest, _ := http.NewRequest(d.method, server.URL+d.url, bytes.NewReader(d.body))
+		if "" != d.contentType {
+			httpRequest.Header.Set("Content-Type", d.contentType)
+		}
+		response, err := http.DefaultClient.Do(httpRequest)
+		if err != nil {
+			t.Errorf("Could not make %s request to %s: %s", d.method, d.url, err)
+			continue
+		}
+		response.Body.Close()
+		if response.StatusCode != d.status {
+			t.Errorf("Expected status %d for %s %s but got %d", d.status, d.method, d.url, response.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// get a parameter from the query string or, if not there, from the posted form
+func queryOrForm(c *gin.Context, key string) string {
+	if value := c.Query(key); "" != value {
+		return value
+	}
+	return c.PostForm(key)
+}
+
+// list the pauses that have not expired
+func (web *web) GetPauses(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"pauses": web.engine.Pauses(),
+	})
+}
+
+// pause blocking for a consumer, a group, or (with neither) globally for the given duration
+func (web *web) AddPause(c *gin.Context) {
+	durationString := queryOrForm(c, "duration")
+	if "" == durationString {
+		c.String(http.StatusBadRequest, "A duration (like '5m' or '1h') must be provided")
+		return
+	}
+	duration, err := util.ParseDuration(durationString)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid duration '%s': %s", durationString, err)
+		return
+	}
+
+	consumer := strings.ToLower(queryOrForm(c, "consumer"))
+	group := strings.ToLower(queryOrForm(c, "group"))
+
+	pause, err := web.engine.Pause(consumer, group, duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("%s", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pause": pause,
+	})
+}
+
+// cancel the pause with the id in the path or, without an id, cancel all pauses
+func (web *web) CancelPause(c *gin.Context) {
+	cancelled := web.engine.CancelPause(c.Param("id"))
+	status := http.StatusOK
+	if !cancelled && "" != c.Param("id") {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"cancelled": cancelled,
+	})
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// list the custom rules that have not expired
+func (web *web) GetCustomRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"rules": web.engine.CustomRules(),
+	})
+}
+
+// add an allow or block rule for the given (comma separated) groups or every group, with an optional duration
+func (web *web) AddCustomRule(c *gin.Context) {
+	ruleText := strings.TrimSpace(queryOrForm(c, "rule"))
+	if "" == ruleText {
+		c.String(http.StatusBadRequest, "A rule (like 'example.com') must be provided")
+		return
+	}
+
+	duration := time.Duration(0)
+	if durationString := queryOrForm(c, "duration"); "" != durationString {
+		var err error
+		duration, err = util.ParseDuration(durationString)
+		if err != nil {
+			c.String(http.StatusBadRequest, "Invalid duration '%s': %s", durationString, err)
+			return
+		}
+	}
+
+	groups := make([]string, 0)
+	for _, group := range strings.Split(queryOrForm(c, "groups"), ",") {
+		if group = strings.ToLower(strings.TrimSpace(group)); "" != group {
+			groups = append(groups, group)
+		}
+	}
+
+	customRule, err := web.engine.AddCustomRule(ruleText, queryOrForm(c, "type"), groups, duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("%s", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rule": customRule,
+	})
+}
+
+// remove the custom rule with the id in the path
+func (web *web) RemoveCustomRule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid rule id '%s'", c.Param("id"))
+		return
+	}
+
+	removed := web.engine.RemoveCustomRule(id)
+	status := http.StatusOK
+	if !removed {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"removed": removed,
+	})
+}
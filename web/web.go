@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/GeertJohan/go.rice"
@@ -27,13 +28,20 @@ type web struct {
 	conf     *config.GudgeonConfig
 	server   *http.Server
 
+	// guards the configuration and engine components so they can be swapped between requests
+	lock     sync.RWMutex
 	engine   engine.Engine
 	metrics  engine.Metrics
 	queryLog engine.QueryLog
+
+	// called to reload the configuration and engine
+	reload func() error
 }
 
 type Web interface {
 	Serve(conf *config.GudgeonConfig, engine engine.Engine) error
+	UpdateEngine(conf *config.GudgeonConfig, engine engine.Engine)
+	SetReloadFunc(reload func() error)
 	Stop()
 }
 
@@ -252,6 +260,26 @@ func (web *web) GetQueryLogInfo(c *gin.Context) {
 		}
 	}
 
+	if paused := c.Query("paused"); len(paused) > 0 {
+		if "true" == strings.ToLower(paused) {
+			boolHolder := true
+			query.Paused = &boolHolder
+		} else if "false" == strings.ToLower(paused) {
+			boolHolder := false
+			query.Paused = &boolHolder
+		}
+	}
+
+	if rewritten := c.Query("rewritten"); len(rewritten) > 0 {
+		if "true" == strings.ToLower(rewritten) {
+			boolHolder := true
+			query.Rewritten = &boolHolder
+		} else if "false" == strings.ToLower(rewritten) {
+			boolHolder := false
+			query.Rewritten = &boolHolder
+		}
+	}
+
 	if address := c.Query("address"); len(address) > 0 {
 		query.Address = address
 	}
@@ -426,6 +454,18 @@ func (web *web) GetTestResult(c *gin.Context) {
 	rCon := resolver.DefaultRequestContext()
 	rCon.Protocol = "tcp"
 
+	// simulate the time of the request (seconds since unix epoch or rfc3339) to test schedules
+	if simulated := c.Query("time"); len(simulated) > 0 {
+		if seconds, err := strconv.ParseInt(simulated, 10, 64); err == nil {
+			rCon.Time = time.Unix(seconds, 0)
+		} else if parsed, err := time.Parse(time.RFC3339, simulated); err == nil {
+			rCon.Time = parsed
+		} else {
+			c.String(http.StatusBadRequest, "Time must be seconds since the unix epoch or an RFC3339 timestamp")
+			return
+		}
+	}
+
 	if consumer := c.Query("consumer"); len(consumer) > 0 {
 		response, _, result = web.engine.HandleWithConsumerName(consumer, rCon, question)
 	} else if groups := c.Query("groups"); len(groups) > 0 {
@@ -446,12 +486,63 @@ func (web *web) GetTestResult(c *gin.Context) {
 	})
 }
 
-func (web *web) Serve(conf *config.GudgeonConfig, engine engine.Engine) error {
-	// set metrics endpoint
+// every allow/block rule that matches the domain for the consumer and which of them decides the answer
+func (web *web) GetExplanation(c *gin.Context) {
+	domain := strings.TrimSpace(c.Query("domain"))
+	if len(domain) < 1 {
+		c.String(http.StatusBadRequest, "Domain must be provided")
+		return
+	}
+
+	c.JSON(http.StatusOK, web.engine.Explain(c.Query("consumer"), domain))
+}
+
+// swap the configuration and engine used by the api, returns once no requests are using the old engine
+func (web *web) UpdateEngine(conf *config.GudgeonConfig, engine engine.Engine) {
+	web.lock.Lock()
+	defer web.lock.Unlock()
+
 	web.engine = engine
 	web.metrics = engine.Metrics()
 	web.queryLog = engine.QueryLog()
 	web.conf = conf
+}
+
+// set the function used by the reload api
+func (web *web) SetReloadFunc(reload func() error) {
+	web.reload = reload
+}
+
+// holds the read lock for the duration of the request so that the engine isn't swapped out from under it
+func (web *web) readLock(c *gin.Context) {
+	web.lock.RLock()
+	defer web.lock.RUnlock()
+	c.Next()
+}
+
+// reload the configuration and engine
+func (web *web) Reload(c *gin.Context) {
+	if web.reload == nil {
+		c.String(http.StatusNotImplemented, "Reload not available")
+		return
+	}
+
+	if err := web.reload(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"reloaded": false,
+			"error":    fmt.Sprintf("%s", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reloaded": true,
+	})
+}
+
+func (web *web) Serve(conf *config.GudgeonConfig, engine engine.Engine) error {
+	// set metrics endpoint
+	web.UpdateEngine(conf, engine)
 
 	// create new router
 	gin.SetMode(gin.ReleaseMode)
@@ -462,10 +553,13 @@ func (web *web) Serve(conf *config.GudgeonConfig, engine engine.Engine) error {
 	box := rice.MustFindBox("static").HTTPBox()
 
 	// use static serving when no route is detected
-	router.NoRoute(web.ServeStatic(box))
+	router.NoRoute(web.readLock, web.ServeStatic(box))
+
+	// reload can't hold the read lock because it swaps the engine
+	router.POST("/api/reload", web.Reload)
 
 	// attach api
-	api := router.Group("/api")
+	api := router.Group("/api", web.readLock)
 	{
 		// metrics api
 		api.GET("/metrics/current", web.GetMetrics)
@@ -474,8 +568,24 @@ func (web *web) Serve(conf *config.GudgeonConfig, engine engine.Engine) error {
 		// testing/troubleshooting/diagnostics
 		api.GET("/test/components", web.GetTestComponents)
 		api.GET("/test/query", web.GetTestResult)
+		api.GET("/test/explain", web.GetExplanation)
 		// attach query log
 		api.GET("/query/list", web.GetQueryLogInfo)
+		// pause blocking
+		api.GET("/pause", web.GetPauses)
+		api.POST("/pause", web.AddPause)
+		api.DELETE("/pause", web.CancelPause)
+		api.DELETE("/pause/:id", web.CancelPause)
+		// runtime allow/block rules
+		api.GET("/rules", web.GetCustomRules)
+		api.POST("/rules", web.AddCustomRule)
+		api.DELETE("/rules/:id", web.RemoveCustomRule)
+	}
+
+	// dns-over-https
+	if conf.Web.DoH == nil || *conf.Web.DoH {
+		router.GET("/dns-query", web.readLock, web.HandleDNSQuery)
+		router.POST("/dns-query", web.readLock, web.HandleDNSQuery)
 	}
 
 	// go serve
@@ -486,9 +596,25 @@ func (web *web) Serve(conf *config.GudgeonConfig, engine engine.Engine) error {
 		Handler: router,
 	}
 	web.server = srv
+
+	// use tls if configured
+	if webConf.TLS != nil && webConf.TLS.Enabled {
+		tlsConfig, err := webConf.TLS.ServerConfig()
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
 	go func() {
 		// service connections
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Errorf("Starting server: %s", err)
 		}
 	}()